@@ -1,72 +1,287 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"hprof-tool/pkg/hprof"
 	"hprof-tool/pkg/model"
+	"hprof-tool/pkg/oql"
+	"hprof-tool/pkg/report"
 	"hprof-tool/pkg/snapshot"
 	"hprof-tool/pkg/web"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 func main() {
-	s, err := snapshot.NewSnapshot("./test-dump-file/heap_dump_test.hprof")
+	file := flag.String("file", "./test-dump-file/heap_dump_test.hprof", "hprof file")
+	layoutStr := flag.String("layout", "auto", "object layout: auto, 32, 64, 64-coops or 64-ccp, optionally with ,align=N")
+	reachabilityStr := flag.String("reachability", "all", "objects in the class histogram: all, reachable or unreachable")
+	reachabilityRefs := flag.String("reachability-refs", "strong,soft,weak,final,phantom", "reference strengths followed when marking reachable objects")
+	dominatorRefs := flag.String("dominator-refs", "strong,final", "reference strengths followed when computing retained sizes")
+	reportName := flag.String("report", "", "print a report and exit: leak-suspects, duplicate-strings, duplicate-arrays, collections, boxed-primitives, class-loaders, threads, jstack, locks, finalizers, weakly-reachable, off-heap, merged-paths or static-fields")
+	format := flag.String("format", "text", "report format: text or html")
+	output := flag.String("output", "", "report output file, stdout by default")
+	groupBy := flag.String("group-by", "", "group the class histogram: package, loader or superclass")
+	level := flag.Int("level", 0, "package grouping: number of package name segments, 0 for the full package")
+	queryText := flag.String("query", "", "run a query and exit, e.g. \"SELECT s, s.value.length FROM java.lang.String s WHERE s.value.length > 10000\"")
+	className := flag.String("class", "", "merged paths: class whose instances, including subclasses, are analyzed")
+	threshold := flag.Float64("threshold", 0.1, "leak suspects: minimum share of the heap retained by a suspect")
+	flag.Parse()
+
+	reachability, err := snapshot.ParseReachability(*reachabilityStr)
+	if err != nil {
+		panic(err)
+	}
+	// 建立索引之前检查查询语法
+	var query *oql.Query
+	if *queryText != "" {
+		if query, err = oql.Parse(*queryText); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	s, err := snapshot.NewSnapshot(*file)
+	if err != nil {
+		panic(err)
+	}
+	if *layoutStr != "auto" {
+		layout, err := hprof.ParseObjectLayout(*layoutStr)
+		if err != nil {
+			panic(err)
+		}
+		s.SetObjectLayout(layout)
+	}
+	strengths, err := model.ParseReferenceStrengths(*reachabilityRefs)
 	if err != nil {
 		panic(err)
 	}
+	s.SetReachabilityStrengths(strengths)
+	if strengths, err = model.ParseReferenceStrengths(*dominatorRefs); err != nil {
+		panic(err)
+	}
+	s.SetDominatorStrengths(strengths)
 	err = s.EnsureCreateIndex()
 	if err != nil {
 		panic(err)
 	}
 	println("EnsureCreateIndex done")
 
-	//threads := s.GetThreads()
-	//err = printThreads(s, threads)
-	//if err != nil {
-	//	panic(err)
-	//}
+	if query != nil {
+		if err = runQuery(s, query); err != nil {
+			panic(err)
+		}
+		return
+	}
 
-	classes, err := s.ListClassesStatistics()
-	if err != nil {
-		panic(err)
+	if *reportName != "" {
+		err = writeReport(s, *reportName, *format, *output, *threshold, *className)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if *groupBy != "" {
+		grouping, err := snapshot.ParseClassGrouping(*groupBy)
+		if err != nil {
+			panic(err)
+		}
+		groups, err := s.GroupClassesStatistics(reachability, grouping, *level)
+		if err != nil {
+			panic(err)
+		}
+		printClassGroups(groups)
+	} else {
+		classes, err := s.ListClassesStatistics(reachability)
+		if err != nil {
+			panic(err)
+		}
+		printClasses(classes)
 	}
-	printClasses(classes)
 
 	web.NewWebEndpoint(s).Start(":1323")
 }
 
-func printThreads(s *snapshot.Snapshot, threads map[uint32]*model.Thread) error {
-	for id, thread := range threads {
-		name, err := s.GetText(thread.NameId)
+func writeReport(s *snapshot.Snapshot, name, format, output string, threshold float64, className string) error {
+	w := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
 		if err != nil {
 			return err
 		}
-		groupName, err := s.GetText(thread.GroupNameId)
+		defer f.Close()
+		w = f
+	}
+	if format != "text" && format != "html" {
+		return fmt.Errorf("unknown report format: %s", format)
+	}
+	switch name {
+	case "leak-suspects":
+		opts := snapshot.DefaultLeakSuspectsOptions()
+		opts.Threshold = threshold
+		r, err := s.FindLeakSuspects(opts)
 		if err != nil {
 			return err
 		}
-		groupParentName, err := s.GetText(thread.GroupParentNameId)
+		if format == "html" {
+			return report.WriteLeakSuspectsHTML(w, r)
+		}
+		return report.WriteLeakSuspectsText(w, r)
+	case "duplicate-strings":
+		r, err := s.FindDuplicateStrings(snapshot.DefaultDuplicateStringsOptions())
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Thread %s (%s, %s) with ThreadSerialNumber = %d\n", name, groupName, groupParentName, id)
-		for _, frame := range thread.StackTrace.Frames {
-			cname, err := s.GetClassNameByClassSerialNumber(uint64(frame.ClassSerialNumber))
-			if err != nil {
-				return err
-			}
-			sourceFile, err := s.GetText(frame.SourceFileId)
-			if err != nil {
-				return err
-			}
-			method, err := s.GetText(frame.MethodId)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("  %s.%s(%s:%d)\n", cname, method, sourceFile, frame.Line)
+		if format == "html" {
+			return report.WriteDuplicateStringsHTML(w, r)
+		}
+		return report.WriteDuplicateStringsText(w, r)
+	case "duplicate-arrays":
+		r, err := s.FindDuplicateArrays(snapshot.DefaultDuplicateArraysOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteDuplicateArraysHTML(w, r)
+		}
+		return report.WriteDuplicateArraysText(w, r)
+	case "collections":
+		r, err := s.AnalyzeCollections(snapshot.DefaultCollectionsOptions())
+		if err != nil {
+			return err
 		}
-		println()
+		if format == "html" {
+			return report.WriteCollectionsHTML(w, r)
+		}
+		return report.WriteCollectionsText(w, r)
+	case "boxed-primitives":
+		r, err := s.AnalyzeBoxedPrimitives(snapshot.DefaultBoxedPrimitivesOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteBoxedPrimitivesHTML(w, r)
+		}
+		return report.WriteBoxedPrimitivesText(w, r)
+	case "class-loaders":
+		r, err := s.AnalyzeClassLoaders(snapshot.DefaultClassLoadersOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteClassLoadersHTML(w, r)
+		}
+		return report.WriteClassLoadersText(w, r)
+	case "threads":
+		r, err := s.GetThreadOverview()
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteThreadsHTML(w, r)
+		}
+		return report.WriteThreadsText(w, r)
+	case "jstack":
+		r, err := s.GetThreadOverview()
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return fmt.Errorf("jstack report only supports text format")
+		}
+		return report.WriteJStack(w, s.DumpTime(), r)
+	case "locks":
+		r, err := s.AnalyzeLocks()
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteLocksHTML(w, r)
+		}
+		return report.WriteLocksText(w, r)
+	case "finalizers":
+		r, err := s.AnalyzeFinalizers(snapshot.DefaultFinalizersOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteFinalizersHTML(w, r)
+		}
+		return report.WriteFinalizersText(w, r)
+	case "weakly-reachable":
+		r, err := s.FindWeaklyReachable(snapshot.DefaultWeaklyReachableOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteWeaklyReachableHTML(w, r)
+		}
+		return report.WriteWeaklyReachableText(w, r)
+	case "off-heap":
+		r, err := s.AnalyzeOffHeap(snapshot.DefaultOffHeapOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteOffHeapHTML(w, r)
+		}
+		return report.WriteOffHeapText(w, r)
+	case "merged-paths":
+		if className == "" {
+			return fmt.Errorf("merged-paths requires -class")
+		}
+		ids, err := s.ListObjectIds(className, true, snapshot.AllObjects)
+		if err != nil {
+			return err
+		}
+		r, err := s.MergePathsToGCRoots(ids, snapshot.DefaultMergedPathsOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteMergedPathsHTML(w, r)
+		}
+		return report.WriteMergedPathsText(w, r)
+	case "static-fields":
+		r, err := s.AnalyzeStaticFields(snapshot.DefaultStaticFieldsOptions())
+		if err != nil {
+			return err
+		}
+		if format == "html" {
+			return report.WriteStaticFieldsHTML(w, r)
+		}
+		return report.WriteStaticFieldsText(w, r)
 	}
-	return nil
+	return fmt.Errorf("unknown report: %s", name)
+}
+
+// runQuery 输出查询结果，第一行是列名，每行的列用 tab 分隔
+func runQuery(s *snapshot.Snapshot, q *oql.Query) error {
+	fmt.Println(strings.Join(q.Columns(), "\t"))
+	return oql.NewEngine(s).Execute(q, func(row []interface{}) error {
+		values := make([]string, len(row))
+		for idx, v := range row {
+			switch x := v.(type) {
+			case nil:
+				values[idx] = "null"
+			case *snapshot.ObjectRef:
+				values[idx] = fmt.Sprintf("%s (id %d)", x.Class, x.Id)
+				if x.Display != "" {
+					values[idx] += fmt.Sprintf(" %q", x.Display)
+				}
+			case string:
+				values[idx] = strconv.Quote(x)
+			default:
+				values[idx] = fmt.Sprint(x)
+			}
+		}
+		fmt.Println(strings.Join(values, "\t"))
+		return nil
+	})
 }
 
 func printClasses(classes []snapshot.ClassStatistics) {
@@ -75,6 +290,13 @@ func printClasses(classes []snapshot.ClassStatistics) {
 	})
 	println("Classes:")
 	for _, c := range classes {
-		fmt.Printf("%s(%d), %d, %d\n", c.Name, c.Id, c.InstanceCount, c.InstanceSize)
+		fmt.Printf("%s(%d), %d, %d, %d\n", c.Name, c.Id, c.InstanceCount, c.InstanceSize, c.RetainedSize)
+	}
+}
+
+func printClassGroups(groups []snapshot.ClassGroupStatistics) {
+	println("Class groups:")
+	for _, g := range groups {
+		fmt.Printf("%s, %d, %d, %d, %d\n", g.Name, g.ClassCount, g.InstanceCount, g.InstanceSize, g.RetainedSize)
 	}
 }
@@ -0,0 +1,149 @@
+package hprof
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compressedOopsHeapLimit is the largest address reachable with zero based
+// compressed oops (32 GiB with the default 8 byte alignment).
+const compressedOopsHeapLimit = 32 << 30
+
+// ObjectLayout describes how the JVM lays out objects in memory. It is used to
+// compute shallow sizes, which are not recorded in the HProf file.
+//
+// The field layout is approximated: fields of the whole class hierarchy are
+// packed right after the header and the result is rounded up to the object
+// alignment.
+type ObjectLayout struct {
+	// 64-bit JVM.
+	Is64Bit bool
+	// Object references are 4 bytes on a 64-bit JVM (-XX:+UseCompressedOops).
+	CompressedOops bool
+	// Class pointers in the header are 4 bytes on a 64-bit JVM
+	// (-XX:+UseCompressedClassPointers).
+	CompressedClassPointers bool
+	// Object alignment in bytes (-XX:ObjectAlignmentInBytes).
+	ObjectAlignment int
+}
+
+// NewObjectLayout returns a layout with the default 8 byte alignment.
+func NewObjectLayout(is64Bit, compressedOops, compressedClassPointers bool) *ObjectLayout {
+	return &ObjectLayout{
+		Is64Bit:                 is64Bit,
+		CompressedOops:          is64Bit && compressedOops,
+		CompressedClassPointers: is64Bit && compressedClassPointers,
+		ObjectAlignment:         8,
+	}
+}
+
+// DetectObjectLayout guesses the layout of the dumped JVM.
+//
+// HotSpot writes 8 byte IDs on every 64-bit JVM, so compressed oops are
+// assumed when every object address is below the compressed oops heap limit,
+// which is what the JVM does by default for heaps smaller than 32 GiB.
+func DetectObjectLayout(idSize int, maxObjectId uint64) *ObjectLayout {
+	if idSize <= 4 {
+		return NewObjectLayout(false, false, false)
+	}
+	compressed := maxObjectId < compressedOopsHeapLimit
+	return NewObjectLayout(true, compressed, compressed)
+}
+
+// ParseObjectLayout parses a layout description such as "32", "64",
+// "64-coops" (compressed oops and class pointers) or "64-ccp" (compressed
+// class pointers only), optionally followed by ",align=16".
+func ParseObjectLayout(s string) (*ObjectLayout, error) {
+	parts := strings.Split(s, ",")
+	var layout *ObjectLayout
+	switch parts[0] {
+	case "32":
+		layout = NewObjectLayout(false, false, false)
+	case "64":
+		layout = NewObjectLayout(true, false, false)
+	case "64-coops":
+		layout = NewObjectLayout(true, true, true)
+	case "64-ccp":
+		layout = NewObjectLayout(true, false, true)
+	default:
+		return nil, fmt.Errorf("unknown object layout: %s", s)
+	}
+	for _, part := range parts[1:] {
+		if !strings.HasPrefix(part, "align=") {
+			return nil, fmt.Errorf("unknown object layout option: %s", part)
+		}
+		value := strings.TrimPrefix(part, "align=")
+		alignment, err := strconv.Atoi(value)
+		if err != nil || alignment < 8 || alignment&(alignment-1) != 0 {
+			return nil, fmt.Errorf("invalid object alignment: %s", value)
+		}
+		layout.ObjectAlignment = alignment
+	}
+	return layout, nil
+}
+
+func (l *ObjectLayout) String() string {
+	if !l.Is64Bit {
+		return fmt.Sprintf("32-bit, align=%d", l.ObjectAlignment)
+	}
+	return fmt.Sprintf("64-bit, compressed oops=%t, compressed class pointers=%t, align=%d",
+		l.CompressedOops, l.CompressedClassPointers, l.ObjectAlignment)
+}
+
+// ReferenceSize returns the size of an object reference.
+func (l *ObjectLayout) ReferenceSize() int {
+	if l.Is64Bit && !l.CompressedOops {
+		return 8
+	}
+	return 4
+}
+
+// HeaderSize returns the size of the object header: mark word and class pointer.
+func (l *ObjectLayout) HeaderSize() int {
+	if !l.Is64Bit {
+		return 8
+	}
+	if l.CompressedClassPointers {
+		return 12
+	}
+	return 16
+}
+
+// ArrayHeaderSize returns the offset of the first element of an array.
+func (l *ObjectLayout) ArrayHeaderSize(elementSize int) int {
+	// Header plus the 4 byte length field.
+	size := l.HeaderSize() + 4
+	if elementSize == 8 || (l.Is64Bit && !l.CompressedClassPointers) {
+		size = alignUp(size, 8)
+	}
+	return size
+}
+
+// ValueSize returns the in-memory size of a field or array element.
+func (l *ObjectLayout) ValueSize(ty HProfValueType) int {
+	if ty == HProfValueType_OBJECT {
+		return l.ReferenceSize()
+	}
+	return ValueSize[ty]
+}
+
+// InstanceSize returns the shallow size of an instance with the given fields,
+// including the fields of all super classes.
+func (l *ObjectLayout) InstanceSize(fields []*HProfClass_InstanceField) int64 {
+	size := l.HeaderSize()
+	for _, field := range fields {
+		size += l.ValueSize(field.Type)
+	}
+	return int64(alignUp(size, l.ObjectAlignment))
+}
+
+// ArraySize returns the shallow size of an array of n elements.
+func (l *ObjectLayout) ArraySize(ty HProfValueType, n int) int64 {
+	elementSize := l.ValueSize(ty)
+	return int64(alignUp(l.ArrayHeaderSize(elementSize)+elementSize*n, l.ObjectAlignment))
+}
+
+func alignUp(size, alignment int) int {
+	return (size + alignment - 1) / alignment * alignment
+}
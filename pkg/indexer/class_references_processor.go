@@ -1,6 +1,9 @@
 package indexer
 
-import "hprof-tool/pkg/hprof"
+import (
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+)
 
 // ClassReferencesProcessor 计算 class 的 references
 type ClassReferencesProcessor struct {
@@ -22,7 +25,7 @@ func (p *ClassReferencesProcessor) process() error {
 
 func (p *ClassReferencesProcessor) saveReferences(rid uint64, references []uint64) error {
 	for _, ref := range references {
-		err := p.i.AppendReference(rid, ref, hprof.HProfHDRecordTypeClassDump)
+		err := p.i.AppendReference(rid, ref, hprof.HProfHDRecordTypeClassDump, model.ReferenceStrong)
 		if err != nil {
 			return err
 		}
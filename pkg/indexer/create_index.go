@@ -101,25 +101,37 @@ func (i *Indexer) onThreadRecord(record *hprof.HProfThreadRecord) error {
 func (i *Indexer) onClassRecord(record *hprof.HProfClassRecord) error {
 	// ClassObjectId 写入 DB
 	pos, _ := record.PosAndSize()
+	i.updateMaxObjectId(record.ClassObjectId)
 	return i.storage.SaveClass(pos, int64(record.ClassObjectId), int(record.InstanceSize))
 }
 
 func (i *Indexer) onInstanceRecord(r *hprof.HProfInstanceRecord) error {
+	// 这里先记录字段的字节数，ShallowSizeProcessor 再按 ObjectLayout 计算大小
 	pos, _ := r.PosAndSize()
-	size := len(r.Values) + 16
-	return i.storage.SaveInstance(pos, int64(r.ObjectId), int64(r.ClassObjectId), size)
+	i.updateMaxObjectId(r.ObjectId)
+	return i.storage.SaveInstance(pos, int64(r.ObjectId), int64(r.ClassObjectId), len(r.Values))
 }
 
 func (i *Indexer) onObjectArrayRecord(record *hprof.HProfObjectArrayRecord) error {
+	// 这里先记录元素个数，ShallowSizeProcessor 再按 ObjectLayout 计算大小
 	pos, _ := record.PosAndSize()
-	size := len(record.ElementObjectIds)*8 + 16
-	return i.storage.SaveObjectArray(pos, int64(record.ArrayObjectId), int64(record.ArrayClassObjectId), size)
+	i.updateMaxObjectId(record.ArrayObjectId)
+	return i.storage.SaveObjectArray(pos, int64(record.ArrayObjectId), int64(record.ArrayClassObjectId), len(record.ElementObjectIds))
 }
 
 func (i *Indexer) onPrimitiveArrayRecord(record *hprof.HProfPrimitiveArrayRecord) error {
 	// 这里用 ElementType 作为 classId，后续再替换
+	// 同样先记录元素个数
 	pos, _ := record.PosAndSize()
-	return i.storage.SavePrimitiveArray(pos, int64(record.ArrayObjectId), int64(record.ElementType), len(record.Values))
+	i.updateMaxObjectId(record.ArrayObjectId)
+	length := len(record.Values) / hprof.ValueSize[record.ElementType]
+	return i.storage.SavePrimitiveArray(pos, int64(record.ArrayObjectId), int64(record.ElementType), length)
+}
+
+func (i *Indexer) updateMaxObjectId(id uint64) {
+	if id > i.ctx.maxObjectId {
+		i.ctx.maxObjectId = id
+	}
 }
 
 func (i *Indexer) onRootJNIGlobalRecord(record *hprof.HProfRootJNIGlobal) error {
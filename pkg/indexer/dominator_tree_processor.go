@@ -0,0 +1,374 @@
+package indexer
+
+import (
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+	"sort"
+)
+
+// classKey 用于按类汇总 retained size，primitive array 的 cid 是 ElementType
+type classKey struct {
+	typ int
+	cid uint64
+}
+
+// DominatorTreeProcessor 从 GC roots 出发计算支配树和 retained size
+// 只跟随 dominatorStrengths 中的引用，只能通过其他引用到达的对象不在支配树中
+// 使用 Lengauer-Tarjan 算法，引用关系按需从 storage 读取，
+// 内存中只保留每个对象若干个 int32 的数组
+type DominatorTreeProcessor struct {
+	i *Indexer
+
+	// 下标即节点编号，最后一个节点是虚拟的根节点
+	objectIndex
+	shallow []int64
+	classes []int32
+	keys    []classKey
+
+	dfnum    []int32
+	vertex   []int32
+	parent   []int32
+	semi     []int32
+	ancestor []int32
+	best     []int32
+	idom     []int32
+	samedom  []int32
+	// bucket 用链表保存
+	bucketHead []int32
+	bucketNext []int32
+
+	path []int32
+}
+
+func newDominatorTreeProcessor(i *Indexer) *DominatorTreeProcessor {
+	return &DominatorTreeProcessor{i: i}
+}
+
+func (p *DominatorTreeProcessor) process() error {
+	println("DominatorTreeProcessor start")
+	err := p.loadNodes()
+	if err != nil {
+		return err
+	}
+	root := p.root()
+	count, err := p.dfs(root)
+	if err != nil {
+		return err
+	}
+	err = p.computeDominators(count)
+	if err != nil {
+		return err
+	}
+	retained := p.computeRetainedSizes(count)
+	err = p.saveDominators(count, retained)
+	if err != nil {
+		return err
+	}
+	return p.saveClassRetained(count, retained)
+}
+
+func (p *DominatorTreeProcessor) loadNodes() error {
+	keyIndex := map[classKey]int32{}
+	err := p.i.storage.ListRecords(func(id uint64, typ int, cid uint64, size int64) error {
+		class := noneNode
+		if typ == hprof.HProfHDRecordTypeClassDump {
+			// class 记录的 size 是实例大小，不是 class 对象本身的大小
+			size = 0
+		} else {
+			key := classKey{typ, cid}
+			idx, exist := keyIndex[key]
+			if !exist {
+				idx = int32(len(p.keys))
+				keyIndex[key] = idx
+				p.keys = append(p.keys, key)
+			}
+			class = idx
+		}
+		p.ids = append(p.ids, id)
+		p.shallow = append(p.shallow, size)
+		p.classes = append(p.classes, class)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n := len(p.ids) + 1
+	p.dfnum = make([]int32, n)
+	// dfnum 从 1 开始，所有对象都可达时最大为 n
+	p.vertex = make([]int32, n+1)
+	p.parent = newNodeArray(n)
+	p.semi = newNodeArray(n)
+	p.ancestor = newNodeArray(n)
+	p.best = make([]int32, n)
+	p.idom = newNodeArray(n)
+	p.samedom = newNodeArray(n)
+	p.bucketHead = newNodeArray(n)
+	p.bucketNext = newNodeArray(n)
+	for v := range p.best {
+		p.best[v] = int32(v)
+	}
+	return nil
+}
+
+func newNodeArray(n int) []int32 {
+	arr := make([]int32, n)
+	for idx := range arr {
+		arr[idx] = noneNode
+	}
+	return arr
+}
+
+func (p *DominatorTreeProcessor) root() int32 {
+	return int32(len(p.ids))
+}
+
+func (p *DominatorTreeProcessor) successors(v int32) ([]int32, error) {
+	var result []int32
+	if v == p.root() {
+		for id := range p.i.ctx.gcRoots {
+			if w := p.nodeOf(id); w != noneNode {
+				result = append(result, w)
+			}
+		}
+		// map 遍历顺序不固定，排序后保证结果稳定
+		sort.Slice(result, func(a, b int) bool {
+			return result[a] < result[b]
+		})
+		return result, nil
+	}
+	err := p.i.storage.ListOutboundReferences(p.ids[v], func(to uint64, typ, strength int) error {
+		if !p.follow(strength) {
+			return nil
+		}
+		if w := p.nodeOf(to); w != noneNode {
+			result = append(result, w)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (p *DominatorTreeProcessor) predecessors(v int32) ([]int32, error) {
+	var result []int32
+	if _, exist := p.i.ctx.gcRoots[p.ids[v]]; exist {
+		result = append(result, p.root())
+	}
+	err := p.i.storage.ListInboundReferences(p.ids[v], func(from uint64, typ, strength int) error {
+		if !p.follow(strength) {
+			return nil
+		}
+		if w := p.nodeOf(from); w != noneNode {
+			result = append(result, w)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// follow 判断计算支配树时是否跟随这个强度的引用
+func (p *DominatorTreeProcessor) follow(strength int) bool {
+	s := model.ReferenceStrength(strength)
+	return s == model.ReferenceStrong || model.ContainsReferenceStrength(p.i.dominatorStrengths, s)
+}
+
+// dfs 给所有可达节点编号，dfnum 从 1 开始，0 表示不可达
+func (p *DominatorTreeProcessor) dfs(root int32) (int32, error) {
+	type frame struct {
+		v     int32
+		succ  []int32
+		index int
+	}
+	var count int32 = 1
+	visit := func(v, from int32) (*frame, error) {
+		p.dfnum[v] = count
+		p.vertex[count] = v
+		p.parent[v] = from
+		count++
+		succ, err := p.successors(v)
+		if err != nil {
+			return nil, err
+		}
+		return &frame{v: v, succ: succ}, nil
+	}
+	f, err := visit(root, noneNode)
+	if err != nil {
+		return 0, err
+	}
+	stack := []*frame{f}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if top.index >= len(top.succ) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		w := top.succ[top.index]
+		top.index++
+		if p.dfnum[w] != 0 {
+			continue
+		}
+		f, err = visit(w, top.v)
+		if err != nil {
+			return 0, err
+		}
+		stack = append(stack, f)
+	}
+	return count, nil
+}
+
+func (p *DominatorTreeProcessor) computeDominators(count int32) error {
+	for i := count - 1; i >= 2; i-- {
+		n := p.vertex[i]
+		parent := p.parent[n]
+		s := parent
+		preds, err := p.predecessors(n)
+		if err != nil {
+			return err
+		}
+		for _, v := range preds {
+			if p.dfnum[v] == 0 {
+				// 不可达的对象
+				continue
+			}
+			var candidate int32
+			if p.dfnum[v] <= p.dfnum[n] {
+				candidate = v
+			} else {
+				candidate = p.semi[p.ancestorWithLowestSemi(v)]
+			}
+			if p.dfnum[candidate] < p.dfnum[s] {
+				s = candidate
+			}
+		}
+		p.semi[n] = s
+		p.bucketNext[n] = p.bucketHead[s]
+		p.bucketHead[s] = n
+		p.ancestor[n] = parent
+		for v := p.bucketHead[parent]; v != noneNode; v = p.bucketNext[v] {
+			y := p.ancestorWithLowestSemi(v)
+			if p.semi[y] == p.semi[v] {
+				p.idom[v] = parent
+			} else {
+				p.samedom[v] = y
+			}
+		}
+		p.bucketHead[parent] = noneNode
+	}
+	for i := int32(2); i < count; i++ {
+		n := p.vertex[i]
+		if p.samedom[n] != noneNode {
+			p.idom[n] = p.idom[p.samedom[n]]
+		}
+	}
+	return nil
+}
+
+// ancestorWithLowestSemi 非递归的路径压缩
+func (p *DominatorTreeProcessor) ancestorWithLowestSemi(v int32) int32 {
+	path := p.path[:0]
+	u := v
+	for p.ancestor[p.ancestor[u]] != noneNode {
+		path = append(path, u)
+		u = p.ancestor[u]
+	}
+	for k := len(path) - 1; k >= 0; k-- {
+		w := path[k]
+		a := p.ancestor[w]
+		b := p.best[a]
+		p.ancestor[w] = p.ancestor[a]
+		if p.dfnum[p.semi[b]] < p.dfnum[p.semi[p.best[w]]] {
+			p.best[w] = b
+		}
+	}
+	p.path = path
+	return p.best[v]
+}
+
+// computeRetainedSizes 按 dfnum 倒序把 retained size 累加到直接支配者
+func (p *DominatorTreeProcessor) computeRetainedSizes(count int32) []int64 {
+	retained := make([]int64, len(p.ids)+1)
+	copy(retained, p.shallow)
+	for i := count - 1; i >= 2; i-- {
+		v := p.vertex[i]
+		retained[p.idom[v]] += retained[v]
+	}
+	return retained
+}
+
+func (p *DominatorTreeProcessor) saveDominators(count int32, retained []int64) error {
+	root := p.root()
+	for i := int32(2); i < count; i++ {
+		v := p.vertex[i]
+		var idom uint64 = 0
+		if p.idom[v] != root {
+			idom = p.ids[p.idom[v]]
+		}
+		err := p.i.storage.SaveDominator(p.ids[v], idom, retained[v])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveClassRetained 计算每个类所有实例的 retained size 之和，
+// 被同类实例支配的对象不重复计算
+func (p *DominatorTreeProcessor) saveClassRetained(count int32, retained []int64) error {
+	// 按 dfnum 顺序建立支配树的子节点列表
+	offsets := make([]int32, len(p.ids)+2)
+	for i := int32(2); i < count; i++ {
+		offsets[p.idom[p.vertex[i]]+1]++
+	}
+	for v := 1; v < len(offsets); v++ {
+		offsets[v] += offsets[v-1]
+	}
+	children := make([]int32, offsets[len(offsets)-1])
+	fill := make([]int32, len(p.ids)+1)
+	copy(fill, offsets)
+	for i := int32(2); i < count; i++ {
+		v := p.vertex[i]
+		children[fill[p.idom[v]]] = v
+		fill[p.idom[v]]++
+	}
+
+	active := make([]int32, len(p.keys))
+	classRetained := make([]int64, len(p.keys))
+	type frame struct {
+		v     int32
+		index int32
+	}
+	stack := []frame{{v: p.root(), index: offsets[p.root()]}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.index >= offsets[top.v+1] {
+			if c := p.classOf(top.v); c != noneNode {
+				active[c]--
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		w := children[top.index]
+		top.index++
+		if c := p.classOf(w); c != noneNode {
+			if active[c] == 0 {
+				classRetained[c] += retained[w]
+			}
+			active[c]++
+		}
+		stack = append(stack, frame{v: w, index: offsets[w]})
+	}
+
+	for idx, key := range p.keys {
+		err := p.i.storage.SaveClassRetained(key.typ, key.cid, classRetained[idx])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *DominatorTreeProcessor) classOf(v int32) int32 {
+	if v == p.root() {
+		return noneNode
+	}
+	return p.classes[v]
+}
@@ -0,0 +1,276 @@
+package indexer
+
+import (
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+	"hprof-tool/pkg/storage"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type testEdge struct {
+	from, to uint64
+	strength model.ReferenceStrength
+}
+
+// graphStorage 只实现 DominatorTreeProcessor 用到的方法
+type graphStorage struct {
+	storage.Storage
+	// map[id]cid，所有对象都是 instance，shallow size 为 10
+	objects map[uint64]uint64
+	edges   []testEdge
+
+	idoms         map[uint64]uint64
+	retained      map[uint64]int64
+	classRetained map[uint64]int64
+}
+
+func (g *graphStorage) ListRecords(fn func(id uint64, typ int, cid uint64, size int64) error) error {
+	var ids []uint64
+	for id := range g.objects {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	for _, id := range ids {
+		if err := fn(id, hprof.HProfHDRecordTypeInstanceDump, g.objects[id], 10); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *graphStorage) ListOutboundReferences(rid uint64, fn func(to uint64, typ, strength int) error) error {
+	for _, e := range g.edges {
+		if e.from == rid {
+			if err := fn(e.to, hprof.HProfHDRecordTypeInstanceDump, int(e.strength)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *graphStorage) ListInboundReferences(rid uint64, fn func(from uint64, typ, strength int) error) error {
+	for _, e := range g.edges {
+		if e.to == rid {
+			if err := fn(e.from, hprof.HProfHDRecordTypeInstanceDump, int(e.strength)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *graphStorage) SaveDominator(id, idom uint64, retained int64) error {
+	g.idoms[id] = idom
+	g.retained[id] = retained
+	return nil
+}
+
+func (g *graphStorage) SaveClassRetained(typ int, cid uint64, retained int64) error {
+	g.classRetained[cid] = retained
+	return nil
+}
+
+func buildDominatorTree(t *testing.T, objects map[uint64]uint64, edges []testEdge, roots []uint64) *graphStorage {
+	t.Helper()
+	g := &graphStorage{
+		objects:       objects,
+		edges:         edges,
+		idoms:         map[uint64]uint64{},
+		retained:      map[uint64]int64{},
+		classRetained: map[uint64]int64{},
+	}
+	i := NewSqliteIndexer(nil, g)
+	for _, id := range roots {
+		i.ctx.gcRoots[id] = append(i.ctx.gcRoots[id], model.NewGcRootInfo(id, 0, model.GCRootType_UNKNOWN))
+	}
+	if err := newDominatorTreeProcessor(i).process(); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func strong(from, to uint64) testEdge {
+	return testEdge{from, to, model.ReferenceStrong}
+}
+
+func TestDominatorTree(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []testEdge
+		roots []uint64
+		// map[id]cid，没有指定时所有对象的 cid 为 1
+		classes map[uint64]uint64
+		// 不在 idoms 中的对象不可达，不应该保存支配信息
+		idoms         map[uint64]uint64
+		retained      map[uint64]int64
+		classRetained map[uint64]int64
+	}{
+		{
+			name:     "diamond",
+			edges:    []testEdge{strong(1, 2), strong(1, 3), strong(2, 4), strong(3, 4), strong(4, 5)},
+			roots:    []uint64{1},
+			classes:  map[uint64]uint64{1: 100, 2: 200, 3: 200, 4: 100, 5: 200},
+			idoms:    map[uint64]uint64{1: 0, 2: 1, 3: 1, 4: 1, 5: 4},
+			retained: map[uint64]int64{1: 50, 2: 10, 3: 10, 4: 20, 5: 10},
+			// 4 被同类的 1 支配，5 被其他类的 4 支配
+			classRetained: map[uint64]int64{100: 50, 200: 30},
+		},
+		{
+			name:     "cycle back to root",
+			edges:    []testEdge{strong(1, 2), strong(2, 3), strong(3, 1), strong(3, 4)},
+			roots:    []uint64{1},
+			idoms:    map[uint64]uint64{1: 0, 2: 1, 3: 2, 4: 3},
+			retained: map[uint64]int64{1: 40, 2: 30, 3: 20, 4: 10},
+		},
+		{
+			name:     "unreachable node",
+			edges:    []testEdge{strong(1, 2), strong(3, 2), strong(3, 4)},
+			roots:    []uint64{1},
+			idoms:    map[uint64]uint64{1: 0, 2: 1},
+			retained: map[uint64]int64{1: 20, 2: 10},
+		},
+		{
+			name:     "shared by two roots",
+			edges:    []testEdge{strong(1, 3), strong(2, 3), strong(3, 4)},
+			roots:    []uint64{1, 2},
+			idoms:    map[uint64]uint64{1: 0, 2: 0, 3: 0, 4: 3},
+			retained: map[uint64]int64{1: 10, 2: 10, 3: 20, 4: 10},
+		},
+		{
+			name:     "weak reference not followed",
+			edges:    []testEdge{strong(1, 2), {1, 3, model.ReferenceWeak}, strong(2, 4), {3, 4, model.ReferenceStrong}},
+			roots:    []uint64{1},
+			idoms:    map[uint64]uint64{1: 0, 2: 1, 4: 2},
+			retained: map[uint64]int64{1: 30, 2: 20, 4: 10},
+		},
+		{
+			name:     "irreducible loop",
+			edges:    []testEdge{strong(1, 2), strong(1, 3), strong(2, 3), strong(3, 2), strong(2, 4), strong(3, 4)},
+			roots:    []uint64{1},
+			idoms:    map[uint64]uint64{1: 0, 2: 1, 3: 1, 4: 1},
+			retained: map[uint64]int64{1: 40, 2: 10, 3: 10, 4: 10},
+		},
+		{
+			// 2 的 semidominator 是 1，但 dfs 先经过 2 到达 4
+			name:     "back edge into chain",
+			edges:    []testEdge{strong(1, 2), strong(2, 3), strong(3, 4), strong(4, 5), strong(5, 2), strong(1, 4)},
+			roots:    []uint64{1},
+			idoms:    map[uint64]uint64{1: 0, 2: 1, 3: 2, 4: 1, 5: 4},
+			retained: map[uint64]int64{1: 50, 2: 20, 3: 10, 4: 20, 5: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := map[uint64]uint64{}
+			for _, e := range tt.edges {
+				objects[e.from], objects[e.to] = 1, 1
+			}
+			for id, cid := range tt.classes {
+				objects[id] = cid
+			}
+			g := buildDominatorTree(t, objects, tt.edges, tt.roots)
+			if len(g.idoms) != len(tt.idoms) {
+				t.Errorf("idoms = %v, want %v", g.idoms, tt.idoms)
+			}
+			for id, want := range tt.idoms {
+				if got, exist := g.idoms[id]; !exist || got != want {
+					t.Errorf("idom of %d = %d (saved %v), want %d", id, got, exist, want)
+				}
+				if got := g.retained[id]; got != tt.retained[id] {
+					t.Errorf("retained size of %d = %d, want %d", id, got, tt.retained[id])
+				}
+			}
+			for cid, want := range tt.classRetained {
+				if got := g.classRetained[cid]; got != want {
+					t.Errorf("retained size of class %d = %d, want %d", cid, got, want)
+				}
+			}
+		})
+	}
+}
+
+// naiveDominators 删除每个节点后检查哪些节点变得不可达，返回 map[id]idom，0 是虚拟的根节点
+func naiveDominators(n uint64, edges []testEdge, roots []uint64) map[uint64]uint64 {
+	reach := func(removed uint64) map[uint64]bool {
+		seen := map[uint64]bool{}
+		var stack []uint64
+		for _, r := range roots {
+			if r != removed && !seen[r] {
+				seen[r] = true
+				stack = append(stack, r)
+			}
+		}
+		for len(stack) > 0 {
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range edges {
+				if e.from == v && e.to != removed && !seen[e.to] {
+					seen[e.to] = true
+					stack = append(stack, e.to)
+				}
+			}
+		}
+		return seen
+	}
+	all := reach(0)
+	// dominators[v] 是 v 的严格支配者
+	dominators := map[uint64][]uint64{}
+	for d := uint64(1); d <= n; d++ {
+		if !all[d] {
+			continue
+		}
+		without := reach(d)
+		for v := range all {
+			if v != d && !without[v] {
+				dominators[v] = append(dominators[v], d)
+			}
+		}
+	}
+	result := map[uint64]uint64{}
+	for v := range all {
+		// 严格支配者构成一条链，直接支配者是自身支配者最多的那个
+		var idom uint64
+		for _, d := range dominators[v] {
+			if idom == 0 || len(dominators[d]) > len(dominators[idom]) {
+				idom = d
+			}
+		}
+		result[v] = idom
+	}
+	return result
+}
+
+func TestDominatorTreeRandomGraphs(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 200; round++ {
+		n := uint64(2 + r.Intn(12))
+		objects := map[uint64]uint64{}
+		for id := uint64(1); id <= n; id++ {
+			objects[id] = 1
+		}
+		var edges []testEdge
+		for k := r.Intn(int(n) * 3); k > 0; k-- {
+			edges = append(edges, strong(uint64(1+r.Intn(int(n))), uint64(1+r.Intn(int(n)))))
+		}
+		roots := []uint64{1}
+		if r.Intn(3) == 0 {
+			roots = append(roots, uint64(1+r.Intn(int(n))))
+		}
+		t.Run(fmt.Sprint(round), func(t *testing.T) {
+			g := buildDominatorTree(t, objects, edges, roots)
+			want := naiveDominators(n, edges, roots)
+			if len(g.idoms) != len(want) {
+				t.Fatalf("edges %v roots %v: idoms = %v, want %v", edges, roots, g.idoms, want)
+			}
+			for id, idom := range want {
+				if g.idoms[id] != idom {
+					t.Fatalf("edges %v roots %v: idom of %d = %d, want %d", edges, roots, id, g.idoms[id], idom)
+				}
+			}
+		})
+	}
+}
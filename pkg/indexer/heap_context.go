@@ -25,6 +25,14 @@ type HeapContext struct {
 	// references
 	classReferences    map[uint64][]uint64
 	instanceReferences map[uint64][]uint64
+
+	// 用于推测 ObjectLayout
+	maxObjectId uint64
+
+	// map[classId]引用强度，按需计算
+	classReferenceStrengths map[uint64]model.ReferenceStrength
+	// map[线程对象 id]线程名的 string id，第一次查询时从 START THREAD 记录生成
+	threadObject2NameId map[uint64]uint64
 }
 
 func newHeapContext() *HeapContext {
@@ -43,5 +51,7 @@ func newHeapContext() *HeapContext {
 
 		classReferences:    map[uint64][]uint64{},
 		instanceReferences: map[uint64][]uint64{},
+
+		classReferenceStrengths: map[uint64]model.ReferenceStrength{},
 	}
 }
@@ -1,10 +1,10 @@
 package indexer
 
 import (
-	"fmt"
 	"hprof-tool/pkg/hprof"
 	"hprof-tool/pkg/model"
 	"hprof-tool/pkg/storage"
+	"time"
 )
 
 const (
@@ -20,6 +20,11 @@ var PRIMITIVE_TYPE_ARRAY = []string{"", "", "", "",
 type Indexer struct {
 	hreader *hprof.HProfReader
 	storage storage.Storage
+	// 为 nil 时在 ShallowSizeProcessor 中自动推测
+	layout *hprof.ObjectLayout
+	// 标记可达对象和计算支配树时跟随的 Reference.referent 引用强度，强引用总是跟随
+	reachabilityStrengths []model.ReferenceStrength
+	dominatorStrengths    []model.ReferenceStrength
 
 	ctx *HeapContext
 }
@@ -29,10 +34,50 @@ func NewSqliteIndexer(hreader *hprof.HProfReader, storage storage.Storage) *Inde
 		hreader: hreader,
 		storage: storage,
 
+		// 软引用和弱引用指向的对象还没有被回收，但不算在持有者的 retained size 中，
+		// 等待 finalize 的对象在 finalize 之前不能回收，算在 Finalizer 的 retained size 中
+		reachabilityStrengths: model.ReferenceStrengthsByReachability,
+		dominatorStrengths:    []model.ReferenceStrength{model.ReferenceStrong, model.ReferenceFinal},
+
 		ctx: newHeapContext(),
 	}
 }
 
+// SetObjectLayout 指定计算对象大小使用的 ObjectLayout，需要在 Processor 之前调用
+func (i *Indexer) SetObjectLayout(layout *hprof.ObjectLayout) {
+	i.layout = layout
+}
+
+func (i *Indexer) ObjectLayout() *hprof.ObjectLayout {
+	return i.layout
+}
+
+// SetReachabilityStrengths 指定标记可达对象时跟随的引用强度，需要在 Processor 之前调用
+func (i *Indexer) SetReachabilityStrengths(strengths []model.ReferenceStrength) {
+	i.reachabilityStrengths = strengths
+}
+
+func (i *Indexer) ReachabilityStrengths() []model.ReferenceStrength {
+	return i.reachabilityStrengths
+}
+
+// SetDominatorStrengths 指定计算支配树和 retained size 时跟随的引用强度，需要在 Processor 之前调用
+func (i *Indexer) SetDominatorStrengths(strengths []model.ReferenceStrength) {
+	i.dominatorStrengths = strengths
+}
+
+func (i *Indexer) DominatorStrengths() []model.ReferenceStrength {
+	return i.dominatorStrengths
+}
+
+// DumpTime 返回 hprof 文件头中记录的 dump 时间
+func (i *Indexer) DumpTime() time.Time {
+	if i.hreader.Header == nil {
+		return time.Time{}
+	}
+	return i.hreader.Header.Timestamp
+}
+
 func (i *Indexer) GetText(tid uint64) (string, error) {
 	pos, text, err := i.storage.GetText(tid)
 	if err != nil {
@@ -43,7 +88,7 @@ func (i *Indexer) GetText(tid uint64) (string, error) {
 	}
 	record, err := hprof.ReadHProfUTF8RecordWithPos(i.hreader, pos)
 	if err != nil {
-		return "", err
+		return "", storage.NewCorruptRecordError(tid, pos, err)
 	}
 	return string(record.Name), nil
 }
@@ -71,7 +116,7 @@ func (i *Indexer) ForEachClassRecords(fn func(record *hprof.HProfClassRecord) er
 		}
 		cla, err := hprof.ReadHProfClassRecordWithPos(i.hreader, pos)
 		if err != nil {
-			return nil
+			return storage.NewCorruptRecordError(cid, pos, err)
 		}
 		return fn(cla)
 	})
@@ -82,12 +127,34 @@ func (i *Indexer) ForEachInstanceRecords(fn func(record *hprof.HProfInstanceReco
 	return i.storage.ListInstances(func(oid uint64, pos int64, cid uint64) error {
 		instance, err := hprof.ReadHProfInstanceRecordWithPos(i.hreader, pos)
 		if err != nil {
-			return nil
+			return storage.NewCorruptRecordError(oid, pos, err)
 		}
 		return fn(instance)
 	})
 }
 
+// ForEachObjectArrayRecords 获取所有的 object array record
+func (i *Indexer) ForEachObjectArrayRecords(fn func(record *hprof.HProfObjectArrayRecord) error) error {
+	return i.storage.ListObjectArrays(func(oid uint64, pos int64, cid uint64) error {
+		array, err := hprof.ReadHProfObjectArrayRecordWithPos(i.hreader, pos)
+		if err != nil {
+			return storage.NewCorruptRecordError(oid, pos, err)
+		}
+		return fn(array)
+	})
+}
+
+// ForEachPrimitiveArrayRecords 逐个读取某种元素类型的 primitive array record 和 shallow size
+func (i *Indexer) ForEachPrimitiveArrayRecords(typ hprof.HProfValueType, reachability storage.Reachability, fn func(record *hprof.HProfPrimitiveArrayRecord, size int64) error) error {
+	return i.storage.ListPrimitiveArrayByClass(uint64(typ), reachability, func(id uint64, pos, size, retained int64) error {
+		array, err := hprof.ReadHProfPrimitiveArrayRecordWithPos(i.hreader, pos)
+		if err != nil {
+			return storage.NewCorruptRecordError(id, pos, err)
+		}
+		return fn(array, size)
+	})
+}
+
 func (i *Indexer) ForEachThreads(fn func(record *hprof.HProfThreadRecord) error) error {
 	return i.storage.ListThreads(fn)
 }
@@ -107,44 +174,23 @@ func (i *Indexer) ForEachGCRoots(fn func(record hprof.HProfRecord) error) error
 		switch typ {
 		case hprof.GCRootType_NATIVE_STATIC:
 			record, err = hprof.ReadHProfRootJNIGlobalWithPos(i.hreader, pos)
-			if err != nil {
-				return err
-			}
-			err = fn(record)
 		case hprof.GCRootType_NATIVE_LOCAL:
 			record, err = hprof.ReadHProfRootJNILocalWithPos(i.hreader, pos)
-			if err != nil {
-				return err
-			}
-			err = fn(record)
 		case hprof.GCRootType_JAVA_LOCAL:
 			record, err = hprof.ReadHProfRootJavaFrameWithPos(i.hreader, pos)
-			if err != nil {
-				return err
-			}
-			err = fn(record)
 		case hprof.GCRootType_SYSTEM_CLASS:
 			record, err = hprof.ReadHProfRootStickyClassWithPos(i.hreader, pos)
-			if err != nil {
-				return err
-			}
-			err = fn(record)
 		case hprof.GCRootType_THREAD_OBJ:
 			record, err = hprof.ReadHProfRootThreadObjWithPos(i.hreader, pos)
-			if err != nil {
-				return err
-			}
-			err = fn(record)
 		case hprof.GCRootType_BUSY_MONITOR:
 			record, err = hprof.ReadHProfRootMonitorUsedWithPos(i.hreader, pos)
-			if err != nil {
-				return err
-			}
-			err = fn(record)
 		default:
-			err = fmt.Errorf("unknown gc root record type: %d", typ)
+			return storage.NewUnsupportedRecordError(typ, 0, pos)
 		}
-		return err
+		if err != nil {
+			return storage.NewCorruptRecordError(0, pos, err)
+		}
+		return fn(record)
 	})
 }
 
@@ -185,25 +231,43 @@ func (i *Indexer) getClassById(cid uint64) (*hprof.HProfClassRecord, error) {
 		return class, nil
 	}
 	class, err = hprof.ReadHProfClassRecordWithPos(i.hreader, pos)
-	return class, err
+	if err != nil {
+		return nil, storage.NewCorruptRecordError(cid, pos, err)
+	}
+	return class, nil
 }
 
+// GetThreads 返回所有线程和它们的调用栈，key 是 ThreadSerialNumber
 func (i *Indexer) GetThreads() map[uint32]*model.Thread {
-	// TODO 修复 Thread 信息的处理
-	//var traces = map[uint32]*model.StackTrace{}
-	var threads = map[uint32]*model.Thread{}
+	traces := map[uint32]*stackTrace{}
 	for _, v := range i.ctx.serNum2stackTrace {
+		traces[v.ThreadSerialNumber] = v
+	}
+	// jmap 生成的文件没有 START THREAD 记录，线程对象来自 ROOT THREAD OBJECT
+	all := map[uint32]*thread{}
+	for sn, id := range i.ctx.thread2Id {
+		all[sn] = &thread{ObjectId: id}
+	}
+	for sn, t := range i.ctx.threadSN2thread {
+		all[sn] = t
+	}
+	var threads = map[uint32]*model.Thread{}
+	for sn, thread := range all {
 		trace := &model.StackTrace{
-			ThreadSerialNumber: v.ThreadSerialNumber,
+			ThreadSerialNumber: sn,
+			Locals:             i.ctx.thread2locals[sn],
 		}
-		for _, fid := range v.FrameIds {
-			trace.Frames = append(trace.Frames, i.ctx.id2frame[fid])
+		if v, exist := traces[sn]; exist {
+			for _, fid := range v.FrameIds {
+				frame, exist := i.ctx.id2frame[fid]
+				if !exist {
+					// 保留位置，LocalFrame 按下标对应到栈帧
+					frame = &model.StackFrame{FrameId: fid}
+				}
+				trace.Frames = append(trace.Frames, frame)
+			}
 		}
-		trace.Locals = i.ctx.thread2locals[v.ThreadSerialNumber]
-		//traces[k] = trace
-		thread := i.ctx.threadSN2thread[v.ThreadSerialNumber]
-		fmt.Printf("Get Thread by ThreadSerialNumber = %d\n", v.ThreadSerialNumber)
-		threads[v.ThreadSerialNumber] = &model.Thread{
+		threads[sn] = &model.Thread{
 			ObjectId:          thread.ObjectId,
 			NameId:            thread.NameId,
 			GroupNameId:       thread.GroupNameId,
@@ -214,29 +278,41 @@ func (i *Indexer) GetThreads() map[uint32]*model.Thread {
 	return threads
 }
 
-func (i *Indexer) GetClassesStatistics(fn func(cid uint64, cname string, count, size int64) error) error {
-	err := i.storage.CountInstancesByClass(func(cid uint64, count, size int64) error {
+func (i *Indexer) GetClassesStatistics(reachability storage.Reachability, fn func(cid uint64, cname string, count, size, retained int64) error) error {
+	// retained size 只针对可达对象
+	retained := map[classKey]int64{}
+	var err error
+	if reachability != storage.UnreachableObjects {
+		err = i.storage.ListClassRetained(func(typ int, cid uint64, size int64) error {
+			retained[classKey{typ, cid}] = size
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = i.storage.CountInstancesByClass(reachability, func(cid uint64, count, size int64) error {
 		name := i.GetClassNameById(cid, "unkonwn")
-		return fn(cid, name, count, size)
+		return fn(cid, name, count, size, retained[classKey{hprof.HProfHDRecordTypeInstanceDump, cid}])
 	})
 	if err != nil {
 		return err
 	}
-	err = i.storage.CountObjectArrayByClass(func(cid uint64, count, size int64) error {
+	err = i.storage.CountObjectArrayByClass(reachability, func(cid uint64, count, size int64) error {
 		name := i.GetClassNameById(cid, "unkonwn")
-		return fn(cid, name, count, size)
+		return fn(cid, name, count, size, retained[classKey{hprof.HProfHDRecordTypeObjectArrayDump, cid}])
 	})
 	if err != nil {
 		return err
 	}
-	return i.storage.CountPrimitiveArrayByType(func(ty uint64, count, size int64) error {
+	return i.storage.CountPrimitiveArrayByType(reachability, func(ty uint64, count, size int64) error {
 		name := PRIMITIVE_TYPE_ARRAY[ty]
-		return fn(ty, name, count, size)
+		return fn(ty, name, count, size, retained[classKey{hprof.HProfHDRecordTypePrimitiveArrayDump, ty}])
 	})
 }
 
-func (i *Indexer) AppendReference(from, to uint64, typ int) error {
-	return i.storage.AppendReference(from, to, typ)
+func (i *Indexer) AppendReference(from, to uint64, typ int, strength model.ReferenceStrength) error {
+	return i.storage.AppendReference(from, to, typ, int(strength))
 }
 
 func (i *Indexer) GetInstanceDetail(oid uint64) (*Instance, error) {
@@ -267,13 +343,16 @@ func (i *Indexer) GetInstanceDetail(oid uint64) (*Instance, error) {
 			return nil, err
 		}
 		var refrence *Instance = nil
+		var objectId uint64
 		if field.Type == hprof.HProfValueType_OBJECT {
-			refrence, err = i.GetInstanceDetail(fiedValues[idx].(*hprof.HProfInstanceObjectValue).Value)
+			objectId = fiedValues[idx].(*hprof.HProfInstanceObjectValue).Value
+			refrence, err = i.GetInstanceDetail(objectId)
 		}
 		fields = append(fields, &InstanceField{
 			Name:      name,
 			Type:      hprof.HProfValueType_name[field.Type],
 			Value:     fiedValues[idx].ValueString(),
+			ObjectId:  objectId,
 			Reference: refrence,
 		})
 	}
@@ -286,25 +365,40 @@ func (i *Indexer) GetInstanceDetail(oid uint64) (*Instance, error) {
 	return instance, nil
 }
 
-func (i *Indexer) GetInstancesStatistics(cid uint64, typ int, fn func(id uint64, size int64) error) error {
+func (i *Indexer) GetInstancesStatistics(cid uint64, typ int, reachability storage.Reachability, fn func(id uint64, size, retained int64) error) error {
 	if typ == hprof.HProfHDRecordTypeObjectArrayDump {
-		return i.storage.ListObjectArrayByClass(cid, func(id uint64, pos, size int64) error {
-			return fn(id, size)
+		return i.storage.ListObjectArrayByClass(cid, reachability, func(id uint64, pos, size, retained int64) error {
+			return fn(id, size, retained)
 		})
 	}
 	if typ == hprof.HProfHDRecordTypePrimitiveArrayDump {
-		return i.storage.ListPrimitiveArrayByClass(cid, func(id uint64, pos, size int64) error {
-			return fn(id, size)
+		return i.storage.ListPrimitiveArrayByClass(cid, reachability, func(id uint64, pos, size, retained int64) error {
+			return fn(id, size, retained)
 		})
 	}
-	return i.storage.ListInstancesByClass(cid, func(id uint64, pos, size int64) error {
-		return fn(id, size)
+	return i.storage.ListInstancesByClass(cid, reachability, func(id uint64, pos, size, retained int64) error {
+		return fn(id, size, retained)
 	})
 }
 
+// GetDominator 获取对象的直接支配者和 retained size
+func (i *Indexer) GetDominator(id uint64) (uint64, int64, error) {
+	return i.storage.GetDominator(id)
+}
+
+// GetObjectSize 获取对象的 shallow size
+func (i *Indexer) GetObjectSize(id uint64) (int64, error) {
+	return i.storage.GetObjectSize(id)
+}
+
+// ListDominated 列出被 id 直接支配的对象，id 为 0 时列出被 GC root 直接支配的对象
+func (i *Indexer) ListDominated(id uint64, fn func(id uint64, retained int64) error) error {
+	return i.storage.ListDominated(id, fn)
+}
+
 // GetRecordInbounds 列出当前 record 的来源 reference
 func (i *Indexer) GetRecordInbounds(id uint64, fn func(record hprof.HProfRecord) error) error {
-	return i.storage.ListInboundReferences(id, func(from uint64, typ int) error {
+	return i.storage.ListInboundReferences(id, func(from uint64, typ, strength int) error {
 		record, err := i.getRecord(from)
 		if err != nil {
 			return err
@@ -315,7 +409,7 @@ func (i *Indexer) GetRecordInbounds(id uint64, fn func(record hprof.HProfRecord)
 
 // GetRecordOutbounds 列出当前 record 的来源 reference
 func (i *Indexer) GetRecordOutbounds(id uint64, fn func(record hprof.HProfRecord) error) error {
-	return i.storage.ListOutboundReferences(id, func(to uint64, typ int) error {
+	return i.storage.ListOutboundReferences(id, func(to uint64, typ, strength int) error {
 		record, err := i.getRecord(to)
 		if err != nil {
 			return err
@@ -329,7 +423,11 @@ func (i *Indexer) getInstance(oid uint64) (*hprof.HProfInstanceRecord, error) {
 	if err != nil {
 		return nil, err
 	}
-	return hprof.ReadHProfInstanceRecordWithPos(i.hreader, pos)
+	record, err := hprof.ReadHProfInstanceRecordWithPos(i.hreader, pos)
+	if err != nil {
+		return nil, storage.NewCorruptRecordError(oid, pos, err)
+	}
+	return record, nil
 }
 
 func (i *Indexer) getRecord(id uint64) (hprof.HProfRecord, error) {
@@ -340,18 +438,23 @@ func (i *Indexer) getRecord(id uint64) (hprof.HProfRecord, error) {
 	if cla != nil {
 		return cla, nil
 	}
+	var record hprof.HProfRecord
 	switch typ {
 	case hprof.HProfHDRecordTypeClassDump:
-		return hprof.ReadHProfClassRecordWithPos(i.hreader, pos)
+		record, err = hprof.ReadHProfClassRecordWithPos(i.hreader, pos)
 	case hprof.HProfHDRecordTypeInstanceDump:
-		return hprof.ReadHProfInstanceRecordWithPos(i.hreader, pos)
+		record, err = hprof.ReadHProfInstanceRecordWithPos(i.hreader, pos)
 	case hprof.HProfHDRecordTypeObjectArrayDump:
-		return hprof.ReadHProfObjectArrayRecordWithPos(i.hreader, pos)
+		record, err = hprof.ReadHProfObjectArrayRecordWithPos(i.hreader, pos)
 	case hprof.HProfHDRecordTypePrimitiveArrayDump:
-		return hprof.ReadHProfPrimitiveArrayRecordWithPos(i.hreader, pos)
+		record, err = hprof.ReadHProfPrimitiveArrayRecordWithPos(i.hreader, pos)
 	default:
-		return nil, fmt.Errorf("unknown record type: %d", typ)
+		return nil, storage.NewUnsupportedRecordError(typ, id, pos)
+	}
+	if err != nil {
+		return nil, storage.NewCorruptRecordError(id, pos, err)
 	}
+	return record, nil
 }
 
 func (i *Indexer) resolveClassHierarchy(class *hprof.HProfClassRecord) ([]*hprof.HProfClassRecord, error) {
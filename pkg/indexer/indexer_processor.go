@@ -6,12 +6,16 @@ type IndexerProcessor interface {
 
 func (i *Indexer) Processor() error {
 	var processors []IndexerProcessor
+	processors = append(processors, newShallowSizeProcessor(i))
 	processors = append(processors, newCreateClassIndexesProcessor(i))
 	processors = append(processors, newCreateFakeClassesProcessor(i))
 	processors = append(processors, newThreadTracesProcessor(i))
 	processors = append(processors, newGCRootProcessor(i))
 	processors = append(processors, newClassReferencesProcessor(i))
 	processors = append(processors, newInstanceReferencesProcessor(i))
+	processors = append(processors, newObjectArrayReferencesProcessor(i))
+	processors = append(processors, newReachabilityProcessor(i))
+	processors = append(processors, newDominatorTreeProcessor(i))
 
 	for _, processor := range processors {
 		err := processor.process()
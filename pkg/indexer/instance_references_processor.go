@@ -1,8 +1,12 @@
 package indexer
 
-import "hprof-tool/pkg/hprof"
+import (
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+)
 
 // InstanceReferencesProcessor 计算 instance 的 references
+// java.lang.ref.Reference 子类的 referent 字段记录为对应强度的引用
 type InstanceReferencesProcessor struct {
 	i *Indexer
 }
@@ -14,18 +18,18 @@ func newInstanceReferencesProcessor(i *Indexer) *InstanceReferencesProcessor {
 func (p *InstanceReferencesProcessor) process() error {
 	println("InstanceReferencesProcessor start")
 	return p.i.ForEachInstanceRecords(func(record *hprof.HProfInstanceRecord) error {
-		references, err := p.getReferences(record)
+		references, strengths, err := p.getReferences(record)
 		if err != nil {
 			return err
 		}
 		p.i.ctx.instanceReferences[record.ObjectId] = references
-		return p.saveReferences(record.ObjectId, references)
+		return p.saveReferences(record.ObjectId, references, strengths)
 	})
 }
 
-func (p *InstanceReferencesProcessor) saveReferences(rid uint64, references []uint64) error {
-	for _, ref := range references {
-		err := p.i.AppendReference(rid, ref, hprof.HProfHDRecordTypeInstanceDump)
+func (p *InstanceReferencesProcessor) saveReferences(rid uint64, references []uint64, strengths []model.ReferenceStrength) error {
+	for idx, ref := range references {
+		err := p.i.AppendReference(rid, ref, hprof.HProfHDRecordTypeInstanceDump, strengths[idx])
 		if err != nil {
 			return err
 		}
@@ -33,17 +37,24 @@ func (p *InstanceReferencesProcessor) saveReferences(rid uint64, references []ui
 	return nil
 }
 
-func (p *InstanceReferencesProcessor) getReferences(instance *hprof.HProfInstanceRecord) ([]uint64, error) {
+// getReferences 返回 instance 引用的对象和每个引用的强度
+func (p *InstanceReferencesProcessor) getReferences(instance *hprof.HProfInstanceRecord) ([]uint64, []model.ReferenceStrength, error) {
 	references := []uint64{}
 	references = append(references, instance.ClassObjectId)
+	strengths := []model.ReferenceStrength{model.ReferenceStrong}
+
+	classStrength, err := p.i.getClassReferenceStrength(instance.ClassObjectId)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	class, err := p.i.getClassById(instance.ClassObjectId)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	classes, err := p.resolveClassHierarchy(class)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	instanceFields := []*hprof.HProfClass_InstanceField{}
 	for _, class := range classes {
@@ -52,17 +63,28 @@ func (p *InstanceReferencesProcessor) getReferences(instance *hprof.HProfInstanc
 
 	fiedValues, err := instance.ReadValues(instanceFields)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	for _, fiedValue := range fiedValues {
+	for idx, fiedValue := range fiedValues {
 		if fiedValue.ValueType() == hprof.HProfValueType_OBJECT {
 			objectValue := fiedValue.(*hprof.HProfInstanceObjectValue)
+			strength := model.ReferenceStrong
+			if classStrength != model.ReferenceStrong {
+				name, err := p.i.GetText(instanceFields[idx].NameId)
+				if err != nil {
+					return nil, nil, err
+				}
+				if name == "referent" {
+					strength = classStrength
+				}
+			}
 			references = append(references, objectValue.Value)
+			strengths = append(strengths, strength)
 		}
 	}
 
-	return references, nil
+	return references, strengths, nil
 }
 
 func (p *InstanceReferencesProcessor) resolveClassHierarchy(class *hprof.HProfClassRecord) ([]*hprof.HProfClassRecord, error) {
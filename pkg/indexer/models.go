@@ -1,14 +1,19 @@
 package indexer
 
 type Instance struct {
-	Id     uint64           `json:"id"`
-	Class  string           `json:"class"`
-	Fields []*InstanceField `json:"fields"`
+	Id      uint64           `json:"id"`
+	Class   string           `json:"class"`
+	Display string           `json:"display,omitempty"`
+	Fields  []*InstanceField `json:"fields"`
 }
 
 type InstanceField struct {
-	Name      string    `json:"name"`
-	Type      string    `json:"type"`
-	Value     string    `json:"value"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// 引用字段指向的对象 id，null 为 0
+	ObjectId uint64 `json:"objectId,omitempty"`
+	// 引用字段指向的对象便于阅读的值
+	Display   string    `json:"display,omitempty"`
 	Reference *Instance `json:"reference"`
 }
@@ -0,0 +1,43 @@
+package indexer
+
+import (
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+)
+
+// ObjectArrayReferencesProcessor 计算 object array 的 references
+// 包括数组的 class 和所有非 null 元素
+type ObjectArrayReferencesProcessor struct {
+	i *Indexer
+}
+
+func newObjectArrayReferencesProcessor(i *Indexer) *ObjectArrayReferencesProcessor {
+	return &ObjectArrayReferencesProcessor{i}
+}
+
+func (p *ObjectArrayReferencesProcessor) process() error {
+	println("ObjectArrayReferencesProcessor start")
+	return p.i.ForEachObjectArrayRecords(func(record *hprof.HProfObjectArrayRecord) error {
+		return p.saveReferences(record.ArrayObjectId, p.getReferences(record))
+	})
+}
+
+func (p *ObjectArrayReferencesProcessor) saveReferences(rid uint64, references []uint64) error {
+	for _, ref := range references {
+		err := p.i.AppendReference(rid, ref, hprof.HProfHDRecordTypeObjectArrayDump, model.ReferenceStrong)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ObjectArrayReferencesProcessor) getReferences(array *hprof.HProfObjectArrayRecord) []uint64 {
+	references := []uint64{array.ArrayClassObjectId}
+	for _, eid := range array.ElementObjectIds {
+		if eid != 0 {
+			references = append(references, eid)
+		}
+	}
+	return references
+}
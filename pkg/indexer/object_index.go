@@ -0,0 +1,22 @@
+package indexer
+
+import "sort"
+
+const noneNode int32 = -1
+
+// objectIndex 按 id 排序的所有对象，用下标作为节点编号
+// 相比 map 更节省内存
+type objectIndex struct {
+	ids []uint64
+}
+
+// nodeOf 二分查找对象 id 对应的节点，不存在时返回 noneNode
+func (o *objectIndex) nodeOf(id uint64) int32 {
+	idx := sort.Search(len(o.ids), func(k int) bool {
+		return o.ids[k] >= id
+	})
+	if idx < len(o.ids) && o.ids[idx] == id {
+		return int32(idx)
+	}
+	return noneNode
+}
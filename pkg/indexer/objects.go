@@ -0,0 +1,170 @@
+package indexer
+
+import (
+	"fmt"
+	"hprof-tool/pkg/hprof"
+)
+
+// ReadInstanceFields 读取 instance 的类 id 和按字段名索引的字段值
+func (i *Indexer) ReadInstanceFields(id uint64) (uint64, map[string]hprof.HProfInstanceFieldValue, error) {
+	instance, err := i.getInstance(id)
+	if err != nil {
+		return 0, nil, err
+	}
+	fields, err := i.readInstanceFieldsByName(instance)
+	if err != nil {
+		return 0, nil, err
+	}
+	return instance.ClassObjectId, fields, nil
+}
+
+// GetObjectArrayElements 返回 object array 的元素，null 元素为 0
+func (i *Indexer) GetObjectArrayElements(id uint64) ([]uint64, error) {
+	record, err := i.getRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := record.(*hprof.HProfObjectArrayRecord)
+	if !ok {
+		return nil, fmt.Errorf("%d is not an object array", id)
+	}
+	return array.ElementObjectIds, nil
+}
+
+// GetPrimitiveArray 返回 primitive array record
+func (i *Indexer) GetPrimitiveArray(id uint64) (*hprof.HProfPrimitiveArrayRecord, error) {
+	record, err := i.getRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := record.(*hprof.HProfPrimitiveArrayRecord)
+	if !ok {
+		return nil, fmt.Errorf("%d is not a primitive array", id)
+	}
+	return array, nil
+}
+
+// GetSuperClassNames 返回类自身和所有父类的名称，从子类到父类排列
+func (i *Indexer) GetSuperClassNames(cid uint64) ([]string, error) {
+	class, err := i.getClassById(cid)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := i.resolveClassHierarchy(class)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(classes))
+	for _, c := range classes {
+		names = append(names, i.GetClassNameById(c.ClassObjectId, "unknown"))
+	}
+	return names, nil
+}
+
+// StaticField class 的静态字段，基本类型的 Value 是按大端序读出的原始位，比如 int 需要转换成 int32(Value)
+type StaticField struct {
+	Name  string
+	Type  hprof.HProfValueType
+	Value uint64
+}
+
+// GetStaticFields 返回 class 自身声明的静态字段
+func (i *Indexer) GetStaticFields(cid uint64) ([]*StaticField, error) {
+	class, err := i.getClassById(cid)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*StaticField, 0, len(class.StaticFields))
+	for _, sf := range class.StaticFields {
+		name, err := i.GetText(sf.NameId)
+		if err != nil {
+			return nil, err
+		}
+		// reader 把不足 8 字节的值读在高位，这里移到低位
+		size := hprof.ValueSize[sf.Type]
+		if size == -1 {
+			size = int(i.hreader.IdSize())
+		}
+		result = append(result, &StaticField{Name: name, Type: sf.Type, Value: sf.Value >> (64 - 8*size)})
+	}
+	return result, nil
+}
+
+// GetClassIdByName 根据类名返回 class id，类不存在时返回 0
+func (i *Indexer) GetClassIdByName(name string) uint64 {
+	return i.getClassIdByName(name, 0)
+}
+
+// GetObjectClassId 返回 instance 或 object array 的类 id，primitive array 和 class 对象返回 0
+func (i *Indexer) GetObjectClassId(id uint64) (uint64, error) {
+	record, err := i.getRecord(id)
+	if err != nil {
+		return 0, err
+	}
+	switch r := record.(type) {
+	case *hprof.HProfInstanceRecord:
+		return r.ClassObjectId, nil
+	case *hprof.HProfObjectArrayRecord:
+		return r.ArrayClassObjectId, nil
+	}
+	return 0, nil
+}
+
+// GetClassLoaderId 返回加载 class 的 ClassLoader 对象 id，bootstrap ClassLoader 返回 0
+func (i *Indexer) GetClassLoaderId(cid uint64) (uint64, error) {
+	class, err := i.getClassById(cid)
+	if err != nil {
+		return 0, err
+	}
+	return class.ClassLoaderObjectId, nil
+}
+
+// GetSuperClassId 返回父类的 class id，java.lang.Object 返回 0
+func (i *Indexer) GetSuperClassId(cid uint64) (uint64, error) {
+	class, err := i.getClassById(cid)
+	if err != nil {
+		return 0, err
+	}
+	return class.SuperClassObjectId, nil
+}
+
+// ReadDeclaredFields 读取 instance 中由 className 声明的字段，用于读取被子类同名字段遮住的父类字段
+func (i *Indexer) ReadDeclaredFields(id uint64, className string) (map[string]hprof.HProfInstanceFieldValue, error) {
+	instance, err := i.getInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	class, err := i.getClassById(instance.ClassObjectId)
+	if err != nil {
+		return nil, err
+	}
+	classes, err := i.resolveClassHierarchy(class)
+	if err != nil {
+		return nil, err
+	}
+	fields := []*hprof.HProfClass_InstanceField{}
+	start, end := -1, -1
+	for _, c := range classes {
+		if start < 0 && i.GetClassNameById(c.ClassObjectId, "") == className {
+			start = len(fields)
+			end = start + len(c.InstanceFields)
+		}
+		fields = append(fields, c.InstanceFields...)
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("%d is not an instance of %s", id, className)
+	}
+	values, err := instance.ReadValues(fields)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]hprof.HProfInstanceFieldValue, end-start)
+	for idx := start; idx < end; idx++ {
+		name, err := i.GetText(fields[idx].NameId)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = values[idx]
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package indexer
+
+import "hprof-tool/pkg/model"
+
+// ReachabilityProcessor 标记所有从 GC roots 可达的对象
+// 只跟随 reachabilityStrengths 中的引用，并记录每个对象可达的引用强度：
+// 按 ReferenceStrengthsByReachability 的顺序逐级放开更弱的引用，对象的强度是第一次到达它时的级别
+type ReachabilityProcessor struct {
+	i *Indexer
+
+	objectIndex
+}
+
+func newReachabilityProcessor(i *Indexer) *ReachabilityProcessor {
+	return &ReachabilityProcessor{i: i}
+}
+
+func (p *ReachabilityProcessor) process() error {
+	println("ReachabilityProcessor start")
+	err := p.i.storage.ListRecords(func(id uint64, typ int, cid uint64, size int64) error {
+		p.ids = append(p.ids, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// levels[v] 是对象可达的级别加 1，0 表示还没有到达
+	levels := make([]int8, len(p.ids))
+	levelOf := map[model.ReferenceStrength]int{}
+	for level, strength := range model.ReferenceStrengthsByReachability {
+		if strength == model.ReferenceStrong || model.ContainsReferenceStrength(p.i.reachabilityStrengths, strength) {
+			levelOf[strength] = level
+		}
+	}
+	// deferred 保存遇到的更弱的引用，到对应级别时再跟随
+	deferred := make([][]int32, len(model.ReferenceStrengthsByReachability))
+	for id := range p.i.ctx.gcRoots {
+		if v := p.nodeOf(id); v != noneNode {
+			deferred[0] = append(deferred[0], v)
+		}
+	}
+	for level := range model.ReferenceStrengthsByReachability {
+		var queue []int32
+		for _, v := range deferred[level] {
+			if levels[v] == 0 {
+				levels[v] = int8(level + 1)
+				queue = append(queue, v)
+			}
+		}
+		deferred[level] = nil
+		for len(queue) > 0 {
+			v := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			err = p.i.storage.ListOutboundReferences(p.ids[v], func(to uint64, typ, strength int) error {
+				w := p.nodeOf(to)
+				if w == noneNode || levels[w] != 0 {
+					return nil
+				}
+				l, followed := levelOf[model.ReferenceStrength(strength)]
+				if !followed {
+					return nil
+				}
+				if l > level {
+					deferred[l] = append(deferred[l], w)
+					return nil
+				}
+				levels[w] = int8(level + 1)
+				queue = append(queue, w)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for v, level := range levels {
+		if level == 0 {
+			continue
+		}
+		strength := model.ReferenceStrengthsByReachability[level-1]
+		err = p.i.storage.SetReachable(p.ids[v], int(strength))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package indexer
+
+import (
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+	"sort"
+)
+
+// GetGCRoots 返回对象作为 GC root 的信息，不是 GC root 时返回 nil
+func (i *Indexer) GetGCRoots(id uint64) []*model.GCRootInfo {
+	return i.ctx.gcRoots[id]
+}
+
+// ListGCRootIds 返回所有 typ 类型的 GC root 对象 id，按 id 排序
+func (i *Indexer) ListGCRootIds(typ int) []uint64 {
+	var result []uint64
+	for id, roots := range i.ctx.gcRoots {
+		for _, r := range roots {
+			if r.Typ == typ {
+				result = append(result, id)
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a] < result[b] })
+	return result
+}
+
+// ListAllGCRootIds 返回所有 GC root 对象 id，按 id 排序
+func (i *Indexer) ListAllGCRootIds() []uint64 {
+	result := make([]uint64, 0, len(i.ctx.gcRoots))
+	for id := range i.ctx.gcRoots {
+		result = append(result, id)
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a] < result[b] })
+	return result
+}
+
+// ListInboundReferences 列出指向当前对象的对象 id、引用类型和引用强度
+func (i *Indexer) ListInboundReferences(id uint64, fn func(from uint64, typ int, strength model.ReferenceStrength) error) error {
+	return i.storage.ListInboundReferences(id, func(from uint64, typ, strength int) error {
+		return fn(from, typ, model.ReferenceStrength(strength))
+	})
+}
+
+// ListOutboundReferences 列出当前对象指向的对象 id、引用类型和引用强度
+func (i *Indexer) ListOutboundReferences(id uint64, fn func(to uint64, typ int, strength model.ReferenceStrength) error) error {
+	return i.storage.ListOutboundReferences(id, func(to uint64, typ, strength int) error {
+		return fn(to, typ, model.ReferenceStrength(strength))
+	})
+}
+
+// GetReachability 返回对象是否从 GC roots 可达和可达的引用强度
+func (i *Indexer) GetReachability(id uint64) (bool, model.ReferenceStrength, error) {
+	reachable, strength, err := i.storage.GetReachability(id)
+	return reachable, model.ReferenceStrength(strength), err
+}
+
+// ListWeaklyReachable 列出只能通过 Reference.referent 可达的对象，strength 是对象可达的引用强度
+func (i *Indexer) ListWeaklyReachable(fn func(id uint64, class string, size int64, strength model.ReferenceStrength) error) error {
+	return i.storage.ListWeaklyReachable(func(id uint64, typ int, cid uint64, size int64, strength int) error {
+		var class string
+		switch typ {
+		case hprof.HProfHDRecordTypeClassDump:
+			class = "class " + i.GetClassNameById(id, "unknown")
+		case hprof.HProfHDRecordTypePrimitiveArrayDump:
+			class = PRIMITIVE_TYPE_ARRAY[cid]
+		default:
+			class = i.GetClassNameById(cid, "unknown")
+		}
+		return fn(id, class, size, model.ReferenceStrength(strength))
+	})
+}
+
+// GetObjectClassName 返回对象的类名，class 对象返回 "class xxx"
+func (i *Indexer) GetObjectClassName(id uint64) (string, error) {
+	record, err := i.getRecord(id)
+	if err != nil {
+		return "", err
+	}
+	switch r := record.(type) {
+	case *hprof.HProfClassRecord:
+		return "class " + i.GetClassNameById(r.ClassObjectId, "unknown"), nil
+	case *hprof.HProfInstanceRecord:
+		return i.GetClassNameById(r.ClassObjectId, "unknown"), nil
+	case *hprof.HProfObjectArrayRecord:
+		return i.GetClassNameById(r.ArrayClassObjectId, "unknown"), nil
+	case *hprof.HProfPrimitiveArrayRecord:
+		return PRIMITIVE_TYPE_ARRAY[r.ElementType], nil
+	}
+	return "", fmt.Errorf("unknown record: %#v", record)
+}
+
+// GetReferenceFieldNames 返回 from 中指向 to 的字段名
+// 数组元素用 "[index]" 表示，class 相关的引用用 "<class>"、"<super>" 这类名称
+func (i *Indexer) GetReferenceFieldNames(from, to uint64) ([]string, error) {
+	record, err := i.getRecord(from)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	switch r := record.(type) {
+	case *hprof.HProfClassRecord:
+		if r.SuperClassObjectId == to {
+			names = append(names, "<super>")
+		}
+		if r.ClassLoaderObjectId == to {
+			names = append(names, "<classloader>")
+		}
+		for _, sf := range r.StaticFields {
+			if sf.Type != hprof.HProfValueType_OBJECT || sf.Value != to {
+				continue
+			}
+			name, err := i.GetText(sf.NameId)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, "static "+name)
+		}
+		if len(names) == 0 && i.getClassIdByName("java.lang.Class", 0) == to {
+			names = append(names, "<class>")
+		}
+	case *hprof.HProfInstanceRecord:
+		if r.ClassObjectId == to {
+			names = append(names, "<class>")
+		}
+		fields, values, err := i.readInstanceFields(r)
+		if err != nil {
+			return nil, err
+		}
+		for idx, field := range fields {
+			if field.Type != hprof.HProfValueType_OBJECT || values[idx].(*hprof.HProfInstanceObjectValue).Value != to {
+				continue
+			}
+			name, err := i.GetText(field.NameId)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+	case *hprof.HProfObjectArrayRecord:
+		if r.ArrayClassObjectId == to {
+			names = append(names, "<class>")
+		}
+		for idx, eid := range r.ElementObjectIds {
+			if eid == to {
+				names = append(names, fmt.Sprintf("[%d]", idx))
+			}
+		}
+	}
+	return names, nil
+}
+
+// GetReferenceStrength 返回 from 指向 to 的引用强度，有多个引用时返回强引用
+// 只有 java.lang.ref.Reference 子类的 referent 字段不是强引用
+func (i *Indexer) GetReferenceStrength(from, to uint64) (model.ReferenceStrength, error) {
+	result := model.ReferenceStrong
+	found := false
+	err := i.ListOutboundReferences(from, func(t uint64, typ int, strength model.ReferenceStrength) error {
+		if t != to {
+			return nil
+		}
+		if !found || strength == model.ReferenceStrong {
+			result = strength
+		}
+		found = true
+		return nil
+	})
+	return result, err
+}
+
+// getClassReferenceStrength 根据类继承关系判断是哪种 Reference
+func (i *Indexer) getClassReferenceStrength(cid uint64) (model.ReferenceStrength, error) {
+	if strength, exist := i.ctx.classReferenceStrengths[cid]; exist {
+		return strength, nil
+	}
+	strength := model.ReferenceStrong
+	for c := cid; c != 0; {
+		if s, exist := model.ReferenceClassNames[i.GetClassNameById(c, "")]; exist {
+			strength = s
+			break
+		}
+		class, err := i.getClassById(c)
+		if err != nil {
+			return model.ReferenceStrong, err
+		}
+		c = class.SuperClassObjectId
+	}
+	i.ctx.classReferenceStrengths[cid] = strength
+	return strength, nil
+}
+
+// GetThreadName 根据线程对象 id 返回 START THREAD 记录中的线程名
+// jmap 生成的文件没有 START THREAD 记录，返回空，需要从线程对象的 name 字段读取
+func (i *Indexer) GetThreadName(threadObjectId uint64) (string, error) {
+	if i.ctx.threadObject2NameId == nil {
+		i.ctx.threadObject2NameId = map[uint64]uint64{}
+		for _, t := range i.ctx.threadSN2thread {
+			i.ctx.threadObject2NameId[t.ObjectId] = t.NameId
+		}
+	}
+	nameId, exist := i.ctx.threadObject2NameId[threadObjectId]
+	if !exist {
+		return "", nil
+	}
+	return i.GetText(nameId)
+}
+
+// readInstanceFields 读取 instance 包括父类在内的所有字段和值
+func (i *Indexer) readInstanceFields(instance *hprof.HProfInstanceRecord) ([]*hprof.HProfClass_InstanceField, []hprof.HProfInstanceFieldValue, error) {
+	class, err := i.getClassById(instance.ClassObjectId)
+	if err != nil {
+		return nil, nil, err
+	}
+	classes, err := i.resolveClassHierarchy(class)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := []*hprof.HProfClass_InstanceField{}
+	for _, class := range classes {
+		fields = append(fields, class.InstanceFields...)
+	}
+	values, err := instance.ReadValues(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fields, values, nil
+}
@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"fmt"
+	"hprof-tool/pkg/hprof"
+)
+
+// ShallowSizeProcessor 按 ObjectLayout 计算对象的 shallow size
+// 建索引时 instance 记录的是字段字节数，数组记录的是元素个数
+type ShallowSizeProcessor struct {
+	i *Indexer
+}
+
+func newShallowSizeProcessor(i *Indexer) *ShallowSizeProcessor {
+	return &ShallowSizeProcessor{i}
+}
+
+func (p *ShallowSizeProcessor) process() error {
+	println("ShallowSizeProcessor start")
+	if p.i.layout == nil {
+		p.i.layout = hprof.DetectObjectLayout(int(p.i.hreader.IdSize()), p.i.ctx.maxObjectId)
+	}
+	layout := p.i.layout
+	fmt.Printf("Object layout: %s\n", layout)
+
+	// 遍历 class 时不能同时更新 hprof_records，先记录下来
+	instanceSizes := map[uint64]int64{}
+	err := p.i.ForEachClassRecords(func(record *hprof.HProfClassRecord) error {
+		classes, err := p.i.resolveClassHierarchy(record)
+		if err != nil {
+			return err
+		}
+		var fields []*hprof.HProfClass_InstanceField
+		for _, class := range classes {
+			fields = append(fields, class.InstanceFields...)
+		}
+		instanceSizes[record.ClassObjectId] = layout.InstanceSize(fields)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for cid, size := range instanceSizes {
+		err = p.i.storage.UpdateInstanceSizes(cid, size)
+		if err != nil {
+			return err
+		}
+	}
+
+	refSize := layout.ReferenceSize()
+	err = p.i.storage.UpdateObjectArraySizes(layout.ArrayHeaderSize(refSize), refSize, layout.ObjectAlignment)
+	if err != nil {
+		return err
+	}
+	for ty := hprof.HProfValueType_BOOLEAN; ty <= hprof.HProfValueType_LONG; ty++ {
+		elementSize := layout.ValueSize(ty)
+		err = p.i.storage.UpdatePrimitiveArraySizes(uint64(ty), layout.ArrayHeaderSize(elementSize), elementSize, layout.ObjectAlignment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"unicode/utf16"
+)
+
+const stringClassName = "java.lang.String"
+
+// JDK 9+ String.coder 的取值
+const (
+	stringCoderLatin1 = 0
+	stringCoderUTF16  = 1
+)
+
+// ErrStringValue String 的 value 不是 char[] 或 byte[]，无法读取内容
+var ErrStringValue = errors.New("invalid java.lang.String value")
+
+// StringValue java.lang.String 对象的内容
+type StringValue struct {
+	Value string
+	// value 字段指向的数组，为 0 表示 value 为 null
+	ArrayId uint64
+	// value 数组的 shallow size
+	ArraySize int64
+}
+
+// GetStringClassIds 返回所有 java.lang.String 类的 id，不同 ClassLoader 可能加载多次
+func (i *Indexer) GetStringClassIds() []uint64 {
+	return i.ctx.className2Cid[stringClassName]
+}
+
+// ReadString 读取 String 对象的内容
+// JDK 8 的 value 是 char[]，JDK 9+ 的 value 是 byte[]，由 coder 决定编码
+func (i *Indexer) ReadString(id uint64) (*StringValue, error) {
+	instance, err := i.getInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := i.readInstanceFieldsByName(instance)
+	if err != nil {
+		return nil, err
+	}
+	valueField, ok := fields["value"].(*hprof.HProfInstanceObjectValue)
+	if !ok {
+		return nil, fmt.Errorf("%d is not a java.lang.String", id)
+	}
+	result := &StringValue{ArrayId: valueField.Value}
+	if result.ArrayId == 0 {
+		return result, nil
+	}
+	record, err := i.getRecord(result.ArrayId)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := record.(*hprof.HProfPrimitiveArrayRecord)
+	if !ok {
+		return nil, fmt.Errorf("%w: value of %d is not a primitive array", ErrStringValue, id)
+	}
+	n := len(array.Values) / hprof.ValueSize[array.ElementType]
+	result.ArraySize = i.layout.ArraySize(array.ElementType, n)
+
+	switch array.ElementType {
+	case hprof.HProfValueType_CHAR:
+		chars := decodeChars(array.Values, binary.BigEndian)
+		// JDK 7u6 之前的 String 通过 offset 和 count 共享 char[]
+		if offset, ok := fields["offset"].(*hprof.HProfInstanceIntValue); ok {
+			if count, ok := fields["count"].(*hprof.HProfInstanceIntValue); ok {
+				start, end := int(offset.Value), int(offset.Value)+int(count.Value)
+				if start >= 0 && end <= len(chars) && start <= end {
+					chars = chars[start:end]
+				}
+			}
+		}
+		result.Value = string(utf16.Decode(chars))
+	case hprof.HProfValueType_BYTE:
+		coder := byte(stringCoderLatin1)
+		if c, ok := fields["coder"].(*hprof.HProfInstanceByteValue); ok {
+			coder = c.Value
+		}
+		if coder == stringCoderUTF16 {
+			// byte[] 原样写入 hprof，UTF16 使用 JVM 的本地字节序，这里按 little endian 处理
+			result.Value = string(utf16.Decode(decodeChars(array.Values, binary.LittleEndian)))
+		} else {
+			runes := make([]rune, len(array.Values))
+			for idx, b := range array.Values {
+				runes[idx] = rune(b)
+			}
+			result.Value = string(runes)
+		}
+	default:
+		return nil, fmt.Errorf("%w: value of %d is %s", ErrStringValue, id, PRIMITIVE_TYPE_ARRAY[array.ElementType])
+	}
+	return result, nil
+}
+
+// ReadCharArray 读取 char[] 的内容
+func (i *Indexer) ReadCharArray(id uint64) (string, error) {
+	array, err := i.GetPrimitiveArray(id)
+	if err != nil {
+		return "", err
+	}
+	if array.ElementType != hprof.HProfValueType_CHAR {
+		return "", fmt.Errorf("%d is not a char[]", id)
+	}
+	return string(utf16.Decode(decodeChars(array.Values, binary.BigEndian))), nil
+}
+
+func decodeChars(values []byte, order binary.ByteOrder) []uint16 {
+	chars := make([]uint16, len(values)/2)
+	for idx := range chars {
+		chars[idx] = order.Uint16(values[idx*2:])
+	}
+	return chars
+}
+
+// readInstanceFieldsByName 按字段名返回 instance 的字段值，子类和父类有同名字段时使用子类的
+func (i *Indexer) readInstanceFieldsByName(instance *hprof.HProfInstanceRecord) (map[string]hprof.HProfInstanceFieldValue, error) {
+	fields, values, err := i.readInstanceFields(instance)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]hprof.HProfInstanceFieldValue, len(fields))
+	for idx, field := range fields {
+		name, err := i.GetText(field.NameId)
+		if err != nil {
+			return nil, err
+		}
+		if _, exist := result[name]; !exist {
+			result[name] = values[idx]
+		}
+	}
+	return result, nil
+}
@@ -1,7 +1,6 @@
 package indexer
 
 import (
-	"fmt"
 	"hprof-tool/pkg/hprof"
 	"hprof-tool/pkg/model"
 )
@@ -41,7 +40,6 @@ func (p *ThreadTracesProcessor) process() error {
 		return err
 	}
 	return p.i.ForEachThreads(func(r *hprof.HProfThreadRecord) error {
-		fmt.Printf("Thread ThreadSerialNumber = %d\n", r.ThreadSerialNumber)
 		p.i.ctx.threadSN2thread[r.ThreadSerialNumber] = &thread{
 			ObjectId:          r.ThreadObjectId,
 			NameId:            r.ThreadNameId,
@@ -16,6 +16,31 @@ const (
 	GCRootType_JAVA_STACK_FRAME = 1 << 12
 )
 
+var gcRootTypeNames = map[int]string{
+	GCRootType_UNKNOWN:          "Unknown",
+	GCRootType_SYSTEM_CLASS:     "System Class",
+	GCRootType_NATIVE_LOCAL:     "JNI Local",
+	GCRootType_NATIVE_STATIC:    "JNI Global",
+	GCRootType_THREAD_BLOCK:     "Thread Block",
+	GCRootType_BUSY_MONITOR:     "Busy Monitor",
+	GCRootType_JAVA_LOCAL:       "Java Local",
+	GCRootType_NATIVE_STACK:     "Native Stack",
+	GCRootType_THREAD_OBJ:       "Thread",
+	GCRootType_FINALIZABLE:      "Finalizable",
+	GCRootType_UNFINALIZED:      "Unfinalized",
+	GCRootType_UNREACHABLE:      "Unreachable",
+	GCRootType_JAVA_STACK_FRAME: "Java Stack Frame",
+}
+
+// GCRootTypeName 返回 GC root 类型的名称
+func GCRootTypeName(typ int) string {
+	name, exist := gcRootTypeNames[typ]
+	if !exist {
+		return gcRootTypeNames[GCRootType_UNKNOWN]
+	}
+	return name
+}
+
 type GCRootInfo struct {
 	ID       uint64
 	ThreadId uint64
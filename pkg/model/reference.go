@@ -0,0 +1,88 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReferenceStrength 引用强度
+// java.lang.ref.Reference 子类的 referent 字段不是强引用
+type ReferenceStrength int
+
+const (
+	ReferenceStrong ReferenceStrength = iota
+	ReferenceSoft
+	ReferenceWeak
+	ReferencePhantom
+	ReferenceFinal
+)
+
+var referenceStrengthNames = []string{"strong", "soft", "weak", "phantom", "final"}
+
+// ReferenceStrengthsByReachability 按 GC 判断可达性的顺序从强到弱排列，
+// finalizer 可达的对象在 phantom 可达之前被处理
+var ReferenceStrengthsByReachability = []ReferenceStrength{
+	ReferenceStrong,
+	ReferenceSoft,
+	ReferenceWeak,
+	ReferenceFinal,
+	ReferencePhantom,
+}
+
+// ReferenceClassNames Reference 类名对应的引用强度
+var ReferenceClassNames = map[string]ReferenceStrength{
+	"java.lang.ref.SoftReference":    ReferenceSoft,
+	"java.lang.ref.WeakReference":    ReferenceWeak,
+	"java.lang.ref.PhantomReference": ReferencePhantom,
+	"java.lang.ref.FinalReference":   ReferenceFinal,
+}
+
+func (s ReferenceStrength) String() string {
+	if s < 0 || int(s) >= len(referenceStrengthNames) {
+		return "unknown"
+	}
+	return referenceStrengthNames[s]
+}
+
+func (s ReferenceStrength) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseReferenceStrength 解析 strong、soft、weak、phantom、final
+func ParseReferenceStrength(name string) (ReferenceStrength, error) {
+	for idx, n := range referenceStrengthNames {
+		if n == name {
+			return ReferenceStrength(idx), nil
+		}
+	}
+	return ReferenceStrong, fmt.Errorf("unknown reference strength: %s", name)
+}
+
+// ParseReferenceStrengths 解析逗号分隔的引用强度列表，strong 总是包含在结果中
+func ParseReferenceStrengths(names string) ([]ReferenceStrength, error) {
+	result := []ReferenceStrength{ReferenceStrong}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		strength, err := ParseReferenceStrength(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ContainsReferenceStrength(result, strength) {
+			result = append(result, strength)
+		}
+	}
+	return result, nil
+}
+
+// ContainsReferenceStrength 判断 strengths 中是否包含 s
+func ContainsReferenceStrength(strengths []ReferenceStrength, s ReferenceStrength) bool {
+	for _, strength := range strengths {
+		if strength == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,9 @@
 package model
 
-// LocalFrame 应该就是 native 线程信息
+// LocalFrame 线程栈中作为 GC root 的局部变量
 type LocalFrame struct {
-	ObjectId   uint64
+	ObjectId uint64
+	// 实际是局部变量所在栈帧在 StackTrace.Frames 中的下标，小于 0 表示不知道在哪个栈帧
 	LineNumber int32
 }
 
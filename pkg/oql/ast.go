@@ -0,0 +1,97 @@
+package oql
+
+// Query 解析后的查询语句
+//
+//	SELECT expr [AS name], ... | *
+//	FROM [INSTANCEOF] className [alias]
+//	[WHERE expr]
+//	[ORDER BY expr [ASC | DESC], ...]
+//	[LIMIT n [OFFSET m]]
+type Query struct {
+	// SELECT * 时为空
+	Projections []*Projection
+	Class       string
+	InstanceOf  bool
+	Alias       string
+	Where       Expr
+	OrderBy     []*OrderItem
+	// 0 表示不限制
+	Limit  int
+	Offset int
+}
+
+type Projection struct {
+	Expr Expr
+	// AS 指定的名称，没有时是表达式的原文
+	Name string
+}
+
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+// Columns 返回结果的列名
+func (q *Query) Columns() []string {
+	if len(q.Projections) == 0 {
+		if q.Alias != "" {
+			return []string{q.Alias}
+		}
+		return []string{q.Class}
+	}
+	result := make([]string, len(q.Projections))
+	for idx, p := range q.Projections {
+		result[idx] = p.Name
+	}
+	return result
+}
+
+// Expr 表达式，在 env 中求值
+type Expr interface {
+	eval(env *env) (Value, error)
+}
+
+// literalExpr 数字、字符串、true、false 和 null
+type literalExpr struct {
+	value Value
+}
+
+// identExpr 别名表示当前对象，其他名称表示当前对象的字段，也可能是 SELECT 中 AS 指定的列名
+type identExpr struct {
+	name string
+}
+
+// fieldExpr object.field，数组的 length 是数组长度
+type fieldExpr struct {
+	object Expr
+	field  string
+}
+
+// indexExpr array[index]
+type indexExpr struct {
+	array Expr
+	index Expr
+}
+
+// callExpr 内置函数调用，name 是小写的函数名
+type callExpr struct {
+	name string
+	args []Expr
+	pos  int
+}
+
+type unaryExpr struct {
+	op      string
+	operand Expr
+}
+
+type binaryExpr struct {
+	op          string
+	left, right Expr
+}
+
+// isNullExpr expr IS [NOT] NULL
+type isNullExpr struct {
+	operand Expr
+	not     bool
+}
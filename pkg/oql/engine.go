@@ -0,0 +1,696 @@
+package oql
+
+import (
+	"errors"
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/snapshot"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Value 表达式的值，是 nil、bool、int64、float64、string 或者 Object
+type Value interface{}
+
+// Object 堆中的对象，值是对象 id，null 用 nil 表示
+type Object uint64
+
+type env struct {
+	s     *snapshot.Snapshot
+	alias string
+	// 当前行的对象
+	current uint64
+	// SELECT 中 AS 指定的列，只在 ORDER BY 中使用
+	columns map[string]Value
+	// 当前行读过的对象的类名和字段，避免重复读取
+	classNames map[uint64]string
+	fields     map[uint64]snapshot.FieldValues
+}
+
+func (e *env) reset(id uint64) {
+	e.current = id
+	e.columns = nil
+	e.classNames = make(map[uint64]string)
+	e.fields = make(map[uint64]snapshot.FieldValues)
+}
+
+func (e *env) className(id uint64) (string, error) {
+	if name, exist := e.classNames[id]; exist {
+		return name, nil
+	}
+	name, err := e.s.GetObjectClassName(id)
+	if err != nil {
+		return "", err
+	}
+	e.classNames[id] = name
+	return name, nil
+}
+
+// readField 返回对象的字段值，字段不存在时返回 nil
+func (e *env) readField(id uint64, field string) (Value, error) {
+	className, err := e.className(id)
+	if err != nil {
+		return nil, err
+	}
+	if isArrayClass(className) {
+		if field == "length" {
+			n, err := e.s.GetArrayLength(id)
+			return int64(n), err
+		}
+		return nil, nil
+	}
+	if strings.HasPrefix(className, "class ") {
+		return nil, nil
+	}
+	fields, exist := e.fields[id]
+	if !exist {
+		if _, fields, err = e.s.ReadFields(id); err != nil {
+			return nil, err
+		}
+		e.fields[id] = fields
+	}
+	return fieldValue(fields[field]), nil
+}
+
+// Engine 在 Snapshot 上执行查询
+type Engine struct {
+	s *snapshot.Snapshot
+}
+
+func NewEngine(s *snapshot.Snapshot) *Engine {
+	return &Engine{s: s}
+}
+
+// Execute 执行查询，每一行结果调用一次 fn，fn 返回错误时停止执行并返回该错误
+// 行中的对象是 *snapshot.ObjectRef，null 是 nil，其他值是 bool、int64、float64 或 string
+// 没有 ORDER BY 时边遍历边输出，有 ORDER BY 时需要先求出所有的行
+func (e *Engine) Execute(q *Query, fn func(row []interface{}) error) error {
+	ids, err := e.s.ListObjectIds(q.Class, q.InstanceOf, snapshot.AllObjects)
+	if err != nil {
+		return err
+	}
+	env := &env{s: e.s, alias: q.Alias}
+
+	if len(q.OrderBy) == 0 {
+		skipped, emitted := 0, 0
+		for _, id := range ids {
+			env.reset(id)
+			row, ok, err := e.evalRow(q, env)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if skipped < q.Offset {
+				skipped++
+				continue
+			}
+			if err = e.emit(row, fn); err != nil {
+				return err
+			}
+			emitted++
+			if q.Limit > 0 && emitted >= q.Limit {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	type sortedRow struct {
+		values []Value
+		keys   []Value
+	}
+	var rows []*sortedRow
+	columns := q.Columns()
+	for _, id := range ids {
+		env.reset(id)
+		values, ok, err := e.evalRow(q, env)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		env.columns = make(map[string]Value, len(columns))
+		for idx, name := range columns {
+			env.columns[name] = values[idx]
+		}
+		row := &sortedRow{values: values, keys: make([]Value, len(q.OrderBy))}
+		for idx, item := range q.OrderBy {
+			if row.keys[idx], err = item.Expr.eval(env); err != nil {
+				return err
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for idx, item := range q.OrderBy {
+			c := compareForSort(rows[i].keys[idx], rows[j].keys[idx])
+			if c == 0 {
+				continue
+			}
+			if item.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	if q.Offset >= len(rows) {
+		return nil
+	}
+	rows = rows[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(rows) {
+		rows = rows[:q.Limit]
+	}
+	for _, row := range rows {
+		if err = e.emit(row.values, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalRow 计算当前对象的 WHERE 和 SELECT，不满足 WHERE 时 ok 为 false
+func (e *Engine) evalRow(q *Query, env *env) ([]Value, bool, error) {
+	if q.Where != nil {
+		v, err := q.Where.eval(env)
+		if err != nil {
+			return nil, false, err
+		}
+		if !truthy(v) {
+			return nil, false, nil
+		}
+	}
+	if len(q.Projections) == 0 {
+		return []Value{Object(env.current)}, true, nil
+	}
+	values := make([]Value, len(q.Projections))
+	for idx, p := range q.Projections {
+		v, err := p.Expr.eval(env)
+		if err != nil {
+			return nil, false, err
+		}
+		values[idx] = v
+	}
+	return values, true, nil
+}
+
+func (e *Engine) emit(values []Value, fn func(row []interface{}) error) error {
+	row := make([]interface{}, len(values))
+	for idx, v := range values {
+		if o, ok := v.(Object); ok {
+			ref, err := e.s.GetObjectRef(uint64(o))
+			if err != nil {
+				return err
+			}
+			row[idx] = ref
+			continue
+		}
+		row[idx] = v
+	}
+	return fn(row)
+}
+
+func (x *literalExpr) eval(env *env) (Value, error) {
+	return x.value, nil
+}
+
+func (x *identExpr) eval(env *env) (Value, error) {
+	if x.name == env.alias {
+		return Object(env.current), nil
+	}
+	if v, exist := env.columns[x.name]; exist {
+		return v, nil
+	}
+	return env.readField(env.current, x.name)
+}
+
+func (x *fieldExpr) eval(env *env) (Value, error) {
+	v, err := x.object.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	o, ok := v.(Object)
+	if !ok {
+		return nil, fmt.Errorf("cannot read field %s of %s", x.field, typeName(v))
+	}
+	return env.readField(uint64(o), x.field)
+}
+
+func (x *indexExpr) eval(env *env) (Value, error) {
+	v, err := x.array.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	index, err := x.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := index.(int64)
+	if !ok {
+		return nil, fmt.Errorf("array index must be an integer, got %s", typeName(index))
+	}
+	o, ok := v.(Object)
+	if !ok {
+		return nil, fmt.Errorf("cannot index %s", typeName(v))
+	}
+	className, err := env.className(uint64(o))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(className, "["):
+		elements, err := env.s.GetObjectArrayElements(uint64(o))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n >= int64(len(elements)) {
+			return nil, nil
+		}
+		if elements[n] == 0 {
+			return nil, nil
+		}
+		return Object(elements[n]), nil
+	case strings.HasSuffix(className, "[]"):
+		elements, err := env.s.ReadPrimitiveArray(uint64(o))
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n >= int64(len(elements)) {
+			return nil, nil
+		}
+		if r, ok := elements[n].(rune); ok {
+			return string(r), nil
+		}
+		return elements[n], nil
+	}
+	return nil, fmt.Errorf("cannot index %s", className)
+}
+
+func (x *callExpr) eval(env *env) (Value, error) {
+	arg, err := x.args[0].eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return functions[x.name](env, arg)
+}
+
+func (x *unaryExpr) eval(env *env) (Value, error) {
+	v, err := x.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "NOT":
+		return !truthy(v), nil
+	case "-":
+		switch n := v.(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			return -n, nil
+		case float64:
+			return -n, nil
+		}
+		return nil, fmt.Errorf("cannot negate %s", typeName(v))
+	}
+	return nil, fmt.Errorf("unknown operator %s", x.op)
+}
+
+func (x *isNullExpr) eval(env *env) (Value, error) {
+	v, err := x.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return (v == nil) != x.not, nil
+}
+
+func (x *binaryExpr) eval(env *env) (Value, error) {
+	left, err := x.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	// AND 和 OR 短路求值
+	switch x.op {
+	case "AND":
+		if !truthy(left) {
+			return false, nil
+		}
+		right, err := x.right.eval(env)
+		return truthy(right), err
+	case "OR":
+		if truthy(left) {
+			return true, nil
+		}
+		right, err := x.right.eval(env)
+		return truthy(right), err
+	}
+	right, err := x.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compareValues(env, x.op, left, right)
+	case "LIKE":
+		return like(env, left, right)
+	}
+	return arithmetic(x.op, left, right)
+}
+
+// compareValues 数字之间按数值比较，对象和字符串比较时使用对象的 toString
+// 任意一边是 null 时只有 = 和 != 有意义
+func compareValues(env *env, op string, left, right Value) (Value, error) {
+	if left == nil || right == nil {
+		switch op {
+		case "=":
+			return left == right, nil
+		case "!=":
+			return left != right, nil
+		}
+		return false, nil
+	}
+	if o, ok := left.(Object); ok {
+		if _, isString := right.(string); isString {
+			s, err := objectString(env, uint64(o))
+			if err != nil {
+				return nil, err
+			}
+			left = s
+		}
+	}
+	if o, ok := right.(Object); ok {
+		if _, isString := left.(string); isString {
+			s, err := objectString(env, uint64(o))
+			if err != nil {
+				return nil, err
+			}
+			right = s
+		}
+	}
+	var c int
+	switch l := left.(type) {
+	case bool:
+		r, ok := right.(bool)
+		if !ok || (op != "=" && op != "!=") {
+			return nil, fmt.Errorf("cannot compare %s and %s", typeName(left), typeName(right))
+		}
+		if l != r {
+			c = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %s and %s", typeName(left), typeName(right))
+		}
+		c = strings.Compare(l, r)
+	default:
+		var ok bool
+		if c, ok = compareNumbers(left, right); !ok {
+			return nil, fmt.Errorf("cannot compare %s and %s", typeName(left), typeName(right))
+		}
+	}
+	switch op {
+	case "=":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+// compareNumbers 比较两个数字，对象按 id 比较，有一边是 float64 时按浮点数比较
+func compareNumbers(left, right Value) (int, bool) {
+	l, lok := toNumber(left)
+	r, rok := toNumber(right)
+	if !lok || !rok {
+		return 0, false
+	}
+	li, lint := l.(int64)
+	ri, rint := r.(int64)
+	if lint && rint {
+		switch {
+		case li < ri:
+			return -1, true
+		case li > ri:
+			return 1, true
+		}
+		return 0, true
+	}
+	lf, rf := toFloat(l), toFloat(r)
+	switch {
+	case lf < rf:
+		return -1, true
+	case lf > rf:
+		return 1, true
+	}
+	return 0, true
+}
+
+func toNumber(v Value) (Value, bool) {
+	switch n := v.(type) {
+	case int64, float64:
+		return n, true
+	case Object:
+		return int64(n), true
+	}
+	return nil, false
+}
+
+func toFloat(v Value) float64 {
+	if n, ok := v.(int64); ok {
+		return float64(n)
+	}
+	return v.(float64)
+}
+
+// compareForSort ORDER BY 使用的比较，null 最小，类型不同时按类型排序
+func compareForSort(left, right Value) int {
+	lr, rr := typeRank(left), typeRank(right)
+	if lr != rr {
+		return lr - rr
+	}
+	switch l := left.(type) {
+	case nil:
+		return 0
+	case bool:
+		r := right.(bool)
+		switch {
+		case l == r:
+			return 0
+		case !l:
+			return -1
+		}
+		return 1
+	case string:
+		return strings.Compare(l, right.(string))
+	}
+	c, _ := compareNumbers(left, right)
+	return c
+}
+
+func typeRank(v Value) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int64, float64:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
+
+// like SQL 的 LIKE，% 匹配任意个字符，_ 匹配一个字符
+func like(env *env, left, right Value) (Value, error) {
+	if left == nil || right == nil {
+		return false, nil
+	}
+	pattern, ok := right.(string)
+	if !ok {
+		return nil, fmt.Errorf("LIKE pattern must be a string, got %s", typeName(right))
+	}
+	s, err := stringValue(env, left)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+// arithmetic 数字的四则运算和取模，+ 的任意一边是字符串时拼接字符串
+func arithmetic(op string, left, right Value) (Value, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if op == "+" {
+		_, ls := left.(string)
+		_, rs := right.(string)
+		if ls || rs {
+			return formatValue(left) + formatValue(right), nil
+		}
+	}
+	l, lok := left.(int64)
+	r, rok := right.(int64)
+	if lok && rok {
+		switch op {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if op == "/" {
+				return l / r, nil
+			}
+			return l % r, nil
+		}
+	}
+	_, lnum := left.(float64)
+	_, rnum := right.(float64)
+	if (lok || lnum) && (rok || rnum) {
+		lf, rf := toFloat(left), toFloat(right)
+		switch op {
+		case "+":
+			return lf + rf, nil
+		case "-":
+			return lf - rf, nil
+		case "*":
+			return lf * rf, nil
+		case "/":
+			if rf == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return lf / rf, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot apply %s to %s and %s", op, typeName(left), typeName(right))
+}
+
+// truthy null、false、0 和空字符串为 false
+func truthy(v Value) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	}
+	return true
+}
+
+func typeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case Object:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func formatValue(v Value) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case Object:
+		return fmt.Sprintf("0x%x", uint64(x))
+	}
+	return fmt.Sprint(v)
+}
+
+// stringValue 对象使用 objectString，其他值直接格式化
+func stringValue(env *env, v Value) (string, error) {
+	if o, ok := v.(Object); ok {
+		return objectString(env, uint64(o))
+	}
+	return formatValue(v), nil
+}
+
+// objectString java.lang.String 返回完整的内容，其他对象使用 RenderValue
+func objectString(env *env, id uint64) (string, error) {
+	className, err := env.className(id)
+	if err != nil {
+		return "", err
+	}
+	if className == "java.lang.String" {
+		return env.s.ReadString(id)
+	}
+	return env.s.RenderValue(id)
+}
+
+func isArrayClass(className string) bool {
+	return strings.HasPrefix(className, "[") || strings.HasSuffix(className, "[]")
+}
+
+// fieldValue 把 hprof 中的字段值转换为 Value，char 转换为字符串
+func fieldValue(field hprof.HProfInstanceFieldValue) Value {
+	switch v := field.(type) {
+	case *hprof.HProfInstanceBooleanValue:
+		return v.Value
+	case *hprof.HProfInstanceByteValue:
+		return int64(int8(v.Value))
+	case *hprof.HProfInstanceCharValue:
+		return string(rune(v.Value))
+	case *hprof.HProfInstanceShortValue:
+		return int64(v.Value)
+	case *hprof.HProfInstanceIntValue:
+		return int64(v.Value)
+	case *hprof.HProfInstanceLongValue:
+		return v.Value
+	case *hprof.HProfInstanceFloatValue:
+		return float64(v.Value)
+	case *hprof.HProfInstanceDoubleValue:
+		return v.Value
+	case *hprof.HProfInstanceObjectValue:
+		if v.Value == 0 {
+			return nil
+		}
+		return Object(v.Value)
+	}
+	return nil
+}
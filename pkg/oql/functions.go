@@ -0,0 +1,122 @@
+package oql
+
+import (
+	"errors"
+	"fmt"
+	"hprof-tool/pkg/snapshot"
+	"unicode/utf8"
+)
+
+// functions 内置函数，名称是小写的，调用时不区分大小写，参数为 null 时返回 null
+var functions = map[string]func(env *env, arg Value) (Value, error){
+	"sizeof":       shallowSize,
+	"shallowsize":  shallowSize,
+	"retainedsize": retainedSize,
+	"inbounds":     inboundCount,
+	"inboundcount": inboundCount,
+	"tostring":     toString,
+	"classof":      className,
+	"classname":    className,
+	"objectid":     objectId,
+	"length":       length,
+}
+
+func argObject(name string, arg Value) (uint64, error) {
+	o, ok := arg.(Object)
+	if !ok {
+		return 0, fmt.Errorf("%s: expected object, got %s", name, typeName(arg))
+	}
+	return uint64(o), nil
+}
+
+func shallowSize(env *env, arg Value) (Value, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	id, err := argObject("sizeof", arg)
+	if err != nil {
+		return nil, err
+	}
+	return env.s.GetShallowSize(id)
+}
+
+// retainedSize 不在支配树中的对象（比如不可达的对象）返回 0
+func retainedSize(env *env, arg Value) (Value, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	id, err := argObject("retainedSize", arg)
+	if err != nil {
+		return nil, err
+	}
+	retained, err := env.s.GetRetainedSize(id)
+	if errors.Is(err, snapshot.ErrNotFound) {
+		return int64(0), nil
+	}
+	return retained, err
+}
+
+func inboundCount(env *env, arg Value) (Value, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	id, err := argObject("inbounds", arg)
+	if err != nil {
+		return nil, err
+	}
+	n, err := env.s.CountInboundReferences(id)
+	return int64(n), err
+}
+
+func toString(env *env, arg Value) (Value, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	return stringValue(env, arg)
+}
+
+func className(env *env, arg Value) (Value, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	id, err := argObject("classof", arg)
+	if err != nil {
+		return nil, err
+	}
+	return env.className(id)
+}
+
+func objectId(env *env, arg Value) (Value, error) {
+	if arg == nil {
+		return nil, nil
+	}
+	id, err := argObject("objectId", arg)
+	if err != nil {
+		return nil, err
+	}
+	return int64(id), nil
+}
+
+// length 字符串的字符个数或数组的元素个数
+func length(env *env, arg Value) (Value, error) {
+	switch v := arg.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return int64(utf8.RuneCountInString(v)), nil
+	case Object:
+		className, err := env.className(uint64(v))
+		if err != nil {
+			return nil, err
+		}
+		if isArrayClass(className) {
+			n, err := env.s.GetArrayLength(uint64(v))
+			return int64(n), err
+		}
+		if className == "java.lang.String" {
+			s, err := env.s.ReadString(uint64(v))
+			return int64(utf8.RuneCountInString(s)), err
+		}
+	}
+	return nil, fmt.Errorf("length: expected string or array, got %s", typeName(arg))
+}
@@ -0,0 +1,126 @@
+package oql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	// 运算符和标点，text 中是原文
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// 在查询语句中的字节偏移
+	pos int
+}
+
+// SyntaxError 查询语句解析失败，Pos 是出错位置的字节偏移
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d: %s", e.Pos, e.Msg)
+}
+
+// symbols 按长度从长到短排列，保证 <= 先于 < 匹配
+var symbols = []string{"<=", ">=", "!=", "<>", "=", "<", ">", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+// tokenize 把查询语句切分成 token，最后一个 token 是 tokenEOF
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	runes := []rune(text)
+	// offsets[i] 是第 i 个 rune 的字节偏移
+	offsets := make([]int, len(runes)+1)
+	for i, offset := 0, 0; i < len(runes); i++ {
+		offsets[i] = offset
+		offset += len(string(runes[i]))
+		offsets[i+1] = offset
+	}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case isIdentStart(r):
+			start := i
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, string(runes[start:i]), offsets[start]})
+		case unicode.IsDigit(r):
+			start := i
+			if r == '0' && i+1 < len(runes) && (runes[i+1] == 'x' || runes[i+1] == 'X') {
+				// 十六进制，通常是对象 id
+				i += 2
+				for i < len(runes) && unicode.Is(unicode.ASCII_Hex_Digit, runes[i]) {
+					i++
+				}
+			} else {
+				for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[start:i]), offsets[start]})
+		case r == '\'' || r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == r {
+					// 连续两个引号表示引号本身
+					if i+1 < len(runes) && runes[i+1] == r {
+						sb.WriteRune(r)
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &SyntaxError{offsets[start], "unterminated string"}
+			}
+			tokens = append(tokens, token{tokenString, sb.String(), offsets[start]})
+		default:
+			matched := false
+			for _, sym := range symbols {
+				n := len([]rune(sym))
+				if i+n <= len(runes) && string(runes[i:i+n]) == sym {
+					tokens = append(tokens, token{tokenSymbol, sym, offsets[i]})
+					i += n
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &SyntaxError{offsets[i], fmt.Sprintf("unexpected character %q", r)}
+			}
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(text)})
+	return tokens, nil
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '$' || r == '@'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,478 @@
+package oql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "ORDER": true, "BY": true,
+	"ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true, "AND": true,
+	"OR": true, "NOT": true, "LIKE": true, "INSTANCEOF": true, "AS": true,
+	"TRUE": true, "FALSE": true, "NULL": true, "IS": true,
+}
+
+// primitiveDescriptors 基本类型数组的类型描述符，用于多维数组的类名
+var primitiveDescriptors = map[string]string{
+	"boolean": "Z", "byte": "B", "char": "C", "short": "S",
+	"int": "I", "long": "J", "float": "F", "double": "D",
+}
+
+type parser struct {
+	text   string
+	tokens []token
+	pos    int
+}
+
+// Parse 解析查询语句，关键字不区分大小写
+func Parse(text string) (*Query, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{text: text, tokens: tokens}
+	return p.parseQuery()
+}
+
+// peek 返回当前 token，越过结尾后一直返回 tokenEOF
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos]
+}
+
+// next 返回当前 token 并前进，出错时通过 p.pos-- 回退到出错的 token
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// isKeyword 判断当前 token 是否是关键字 kw
+func (p *parser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf("expected %s", kw)
+	}
+	return nil
+}
+
+func (p *parser) isSymbol(sym string) bool {
+	t := p.peek()
+	return t.kind == tokenSymbol && t.text == sym
+}
+
+func (p *parser) acceptSymbol(sym string) bool {
+	if p.isSymbol(sym) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(sym string) error {
+	if !p.acceptSymbol(sym) {
+		return p.errorf("expected %q", sym)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokenEOF {
+		found = "end of query"
+	}
+	return &SyntaxError{t.pos, fmt.Sprintf(format, args...) + ", found " + strconv.Quote(found)}
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	q := &Query{}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	if !p.acceptSymbol("*") {
+		for {
+			start := p.peek().pos
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			projection := &Projection{Expr: expr, Name: strings.TrimSpace(p.text[start:p.peek().pos])}
+			if p.acceptKeyword("AS") {
+				t := p.next()
+				if t.kind != tokenIdent && t.kind != tokenString {
+					p.pos--
+					return nil, p.errorf("expected column name")
+				}
+				projection.Name = t.text
+			}
+			q.Projections = append(q.Projections, projection)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	q.InstanceOf = p.acceptKeyword("INSTANCEOF")
+	class, err := p.parseClassName()
+	if err != nil {
+		return nil, err
+	}
+	q.Class = class
+	if t := p.peek(); t.kind == tokenIdent && !keywords[strings.ToUpper(t.text)] {
+		q.Alias = p.next().text
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if q.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := &OrderItem{Expr: expr}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			q.OrderBy = append(q.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		if q.Limit, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("OFFSET") {
+			if q.Offset, err = p.parseCount(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return q, nil
+}
+
+// parseClassName 解析 java.util.HashMap$Node、java.lang.String[]、char[] 或者引号中的类名
+func (p *parser) parseClassName() (string, error) {
+	if t := p.peek(); t.kind == tokenString {
+		p.pos++
+		return t.text, nil
+	}
+	t := p.next()
+	if t.kind != tokenIdent {
+		p.pos--
+		return "", p.errorf("expected class name")
+	}
+	name := t.text
+	for p.acceptSymbol(".") {
+		t = p.next()
+		if t.kind != tokenIdent {
+			p.pos--
+			return "", p.errorf("expected class name")
+		}
+		name += "." + t.text
+	}
+	dims := 0
+	for p.acceptSymbol("[") {
+		if err := p.expectSymbol("]"); err != nil {
+			return "", err
+		}
+		dims++
+	}
+	if dims == 0 {
+		return name, nil
+	}
+	// 和 dump 中的类名一致：一维基本类型数组是 char[]，其他数组是 [Ljava.lang.String; 和 [[C 这种格式
+	descriptor, primitive := primitiveDescriptors[name]
+	if primitive && dims == 1 {
+		return name + "[]", nil
+	}
+	if !primitive {
+		descriptor = "L" + name + ";"
+	}
+	return strings.Repeat("[", dims) + descriptor, nil
+}
+
+func (p *parser) parseCount() (int, error) {
+	t := p.next()
+	if t.kind != tokenNumber {
+		p.pos--
+		return 0, p.errorf("expected number")
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil || n < 0 {
+		return 0, &SyntaxError{t.pos, "invalid number " + strconv.Quote(t.text)}
+	}
+	return n, nil
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "NOT", operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err = p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{operand: left, not: not}, nil
+	}
+	not := false
+	if p.isKeyword("NOT") {
+		// a NOT LIKE b
+		p.pos++
+		if !p.isKeyword("LIKE") {
+			return nil, p.errorf("expected LIKE")
+		}
+		not = true
+	}
+	if p.acceptKeyword("LIKE") {
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var expr Expr = &binaryExpr{op: "LIKE", left: left, right: right}
+		if not {
+			expr = &unaryExpr{op: "NOT", operand: expr}
+		}
+		return expr, nil
+	}
+	for _, op := range []string{"=", "!=", "<>", "<=", ">=", "<", ">"} {
+		if p.acceptSymbol(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			if op == "<>" {
+				op = "!="
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isSymbol("+") || p.isSymbol("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isSymbol("*") || p.isSymbol("/") || p.isSymbol("%") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.acceptSymbol("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "-", operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.acceptSymbol("."):
+			t := p.next()
+			if t.kind != tokenIdent {
+				p.pos--
+				return nil, p.errorf("expected field name")
+			}
+			expr = &fieldExpr{object: expr, field: t.text}
+		case p.acceptSymbol("["):
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+			expr = &indexExpr{array: expr, index: index}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		if strings.HasPrefix(t.text, "0x") || strings.HasPrefix(t.text, "0X") {
+			n, err := strconv.ParseUint(t.text[2:], 16, 64)
+			if err != nil {
+				return nil, &SyntaxError{t.pos, "invalid number " + strconv.Quote(t.text)}
+			}
+			return &literalExpr{int64(n)}, nil
+		}
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literalExpr{n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{t.pos, "invalid number " + strconv.Quote(t.text)}
+		}
+		return &literalExpr{f}, nil
+	case tokenString:
+		return &literalExpr{t.text}, nil
+	case tokenIdent:
+		switch strings.ToUpper(t.text) {
+		case "TRUE":
+			return &literalExpr{true}, nil
+		case "FALSE":
+			return &literalExpr{false}, nil
+		case "NULL":
+			return &literalExpr{nil}, nil
+		}
+		if keywords[strings.ToUpper(t.text)] {
+			p.pos--
+			return nil, p.errorf("unexpected keyword")
+		}
+		if p.acceptSymbol("(") {
+			call := &callExpr{name: strings.ToLower(t.text), pos: t.pos}
+			if _, exist := functions[call.name]; !exist {
+				return nil, &SyntaxError{t.pos, "unknown function " + strconv.Quote(t.text)}
+			}
+			if !p.acceptSymbol(")") {
+				for {
+					arg, err := p.parseExpr()
+					if err != nil {
+						return nil, err
+					}
+					call.args = append(call.args, arg)
+					if !p.acceptSymbol(",") {
+						break
+					}
+				}
+				if err := p.expectSymbol(")"); err != nil {
+					return nil, err
+				}
+			}
+			if len(call.args) != 1 {
+				return nil, &SyntaxError{t.pos, fmt.Sprintf("function %s takes 1 argument", t.text)}
+			}
+			return call, nil
+		}
+		return &identExpr{name: t.text}, nil
+	case tokenSymbol:
+		if t.text == "(" {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+	}
+	p.pos--
+	return nil, p.errorf("expected expression")
+}
@@ -0,0 +1,201 @@
+package oql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// format 把表达式转换成带括号的形式，用于检查优先级
+func format(e Expr) string {
+	switch x := e.(type) {
+	case *literalExpr:
+		if s, ok := x.value.(string); ok {
+			return fmt.Sprintf("%q", s)
+		}
+		return fmt.Sprint(x.value)
+	case *identExpr:
+		return x.name
+	case *fieldExpr:
+		return format(x.object) + "." + x.field
+	case *indexExpr:
+		return format(x.array) + "[" + format(x.index) + "]"
+	case *callExpr:
+		args := make([]string, len(x.args))
+		for idx, arg := range x.args {
+			args[idx] = format(arg)
+		}
+		return x.name + "(" + strings.Join(args, ", ") + ")"
+	case *unaryExpr:
+		return "(" + x.op + " " + format(x.operand) + ")"
+	case *binaryExpr:
+		return "(" + format(x.left) + " " + x.op + " " + format(x.right) + ")"
+	case *isNullExpr:
+		if x.not {
+			return "(" + format(x.operand) + " IS NOT NULL)"
+		}
+		return "(" + format(x.operand) + " IS NULL)"
+	}
+	return fmt.Sprintf("<%T>", e)
+}
+
+func TestParseWhere(t *testing.T) {
+	tests := []struct {
+		where string
+		want  string
+	}{
+		{"a OR b AND c", "(a OR (b AND c))"},
+		{"a AND b OR c AND d", "((a AND b) OR (c AND d))"},
+		{"NOT a AND b", "((NOT a) AND b)"},
+		{"NOT NOT a OR b", "((NOT (NOT a)) OR b)"},
+		{"NOT a = 1", "(NOT (a = 1))"},
+		{"a = 1 OR b <> 2", "((a = 1) OR (b != 2))"},
+		{"1 + 2 * 3 = 7", "((1 + (2 * 3)) = 7)"},
+		{"1 - 2 - 3 > 0", "(((1 - 2) - 3) > 0)"},
+		{"(1 + 2) * 3 % 4 <= 5", "((((1 + 2) * 3) % 4) <= 5)"},
+		{"-a.b * 2 >= 1", "(((- a.b) * 2) >= 1)"},
+		{"s.value.length / 2 < s.value[0]", "((s.value.length / 2) < s.value[0])"},
+		{"s.name LIKE 'it''s%'", "(s.name LIKE \"it's%\")"},
+		{"s.name NOT LIKE \"say \"\"hi\"\"\"", "(NOT (s.name LIKE \"say \\\"hi\\\"\"))"},
+		{"objectid(s) = 0xFF", "(objectid(s) = 255)"},
+		{"objectid(s) = 0XdeadBEEF", "(objectid(s) = 3735928559)"},
+		{"s.next IS NULL", "(s.next IS NULL)"},
+		{"s.next IS NOT NULL AND s.key is not null", "((s.next IS NOT NULL) AND (s.key IS NOT NULL))"},
+		{"a = 1.5 OR b = TRUE OR c = null", "(((a = 1.5) OR (b = true)) OR (c = <nil>))"},
+	}
+	for _, tt := range tests {
+		q, err := Parse("SELECT s FROM java.lang.String s WHERE " + tt.where)
+		if err != nil {
+			t.Errorf("%s: %v", tt.where, err)
+			continue
+		}
+		if got := format(q.Where); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.where, got, tt.want)
+		}
+	}
+}
+
+func TestEvalArithmetic(t *testing.T) {
+	tests := []struct {
+		expr string
+		want Value
+	}{
+		{"1 + 2 * 3", int64(7)},
+		{"(1 + 2) * 3", int64(9)},
+		{"10 - 4 - 3", int64(3)},
+		{"-2 * -3", int64(6)},
+		{"7 % 4 + 1", int64(4)},
+		{"1 < 2 AND NOT 2 < 1", true},
+		{"1 = 2 OR 3 = 3 AND 4 = 5", false},
+	}
+	for _, tt := range tests {
+		q, err := Parse("SELECT " + tt.expr + " FROM java.lang.Object")
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		got, err := q.Projections[0].Expr.eval(&env{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v (%T), want %v (%T)", tt.expr, got, got, tt.want, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := Parse(`select s.value.length AS len, toString(s) as "text" from INSTANCEOF java.lang.CharSequence s where s.hash != 0 order by len desc, text limit 10 offset 20`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Class != "java.lang.CharSequence" || !q.InstanceOf || q.Alias != "s" {
+		t.Errorf("class %s, instanceof %v, alias %s", q.Class, q.InstanceOf, q.Alias)
+	}
+	if got := strings.Join(q.Columns(), ","); got != "len,text" {
+		t.Errorf("columns = %s", got)
+	}
+	if q.Limit != 10 || q.Offset != 20 {
+		t.Errorf("limit %d offset %d", q.Limit, q.Offset)
+	}
+	if len(q.OrderBy) != 2 || !q.OrderBy[0].Desc || q.OrderBy[1].Desc {
+		t.Fatalf("order by = %v", q.OrderBy)
+	}
+	// ORDER BY 中的名称优先使用 SELECT 中 AS 指定的列
+	orderEnv := &env{alias: "s", columns: map[string]Value{"len": int64(3), "text": "abc"}}
+	for idx, want := range []Value{int64(3), "abc"} {
+		got, err := q.OrderBy[idx].Expr.eval(orderEnv)
+		if err != nil || got != want {
+			t.Errorf("order by %d = %v, %v, want %v", idx, got, err, want)
+		}
+	}
+	if got, _ := (&identExpr{name: "s"}).eval(&env{alias: "s", current: 42}); got != Object(42) {
+		t.Errorf("alias = %v, want the current object", got)
+	}
+}
+
+func TestParseColumnNames(t *testing.T) {
+	q, err := Parse("SELECT s.value.length , sizeof( s ) FROM java.lang.String s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(q.Columns(), "|"); got != "s.value.length|sizeof( s )" {
+		t.Errorf("columns = %s", got)
+	}
+}
+
+func TestParseClassName(t *testing.T) {
+	tests := map[string]string{
+		"java.util.HashMap$Node": "java.util.HashMap$Node",
+		"char[]":                 "char[]",
+		"char[][]":               "[[C",
+		"java.lang.String[]":     "[Ljava.lang.String;",
+		"'java.lang.String[]'":   "java.lang.String[]",
+	}
+	for class, want := range tests {
+		q, err := Parse("SELECT * FROM " + class)
+		if err != nil {
+			t.Errorf("%s: %v", class, err)
+			continue
+		}
+		if q.Class != want {
+			t.Errorf("%s: got %s, want %s", class, q.Class, want)
+		}
+	}
+}
+
+func TestSyntaxErrorPos(t *testing.T) {
+	tests := []struct {
+		query string
+		// 出错位置的字节偏移
+		pos int
+	}{
+		{"SELECT c FROM java.lang.Object c WHERE", 38},
+		{"SELECT c FROM", 13},
+		{"FROM java.lang.Object", 0},
+		{"SELECT FROM java.lang.Object", 7},
+		{"SELECT 'abc FROM java.lang.Object", 7},
+		{"SELECT c FROM java.lang.Object c WHERE c.a # 1", 43},
+		{"SELECT c FROM java.lang.Object c LIMIT x", 39},
+		{"SELECT c FROM java.lang.Object c LIMIT 1 x", 41},
+		{"SELECT nosuch(c) FROM java.lang.Object c", 7},
+		{"SELECT c FROM java.lang.Object c WHERE c.a IS NOT 1", 50},
+		{"SELECT c FROM java.lang.Object c WHERE (c.a = 1", 47},
+		{"SELECT c FROM java.lang.Object c ORDER c", 39},
+		{"SELECT c AS 1 FROM java.lang.Object c", 12},
+		{"SELECT '中文' + FROM java.lang.Object", 18},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: got %v, want a SyntaxError", tt.query, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos {
+			t.Errorf("%s: %v, want position %d", tt.query, err, tt.pos)
+		}
+	}
+}
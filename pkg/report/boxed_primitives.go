@@ -0,0 +1,75 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const boxedPrimitivesText = `Boxed primitives
+{{.Count}} boxed objects, {{bytes .ShallowSize}}
+{{bytes .UncachedInRangeBytes}} in values covered by the JDK caches but not cached
+{{bytes .EstimatedSaving}} estimated saving with primitive collections
+
+Types:
+{{- range .Types}}
+  {{.Class}}: {{.Count}} objects ({{bytes .ShallowSize}}), {{.UncachedInRange}} uncached in cache range ({{bytes .UncachedInRangeBytes}}), {{.InCollections}} in collections, {{bytes .EstimatedSaving}} saving
+{{- end}}
+
+Owning collections:
+{{- range .Owners}}
+  {{.Class}}: {{.Collections}} collections, {{.Count}} boxed objects ({{bytes .ShallowSize}}), {{bytes .EstimatedSaving}} saving
+{{- range $class, $count := .Types}}
+    {{$class}}: {{$count}}
+{{- end}}
+{{- end}}
+`
+
+const boxedPrimitivesHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Boxed primitives</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Boxed primitives</h1>
+<p>{{.Count}} boxed objects, {{bytes .ShallowSize}}</p>
+<p>{{bytes .UncachedInRangeBytes}} in values covered by the JDK caches but not cached</p>
+<p>{{bytes .EstimatedSaving}} estimated saving with primitive collections</p>
+<h2>Types</h2>
+<table>
+<tr><th>Class</th><th>Objects</th><th>Size</th><th>Uncached in cache range</th><th>Uncached size</th><th>In collections</th><th>Saving</th></tr>
+{{range .Types}}<tr><td>{{.Class}}</td><td>{{.Count}}</td><td>{{bytes .ShallowSize}}</td><td>{{.UncachedInRange}}</td><td>{{bytes .UncachedInRangeBytes}}</td><td>{{.InCollections}}</td><td>{{bytes .EstimatedSaving}}</td></tr>
+{{end}}</table>
+<h2>Owning collections</h2>
+<table>
+<tr><th>Class</th><th>Collections</th><th>Boxed objects</th><th>Size</th><th>Saving</th><th>Types</th></tr>
+{{range .Owners}}<tr>
+<td>{{.Class}}</td><td>{{.Collections}}</td><td>{{.Count}}</td><td>{{bytes .ShallowSize}}</td><td>{{bytes .EstimatedSaving}}</td>
+<td>{{range $class, $count := .Types}}<div>{{$class}}: {{$count}}</div>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var (
+	boxedPrimitivesTextTemplate = template.Must(template.New("boxed-primitives").Funcs(funcs).Parse(boxedPrimitivesText))
+	boxedPrimitivesHTMLTemplate = htmltemplate.Must(htmltemplate.New("boxed-primitives").Funcs(funcs).Parse(boxedPrimitivesHTML))
+)
+
+// WriteBoxedPrimitivesText 输出纯文本格式的装箱对象报告
+func WriteBoxedPrimitivesText(w io.Writer, r *snapshot.BoxedPrimitivesReport) error {
+	return boxedPrimitivesTextTemplate.Execute(w, r)
+}
+
+// WriteBoxedPrimitivesHTML 输出 HTML 格式的装箱对象报告
+func WriteBoxedPrimitivesHTML(w io.Writer, r *snapshot.BoxedPrimitivesReport) error {
+	return boxedPrimitivesHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const classLoadersText = `Class Loaders
+{{len .Loaders}} class loader(s), {{.DuplicateCount}} class(es) loaded by more than one loader, {{.LeakCandidates}} leak candidate(s)
+
+Class loaders:
+{{- range .Loaders}}
+  {{.Class}}{{if .Id}} (id {{.Id}}){{end}}{{if .Display}} {{printf "%q" .Display}}{{end}}: {{.ClassCount}} classes, {{.InstanceCount}} instances ({{bytes .InstanceSize}}), retained {{bytes .RetainedSize}}, {{.DuplicateClasses}} duplicate classes{{if .Id}}, {{.PathCount}} path(s) to GC roots{{end}}{{if .LeakCandidate}}, LEAK CANDIDATE{{end}}
+{{- with .PathToGCRoot}}
+    Path to GC root ({{join .RootTypes ", "}}{{if .Thread}}, thread "{{.Thread}}"{{end}}):
+{{- range .Nodes}}
+      {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}{{if .Field}} . {{.Field}}{{end}}
+{{- end}}
+{{- end}}
+{{- end}}
+
+Duplicate classes:
+{{- range .DuplicateClasses}}
+  {{.Class}}: loaders {{range $idx, $id := .Loaders}}{{if $idx}}, {{end}}{{$id}}{{end}}
+{{- end}}
+`
+
+const classLoadersHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Class Loaders</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+.path { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Class Loaders</h1>
+<p>{{len .Loaders}} class loader(s), {{.DuplicateCount}} class(es) loaded by more than one loader, {{.LeakCandidates}} leak candidate(s)</p>
+<h2>Class loaders</h2>
+<table>
+<tr><th>Class loader</th><th>Classes</th><th>Instances</th><th>Instance size</th><th>Retained size</th><th>Duplicate classes</th><th>Paths to GC roots</th><th>Path to GC root</th></tr>
+{{range .Loaders}}<tr>
+<td>{{if .LeakCandidate}}<b>{{.Class}}</b>{{else}}{{.Class}}{{end}}{{if .Id}} (id {{.Id}}){{end}}{{if .Display}} "{{.Display}}"{{end}}</td>
+<td>{{.ClassCount}}</td><td>{{.InstanceCount}}</td><td>{{bytes .InstanceSize}}</td><td>{{bytes .RetainedSize}}</td><td>{{.DuplicateClasses}}</td><td>{{if .Id}}{{.PathCount}}{{end}}</td>
+<td>{{with .PathToGCRoot}}<div>{{join .RootTypes ", "}}{{if .Thread}}, thread "{{.Thread}}"{{end}}</div><div class="path">{{range .Nodes}}<div>{{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}{{if .Field}} . {{.Field}}{{end}}</div>{{end}}</div>{{end}}</td>
+</tr>
+{{end}}</table>
+<h2>Duplicate classes</h2>
+<table>
+<tr><th>Class</th><th>Loaders</th></tr>
+{{range .DuplicateClasses}}<tr><td>{{.Class}}</td><td>{{range $idx, $id := .Loaders}}{{if $idx}}, {{end}}{{$id}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var (
+	classLoadersTextTemplate = template.Must(template.New("class-loaders").Funcs(funcs).Parse(classLoadersText))
+	classLoadersHTMLTemplate = htmltemplate.Must(htmltemplate.New("class-loaders").Funcs(funcs).Parse(classLoadersHTML))
+)
+
+// WriteClassLoadersText 输出纯文本格式的 ClassLoader 报告
+func WriteClassLoadersText(w io.Writer, r *snapshot.ClassLoadersReport) error {
+	return classLoadersTextTemplate.Execute(w, r)
+}
+
+// WriteClassLoadersHTML 输出 HTML 格式的 ClassLoader 报告
+func WriteClassLoadersHTML(w io.Writer, r *snapshot.ClassLoadersReport) error {
+	return classLoadersHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const collectionsText = `Collections
+{{bytes .WastedBytes}} wasted{{if .Skipped}}, {{.Skipped}} collection(s) with missing internal objects skipped{{end}}
+
+Class statistics:
+{{- range .Classes}}
+  {{.Class}}: {{.Count}} collections, {{.EmptyCount}} empty ({{bytes .EmptyBytes}}), size {{.Size}}, capacity {{.Capacity}}, fill ratio {{percent .FillRatio}}, {{bytes .WastedBytes}} wasted
+{{- end}}
+
+Top offenders:
+{{- range .Offenders}}
+  {{.Class}} (id {{.Id}}): size {{.Size}}, capacity {{.Capacity}}, fill ratio {{percent .FillRatio}}, {{bytes .WastedBytes}} wasted
+{{- range .Holders}}
+    held by {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}{{if .Field}} . {{.Field}}{{end}}
+{{- end}}
+{{- end}}
+`
+
+const collectionsHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Collections</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Collections</h1>
+<p>{{bytes .WastedBytes}} wasted{{if .Skipped}}, {{.Skipped}} collection(s) with missing internal objects skipped{{end}}</p>
+<h2>Class statistics</h2>
+<table>
+<tr><th>Class</th><th>Collections</th><th>Empty</th><th>Empty size</th><th>Size</th><th>Capacity</th><th>Fill ratio</th><th>Wasted</th></tr>
+{{range .Classes}}<tr><td>{{.Class}}</td><td>{{.Count}}</td><td>{{.EmptyCount}}</td><td>{{bytes .EmptyBytes}}</td><td>{{.Size}}</td><td>{{.Capacity}}</td><td>{{percent .FillRatio}}</td><td>{{bytes .WastedBytes}}</td></tr>
+{{end}}</table>
+<h2>Top offenders</h2>
+<table>
+<tr><th>Collection</th><th>Size</th><th>Capacity</th><th>Fill ratio</th><th>Wasted</th><th>Holders</th></tr>
+{{range .Offenders}}<tr>
+<td>{{.Class}} (id {{.Id}})</td><td>{{.Size}}</td><td>{{.Capacity}}</td><td>{{percent .FillRatio}}</td><td>{{bytes .WastedBytes}}</td>
+<td>{{range .Holders}}<div>{{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}{{if .Field}} . {{.Field}}{{end}}</div>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var (
+	collectionsTextTemplate = template.Must(template.New("collections").Funcs(funcs).Parse(collectionsText))
+	collectionsHTMLTemplate = htmltemplate.Must(htmltemplate.New("collections").Funcs(funcs).Parse(collectionsHTML))
+)
+
+// WriteCollectionsText 输出纯文本格式的集合填充率报告
+func WriteCollectionsText(w io.Writer, r *snapshot.CollectionsReport) error {
+	return collectionsTextTemplate.Execute(w, r)
+}
+
+// WriteCollectionsHTML 输出 HTML 格式的集合填充率报告
+func WriteCollectionsHTML(w io.Writer, r *snapshot.CollectionsReport) error {
+	return collectionsHTMLTemplate.Execute(w, r)
+}
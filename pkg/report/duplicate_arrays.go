@@ -0,0 +1,58 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const duplicateArraysText = `Duplicate Arrays
+{{.TotalArrays}} arrays, {{.DistinctArrays}} distinct contents, {{bytes .WastedBytes}} wasted
+{{range .Arrays}}
+{{.Type}} of length {{.Length}} (sample id {{.SampleId}})
+  {{.Count}} arrays, {{bytes .Size}} each, {{bytes .WastedBytes}} wasted
+{{- range .Holders}}
+    {{.Count}} from {{.Class}}
+{{- end}}
+{{end}}`
+
+const duplicateArraysHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Duplicate Arrays</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Duplicate Arrays</h1>
+<p>{{.TotalArrays}} arrays, {{.DistinctArrays}} distinct contents, {{bytes .WastedBytes}} wasted</p>
+<table>
+<tr><th>Type</th><th>Length</th><th>Sample id</th><th>Arrays</th><th>Size</th><th>Wasted</th><th>Holders</th></tr>
+{{range .Arrays}}<tr>
+<td>{{.Type}}</td><td>{{.Length}}</td><td>{{.SampleId}}</td><td>{{.Count}}</td><td>{{bytes .Size}}</td><td>{{bytes .WastedBytes}}</td>
+<td>{{range .Holders}}<div>{{.Count}} from {{.Class}}</div>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var (
+	duplicateArraysTextTemplate = template.Must(template.New("duplicate-arrays").Funcs(funcs).Parse(duplicateArraysText))
+	duplicateArraysHTMLTemplate = htmltemplate.Must(htmltemplate.New("duplicate-arrays").Funcs(funcs).Parse(duplicateArraysHTML))
+)
+
+// WriteDuplicateArraysText 输出纯文本格式的重复数组报告
+func WriteDuplicateArraysText(w io.Writer, r *snapshot.DuplicateArraysReport) error {
+	return duplicateArraysTextTemplate.Execute(w, r)
+}
+
+// WriteDuplicateArraysHTML 输出 HTML 格式的重复数组报告
+func WriteDuplicateArraysHTML(w io.Writer, r *snapshot.DuplicateArraysReport) error {
+	return duplicateArraysHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,59 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const duplicateStringsText = `Duplicate Strings
+{{.TotalStrings}} strings, {{.DistinctValues}} distinct values, {{bytes .WastedBytes}} wasted{{if .Skipped}}, {{.Skipped}} unreadable strings skipped{{end}}
+{{range .Values}}
+{{printf "%q" .Value}}
+  {{.Count}} strings, {{.Arrays}} arrays, length {{.Length}}, {{bytes .WastedBytes}} wasted
+{{- range .Holders}}
+    {{.Count}} from {{.Class}}
+{{- end}}
+{{end}}`
+
+const duplicateStringsHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Duplicate Strings</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+.value { font-family: monospace; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Duplicate Strings</h1>
+<p>{{.TotalStrings}} strings, {{.DistinctValues}} distinct values, {{bytes .WastedBytes}} wasted{{if .Skipped}}, {{.Skipped}} unreadable strings skipped{{end}}</p>
+<table>
+<tr><th>Value</th><th>Length</th><th>Strings</th><th>Arrays</th><th>Wasted</th><th>Holders</th></tr>
+{{range .Values}}<tr>
+<td class="value">{{.Value}}</td><td>{{.Length}}</td><td>{{.Count}}</td><td>{{.Arrays}}</td><td>{{bytes .WastedBytes}}</td>
+<td>{{range .Holders}}<div>{{.Count}} from {{.Class}}</div>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var (
+	duplicateStringsTextTemplate = template.Must(template.New("duplicate-strings").Funcs(funcs).Parse(duplicateStringsText))
+	duplicateStringsHTMLTemplate = htmltemplate.Must(htmltemplate.New("duplicate-strings").Funcs(funcs).Parse(duplicateStringsHTML))
+)
+
+// WriteDuplicateStringsText 输出纯文本格式的重复字符串报告
+func WriteDuplicateStringsText(w io.Writer, r *snapshot.DuplicateStringsReport) error {
+	return duplicateStringsTextTemplate.Execute(w, r)
+}
+
+// WriteDuplicateStringsHTML 输出 HTML 格式的重复字符串报告
+func WriteDuplicateStringsHTML(w io.Writer, r *snapshot.DuplicateStringsReport) error {
+	return duplicateStringsHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,127 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const finalizersText = `Finalizers
+Pending finalization: {{.Pending.Count}} object(s) (queue length {{.QueueLength}}), shallow {{bytes .Pending.ShallowSize}}, retained {{bytes .Pending.RetainedSize}}
+Registered, not yet finalized: {{.Unfinalized.Count}} object(s), shallow {{bytes .Unfinalized.ShallowSize}}, retained {{bytes .Unfinalized.RetainedSize}}
+Pending references: {{.PendingReferences.Count}} reference(s)
+{{template "thread" (threadSection "Finalizer thread" .FinalizerThread)}}
+{{template "thread" (threadSection "Reference Handler thread" .ReferenceHandler)}}
+{{template "objects" (objectsSection "Objects pending finalization" .Pending)}}
+{{template "objects" (objectsSection "Objects not yet finalized" .Unfinalized)}}
+{{template "objects" (objectsSection "Pending references" .PendingReferences)}}
+{{- define "thread"}}
+{{.Title}}:
+{{- with .Thread}} "{{.Name}}"{{if .State}} {{.State}}{{end}}
+{{- range .Frames}}
+    at {{.Class}}.{{.Method}}({{if eq .Line -3}}Native Method{{else if .SourceFile}}{{.SourceFile}}{{if gt .Line 0}}:{{.Line}}{{end}}{{else}}Unknown Source{{end}})
+{{- end}}
+{{- else}} not found
+{{- end}}
+{{- end}}
+{{- define "objects"}}
+{{.Title}}:
+{{- if .Objects.Count}}
+  Classes:
+{{- range .Objects.Classes}}
+    {{.Class}}: {{.Count}} object(s), shallow {{bytes .ShallowSize}}, retained {{bytes .RetainedSize}}
+{{- end}}
+  Largest objects:
+{{- range .Objects.Objects}}
+    {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}, retained {{bytes .RetainedSize}}
+{{- end}}
+{{- else}} none
+{{- end}}
+{{- end}}`
+
+const finalizersHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Finalizers</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+.stack { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Finalizers</h1>
+<table>
+<tr><th></th><th>Count</th><th>Shallow</th><th>Retained</th></tr>
+<tr><td>Pending finalization (queue length {{.QueueLength}})</td><td>{{.Pending.Count}}</td><td>{{bytes .Pending.ShallowSize}}</td><td>{{bytes .Pending.RetainedSize}}</td></tr>
+<tr><td>Registered, not yet finalized</td><td>{{.Unfinalized.Count}}</td><td>{{bytes .Unfinalized.ShallowSize}}</td><td>{{bytes .Unfinalized.RetainedSize}}</td></tr>
+<tr><td>Pending references</td><td>{{.PendingReferences.Count}}</td><td>{{bytes .PendingReferences.ShallowSize}}</td><td>{{bytes .PendingReferences.RetainedSize}}</td></tr>
+</table>
+{{template "thread" (threadSection "Finalizer thread" .FinalizerThread)}}
+{{template "thread" (threadSection "Reference Handler thread" .ReferenceHandler)}}
+{{template "objects" (objectsSection "Objects pending finalization" .Pending)}}
+{{template "objects" (objectsSection "Objects not yet finalized" .Unfinalized)}}
+{{template "objects" (objectsSection "Pending references" .PendingReferences)}}
+</body>
+</html>
+{{- define "thread"}}
+<h2>{{.Title}}</h2>
+{{with .Thread}}<p>{{.Name}}{{if .State}} ({{.State}}){{end}}</p>
+<div class="stack">
+{{range .Frames}}<div>at {{.Class}}.{{.Method}}({{if eq .Line -3}}Native Method{{else if .SourceFile}}{{.SourceFile}}{{if gt .Line 0}}:{{.Line}}{{end}}{{else}}Unknown Source{{end}})</div>
+{{end}}</div>
+{{else}}<p>Not found</p>
+{{end}}
+{{- end}}
+{{- define "objects"}}
+<h2>{{.Title}}</h2>
+{{if .Objects.Count}}<table>
+<tr><th>Class</th><th>Count</th><th>Shallow</th><th>Retained</th></tr>
+{{range .Objects.Classes}}<tr><td>{{.Class}}</td><td>{{.Count}}</td><td>{{bytes .ShallowSize}}</td><td>{{bytes .RetainedSize}}</td></tr>
+{{end}}</table>
+<h3>Largest objects</h3>
+<table>
+<tr><th>Object</th><th>Retained</th></tr>
+{{range .Objects.Objects}}<tr><td>{{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}</td><td>{{bytes .RetainedSize}}</td></tr>
+{{end}}</table>
+{{else}}<p>None</p>
+{{end}}
+{{- end}}
+`
+
+type finalizerThreadSection struct {
+	Title  string
+	Thread *snapshot.ThreadInfo
+}
+
+type finalizerObjectsSection struct {
+	Title   string
+	Objects *snapshot.FinalizerObjects
+}
+
+var finalizersFuncs = map[string]interface{}{
+	"threadSection": func(title string, t *snapshot.ThreadInfo) finalizerThreadSection {
+		return finalizerThreadSection{Title: title, Thread: t}
+	},
+	"objectsSection": func(title string, o *snapshot.FinalizerObjects) finalizerObjectsSection {
+		return finalizerObjectsSection{Title: title, Objects: o}
+	},
+}
+
+var (
+	finalizersTextTemplate = template.Must(template.New("finalizers").Funcs(funcs).Funcs(finalizersFuncs).Parse(finalizersText))
+	finalizersHTMLTemplate = htmltemplate.Must(htmltemplate.New("finalizers").Funcs(funcs).Funcs(finalizersFuncs).Parse(finalizersHTML))
+)
+
+// WriteFinalizersText 输出纯文本格式的 finalizer 分析报告
+func WriteFinalizersText(w io.Writer, r *snapshot.FinalizersReport) error {
+	return finalizersTextTemplate.Execute(w, r)
+}
+
+// WriteFinalizersHTML 输出 HTML 格式的 finalizer 分析报告
+func WriteFinalizersHTML(w io.Writer, r *snapshot.FinalizersReport) error {
+	return finalizersHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,116 @@
+package report
+
+import (
+	"fmt"
+	"hprof-tool/pkg/snapshot"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// hprof 中 StackFrame 的特殊行号
+const (
+	lineUnknown  = -1
+	lineCompiled = -2
+	lineNative   = -3
+)
+
+const jstackText = `{{.Time}}
+Full thread dump (from heap dump):
+{{range .Threads}}
+"{{.Name}}" #{{.SerialNumber}}{{if .Daemon}} daemon{{end}} prio={{.Priority}} {{condition .}}
+{{- if .State}}
+   java.lang.Thread.State: {{.State}}{{stateDetail .}}
+{{- end}}
+{{- range .Frames}}
+	at {{.Class}}.{{.Method}}({{location .}})
+{{- range .Locals}}
+	- local {{object .}}
+{{- end}}
+{{- end}}
+{{- range .Locals}}
+	- local {{object .}}
+{{- end}}
+{{end}}`
+
+var jstackTemplate = template.Must(template.New("jstack").Funcs(template.FuncMap{
+	"location":    frameLocation,
+	"condition":   threadCondition,
+	"stateDetail": threadStateDetail,
+	"object":      localObject,
+}).Parse(jstackText))
+
+// WriteJStack 输出和 jstack 格式相同的线程 dump，每个栈帧下列出作为 GC root 的局部变量
+// heap dump 中没有 tid 和 nid，线程头只包含能从 dump 中读出的信息
+func WriteJStack(w io.Writer, dumpTime time.Time, threads []*snapshot.ThreadInfo) error {
+	// jstack 先输出最后创建的线程
+	sorted := append([]*snapshot.ThreadInfo(nil), threads...)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].SerialNumber > sorted[b].SerialNumber
+	})
+	return jstackTemplate.Execute(w, map[string]interface{}{
+		"Time":    dumpTime.Format("2006-01-02 15:04:05"),
+		"Threads": sorted,
+	})
+}
+
+// frameLocation 和 StackTraceElement.toString 中括号内的格式一致
+func frameLocation(f *snapshot.ThreadFrame) string {
+	switch {
+	case f.Line == lineNative:
+		return "Native Method"
+	case f.SourceFile == "":
+		return "Unknown Source"
+	case f.Line > 0:
+		return fmt.Sprintf("%s:%d", f.SourceFile, f.Line)
+	}
+	// lineUnknown 和 lineCompiled 只有文件名
+	return f.SourceFile
+}
+
+// topMethod 返回栈顶的方法名，比如 java.lang.Object.wait
+func topMethod(t *snapshot.ThreadInfo) string {
+	if len(t.Frames) == 0 {
+		return ""
+	}
+	return t.Frames[0].Class + "." + t.Frames[0].Method
+}
+
+func threadCondition(t *snapshot.ThreadInfo) string {
+	switch t.State {
+	case "RUNNABLE":
+		return "runnable"
+	case "BLOCKED":
+		return "waiting for monitor entry"
+	case "WAITING", "TIMED_WAITING":
+		if topMethod(t) == "java.lang.Object.wait" {
+			return "in Object.wait()"
+		}
+		return "waiting on condition"
+	case "NEW", "TERMINATED":
+		return strings.ToLower(t.State)
+	}
+	return ""
+}
+
+func threadStateDetail(t *snapshot.ThreadInfo) string {
+	switch top := topMethod(t); {
+	case t.State == "BLOCKED" || top == "java.lang.Object.wait":
+		return " (on object monitor)"
+	case top == "java.lang.Thread.sleep":
+		return " (sleeping)"
+	case strings.HasSuffix(top, "Unsafe.park"):
+		return " (parking)"
+	}
+	return ""
+}
+
+func localObject(o *snapshot.ObjectSize) string {
+	s := fmt.Sprintf("<0x%016x> (a %s)", o.Id, o.Class)
+	if o.Display != "" {
+		s += fmt.Sprintf(" %q", o.Display)
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const leakSuspectsText = `Leak Suspects
+Heap size: {{bytes .HeapSize}}, {{len .Suspects}} suspect(s)
+{{range $idx, $s := .Suspects}}
+Problem Suspect {{add $idx 1}}
+{{- if eq $s.Kind "object"}}
+  One instance of "{{$s.Class}}" (id {{$s.Id}}) occupies {{bytes $s.RetainedSize}} ({{printf "%.2f" $s.Percentage}}%).
+{{- else}}
+  {{$s.InstanceCount}} instances of "{{$s.Class}}" occupy {{bytes $s.RetainedSize}} ({{printf "%.2f" $s.Percentage}}%).
+{{- end}}
+{{- with $s.AccumulationPoint}}{{if ne .Id $s.Id}}
+  The memory is accumulated in one instance of "{{.Class}}" (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}, retaining {{bytes .RetainedSize}}.
+{{- end}}{{end}}
+{{- with $s.PathToGCRoot}}
+  Shortest path to GC root ({{join .RootTypes ", "}}{{if .Thread}}, thread "{{.Thread}}"{{end}}):
+{{- range .Nodes}}
+    {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}{{if .Field}} . {{.Field}}{{end}}
+{{- end}}
+{{- end}}
+{{- if $s.DominatedClasses}}
+  Dominated objects by class:
+{{- range $s.DominatedClasses}}
+    {{.Class}}: {{.Count}} object(s), {{bytes .RetainedSize}}
+{{- end}}
+{{- end}}
+{{end}}`
+
+const leakSuspectsHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Leak Suspects</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.path { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Leak Suspects</h1>
+<p>Heap size: {{bytes .HeapSize}}, {{len .Suspects}} suspect(s)</p>
+{{range $idx, $s := .Suspects}}
+<h2>Problem Suspect {{add $idx 1}}</h2>
+{{if eq $s.Kind "object"}}
+<p>One instance of <b>{{$s.Class}}</b> (id {{$s.Id}}) occupies <b>{{bytes $s.RetainedSize}}</b> ({{printf "%.2f" $s.Percentage}}%).</p>
+{{else}}
+<p>{{$s.InstanceCount}} instances of <b>{{$s.Class}}</b> occupy <b>{{bytes $s.RetainedSize}}</b> ({{printf "%.2f" $s.Percentage}}%).</p>
+{{end}}
+{{with $s.AccumulationPoint}}{{if ne .Id $s.Id}}
+<p>The memory is accumulated in one instance of <b>{{.Class}}</b> (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}, retaining {{bytes .RetainedSize}}.</p>
+{{end}}{{end}}
+{{with $s.PathToGCRoot}}
+<h3>Shortest path to GC root</h3>
+<p>{{join .RootTypes ", "}}{{if .Thread}}, thread "{{.Thread}}"{{end}}</p>
+<div class="path">
+{{range .Nodes}}<div>{{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}{{if .Field}} . {{.Field}}{{end}}</div>
+{{end}}</div>
+{{end}}
+{{if $s.DominatedClasses}}
+<h3>Dominated objects by class</h3>
+<table>
+<tr><th>Class</th><th>Objects</th><th>Retained size</th></tr>
+{{range $s.DominatedClasses}}<tr><td>{{.Class}}</td><td>{{.Count}}</td><td>{{bytes .RetainedSize}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`
+
+var (
+	leakSuspectsTextTemplate = template.Must(template.New("leak-suspects").Funcs(funcs).Parse(leakSuspectsText))
+	leakSuspectsHTMLTemplate = htmltemplate.Must(htmltemplate.New("leak-suspects").Funcs(funcs).Parse(leakSuspectsHTML))
+)
+
+// WriteLeakSuspectsText 输出纯文本格式的泄漏报告
+func WriteLeakSuspectsText(w io.Writer, r *snapshot.LeakSuspectsReport) error {
+	return leakSuspectsTextTemplate.Execute(w, r)
+}
+
+// WriteLeakSuspectsHTML 输出 HTML 格式的泄漏报告
+func WriteLeakSuspectsHTML(w io.Writer, r *snapshot.LeakSuspectsReport) error {
+	return leakSuspectsHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,87 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const locksText = `Locks
+{{len .Monitors}} monitor(s), {{len .Waits}} lock wait(s), {{len .Deadlocks}} deadlock(s)
+{{- range $idx, $d := .Deadlocks}}
+
+Deadlock {{add $idx 1}}{{if $d.Inferred}} (inferred from thread stacks){{end}}:
+{{- range $d.Waits}}
+  "{{.Thread.Name}}" waits for {{.Lock.Class}} (id {{.Lock.Id}}) held by "{{.Owner.Name}}"
+{{- end}}
+{{- end}}
+
+Monitors:
+{{- range .Monitors}}
+  {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}} [{{.Kind}}]
+{{- with .Owner}}
+    owned by "{{.Name}}"
+{{- end}}
+{{- range .OwnerCandidates}}
+    possibly owned by "{{.Name}}"{{if .State}} ({{.State}}){{end}}
+{{- end}}
+{{- range .Blocked}}
+    blocked: "{{.Name}}"{{if .State}} ({{.State}}){{end}}
+{{- end}}
+{{- range .Waiting}}
+    waiting: "{{.Name}}"{{if .State}} ({{.State}}){{end}}
+{{- end}}
+{{- end}}
+`
+
+const locksHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Locks</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Locks</h1>
+<p>{{len .Monitors}} monitor(s), {{len .Waits}} lock wait(s), {{len .Deadlocks}} deadlock(s)</p>
+{{range $idx, $d := .Deadlocks}}
+<h2>Deadlock {{add $idx 1}}{{if $d.Inferred}} (inferred from thread stacks){{end}}</h2>
+<table>
+<tr><th>Thread</th><th>Waits for</th><th>Held by</th></tr>
+{{range $d.Waits}}<tr><td>{{.Thread.Name}}</td><td>{{.Lock.Class}} (id {{.Lock.Id}})</td><td>{{.Owner.Name}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Monitors</h2>
+<table>
+<tr><th>Object</th><th>Kind</th><th>Owner</th><th>Possible owners</th><th>Blocked</th><th>Waiting</th></tr>
+{{range .Monitors}}<tr>
+<td>{{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}</td><td>{{.Kind}}</td>
+<td>{{with .Owner}}{{.Name}}{{end}}</td>
+<td>{{range .OwnerCandidates}}<div>{{.Name}}{{if .State}} ({{.State}}){{end}}</div>{{end}}</td>
+<td>{{range .Blocked}}<div>{{.Name}}{{if .State}} ({{.State}}){{end}}</div>{{end}}</td>
+<td>{{range .Waiting}}<div>{{.Name}}{{if .State}} ({{.State}}){{end}}</div>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var (
+	locksTextTemplate = template.Must(template.New("locks").Funcs(funcs).Parse(locksText))
+	locksHTMLTemplate = htmltemplate.Must(htmltemplate.New("locks").Funcs(funcs).Parse(locksHTML))
+)
+
+// WriteLocksText 输出纯文本格式的锁分析报告
+func WriteLocksText(w io.Writer, r *snapshot.LocksReport) error {
+	return locksTextTemplate.Execute(w, r)
+}
+
+// WriteLocksHTML 输出 HTML 格式的锁分析报告
+func WriteLocksHTML(w io.Writer, r *snapshot.LocksReport) error {
+	return locksHTMLTemplate.Execute(w, r)
+}
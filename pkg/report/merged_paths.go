@@ -0,0 +1,74 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+)
+
+const mergedPathsText = `Merged paths to GC roots
+{{.Objects}} object(s){{if lt .Analyzed .Objects}}, paths computed for {{.Analyzed}}{{end}}, {{bytes .TargetSize}}
+{{- if .Unreachable}}
+{{.Unreachable}} object(s) not reachable from GC roots
+{{- end}}
+{{range .Lines}}
+{{.Indent}}{{with .Node}}{{if .Field}}{{.Field}} in {{end}}{{.Class}}{{if .RootTypes}} [{{join .RootTypes ", "}}]{{end}}: {{.Targets}} target(s), {{bytes .TargetSize}}; {{.Objects}} object(s), {{bytes .ShallowSize}}{{end}}
+{{- end}}
+`
+
+const mergedPathsHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Merged paths to GC roots</title>
+<style>
+body { font-family: sans-serif; }
+ul { list-style: none; padding-left: 1.5em; }
+</style>
+</head>
+<body>
+<h1>Merged paths to GC roots</h1>
+<p>{{.Objects}} object(s){{if lt .Analyzed .Objects}}, paths computed for {{.Analyzed}}{{end}}, {{bytes .TargetSize}}</p>
+{{if .Unreachable}}<p>{{.Unreachable}} object(s) not reachable from GC roots</p>
+{{end}}{{template "nodes" .Roots}}
+</body>
+</html>
+{{define "nodes"}}{{if .}}<ul>
+{{range .}}<li>{{if .Field}}{{.Field}} in {{end}}<b>{{.Class}}</b>{{if .RootTypes}} [{{join .RootTypes ", "}}]{{end}}: {{.Targets}} target(s), {{bytes .TargetSize}}; {{.Objects}} object(s), {{bytes .ShallowSize}}
+{{template "nodes" .Children}}</li>
+{{end}}</ul>
+{{end}}{{end}}`
+
+var (
+	mergedPathsTextTemplate = template.Must(template.New("merged-paths").Funcs(funcs).Parse(mergedPathsText))
+	mergedPathsHTMLTemplate = htmltemplate.Must(htmltemplate.New("merged-paths").Funcs(funcs).Parse(mergedPathsHTML))
+)
+
+// mergedPathLine 纯文本格式中路径树的一行，按层级缩进
+type mergedPathLine struct {
+	Indent string
+	Node   *snapshot.MergedPathNode
+}
+
+func flattenMergedPaths(nodes []*snapshot.MergedPathNode, depth int, lines []mergedPathLine) []mergedPathLine {
+	for _, node := range nodes {
+		lines = append(lines, mergedPathLine{strings.Repeat("  ", depth), node})
+		lines = flattenMergedPaths(node.Children, depth+1, lines)
+	}
+	return lines
+}
+
+// WriteMergedPathsText 输出纯文本格式的合并路径报告
+func WriteMergedPathsText(w io.Writer, r *snapshot.MergedPathsReport) error {
+	return mergedPathsTextTemplate.Execute(w, struct {
+		*snapshot.MergedPathsReport
+		Lines []mergedPathLine
+	}{r, flattenMergedPaths(r.Roots, 0, nil)})
+}
+
+// WriteMergedPathsHTML 输出 HTML 格式的合并路径报告
+func WriteMergedPathsHTML(w io.Writer, r *snapshot.MergedPathsReport) error {
+	return mergedPathsHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,105 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const offHeapText = `Off-heap Memory
+Estimated native memory referenced from the heap: {{bytes .EstimatedNativeMemory}}
+  {{.DirectCount}} direct buffer(s), {{bytes .DirectCapacity}}
+  {{.PendingCount}} pending cleanup, {{bytes .PendingCapacity}}
+  {{.MappedCount}} mapped, {{bytes .MappedCapacity}}
+  {{.ViewCount}} slice(s) or view(s) sharing memory
+{{- if ge .ReservedMemory 0}}
+java.nio.Bits: reserved {{bytes .ReservedMemory}}, capacity {{bytes .TotalCapacity}}, {{.BufferCount}} buffer(s){{if ge .MaxDirectMemory 0}}, max {{bytes .MaxDirectMemory}}{{end}}
+{{- end}}
+{{- if ge .NettyDirectMemory 0}}
+Netty direct memory counter: {{bytes .NettyDirectMemory}}
+{{- end}}
+
+Owners:
+{{- range .Owners}}
+  {{.Class}}: {{.Count}} buffer(s), {{bytes .Capacity}}
+{{- end}}
+
+Largest buffers:
+{{- range .Buffers}}
+  {{.Class}} (id {{.Id}}) capacity {{bytes .Capacity}}, address {{printf "0x%x" .Address}}, {{.State}}{{if .Mapped}}, mapped{{end}}
+{{- with .Owner}}{{if .Id}}
+    owner {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}
+{{- else}}
+    owner {{.Class}}
+{{- end}}{{end}}
+{{- end}}
+{{- if .NettyArenas}}
+
+Netty direct arenas:
+{{- range .NettyArenas}}
+  {{.Class}} (id {{.Id}}): {{.Chunks}} chunk(s), {{bytes .ChunkSize}}, free {{bytes .FreeBytes}}
+{{- end}}
+{{- end}}
+`
+
+const offHeapHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Off-heap Memory</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Off-heap Memory</h1>
+<p>Estimated native memory referenced from the heap: {{bytes .EstimatedNativeMemory}}</p>
+<table>
+<tr><th></th><th>Buffers</th><th>Capacity</th></tr>
+<tr><td>Direct buffers</td><td>{{.DirectCount}}</td><td>{{bytes .DirectCapacity}}</td></tr>
+<tr><td>Pending cleanup</td><td>{{.PendingCount}}</td><td>{{bytes .PendingCapacity}}</td></tr>
+<tr><td>Mapped</td><td>{{.MappedCount}}</td><td>{{bytes .MappedCapacity}}</td></tr>
+<tr><td>Slices and views</td><td>{{.ViewCount}}</td><td></td></tr>
+</table>
+{{if ge .ReservedMemory 0}}<p>java.nio.Bits: reserved {{bytes .ReservedMemory}}, capacity {{bytes .TotalCapacity}}, {{.BufferCount}} buffer(s){{if ge .MaxDirectMemory 0}}, max {{bytes .MaxDirectMemory}}{{end}}</p>
+{{end}}{{if ge .NettyDirectMemory 0}}<p>Netty direct memory counter: {{bytes .NettyDirectMemory}}</p>
+{{end}}
+<h2>Owners</h2>
+<table>
+<tr><th>Owner</th><th>Buffers</th><th>Capacity</th></tr>
+{{range .Owners}}<tr><td>{{.Class}}</td><td>{{.Count}}</td><td>{{bytes .Capacity}}</td></tr>
+{{end}}</table>
+<h2>Largest buffers</h2>
+<table>
+<tr><th>Buffer</th><th>Capacity</th><th>Address</th><th>State</th><th>Mapped</th><th>Owner</th></tr>
+{{range .Buffers}}<tr><td>{{.Class}} (id {{.Id}})</td><td>{{bytes .Capacity}}</td><td>{{printf "0x%x" .Address}}</td><td>{{.State}}</td><td>{{.Mapped}}</td>
+<td>{{with .Owner}}{{.Class}}{{if .Id}} (id {{.Id}}){{end}}{{if .Display}} "{{.Display}}"{{end}}{{end}}</td></tr>
+{{end}}</table>
+{{if .NettyArenas}}
+<h2>Netty direct arenas</h2>
+<table>
+<tr><th>Arena</th><th>Chunks</th><th>Size</th><th>Free</th></tr>
+{{range .NettyArenas}}<tr><td>{{.Class}} (id {{.Id}})</td><td>{{.Chunks}}</td><td>{{bytes .ChunkSize}}</td><td>{{bytes .FreeBytes}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`
+
+var (
+	offHeapTextTemplate = template.Must(template.New("off-heap").Funcs(funcs).Parse(offHeapText))
+	offHeapHTMLTemplate = htmltemplate.Must(htmltemplate.New("off-heap").Funcs(funcs).Parse(offHeapHTML))
+)
+
+// WriteOffHeapText 输出纯文本格式的堆外内存报告
+func WriteOffHeapText(w io.Writer, r *snapshot.OffHeapReport) error {
+	return offHeapTextTemplate.Execute(w, r)
+}
+
+// WriteOffHeapHTML 输出 HTML 格式的堆外内存报告
+func WriteOffHeapHTML(w io.Writer, r *snapshot.OffHeapReport) error {
+	return offHeapHTMLTemplate.Execute(w, r)
+}
@@ -0,0 +1,29 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatBytes 把字节数转换成 KB、MB 这类便于阅读的格式
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+var funcs = map[string]interface{}{
+	"bytes": FormatBytes,
+	"join":  strings.Join,
+	"add":   func(a, b int) int { return a + b },
+	"percent": func(ratio float64) string {
+		return fmt.Sprintf("%.1f%%", ratio*100)
+	},
+}
@@ -0,0 +1,52 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const staticFieldsText = `Static fields
+{{.Count}} non-null static reference field(s), {{bytes .ExclusiveSize}} retained exclusively by classes
+{{range .Fields}}
+{{bytes .RetainedSize}}{{if not .Exclusive}} (shared){{end}}  {{.Class}}.{{.Field}} -> {{with .Value}}{{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}{{end}}
+{{- end}}
+`
+
+const staticFieldsHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Static fields</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Static fields</h1>
+<p>{{.Count}} non-null static reference field(s), {{bytes .ExclusiveSize}} retained exclusively by classes</p>
+<table>
+<tr><th>Retained</th><th>Exclusive</th><th>Class</th><th>Field</th><th>Value</th></tr>
+{{range .Fields}}<tr><td>{{bytes .RetainedSize}}</td><td>{{.Exclusive}}</td><td>{{.Class}}</td><td>{{.Field}}</td><td>{{with .Value}}{{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`
+
+var (
+	staticFieldsTextTemplate = template.Must(template.New("static-fields").Funcs(funcs).Parse(staticFieldsText))
+	staticFieldsHTMLTemplate = htmltemplate.Must(htmltemplate.New("static-fields").Funcs(funcs).Parse(staticFieldsHTML))
+)
+
+// WriteStaticFieldsText 输出纯文本格式的静态字段报告
+func WriteStaticFieldsText(w io.Writer, r *snapshot.StaticFieldsReport) error {
+	return staticFieldsTextTemplate.Execute(w, r)
+}
+
+// WriteStaticFieldsHTML 输出 HTML 格式的静态字段报告
+func WriteStaticFieldsHTML(w io.Writer, r *snapshot.StaticFieldsReport) error {
+	return staticFieldsHTMLTemplate.Execute(w, r)
+}
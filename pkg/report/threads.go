@@ -0,0 +1,71 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const threadsText = `Threads
+{{len .}} thread(s)
+{{range .}}
+"{{.Name}}" #{{.SerialNumber}}{{if .Daemon}} daemon{{end}} prio={{.Priority}}{{if .Group}} group="{{.Group}}"{{end}}{{if .State}} {{.State}}{{end}}
+  Retained: {{bytes .RetainedSize}} by the thread object (id {{.ObjectId}}), {{bytes .LocalsRetainedSize}} by local variables
+{{- range .Frames}}
+    at {{template "frame" .}}
+{{- range .Locals}}
+      local {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}, retained {{bytes .RetainedSize}}
+{{- end}}
+{{- end}}
+{{- range .Locals}}
+    local {{.Class}} (id {{.Id}}){{if .Display}} {{printf "%q" .Display}}{{end}}, retained {{bytes .RetainedSize}}
+{{- end}}
+{{end}}
+{{- define "frame"}}{{.Class}}.{{.Method}}({{if eq .Line -3}}Native Method{{else if .SourceFile}}{{.SourceFile}}{{if gt .Line 0}}:{{.Line}}{{end}}{{else}}Unknown Source{{end}}){{end}}`
+
+const threadsHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Threads</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+.stack { font-family: monospace; }
+.local { padding-left: 2em; color: #555; }
+</style>
+</head>
+<body>
+<h1>Threads</h1>
+<table>
+<tr><th>Name</th><th>Group</th><th>Daemon</th><th>Priority</th><th>State</th><th>Retained</th><th>Locals retained</th></tr>
+{{range .}}<tr><td><a href="#thread-{{.SerialNumber}}">{{.Name}}</a></td><td>{{.Group}}</td><td>{{.Daemon}}</td><td>{{.Priority}}</td><td>{{.State}}</td><td>{{bytes .RetainedSize}}</td><td>{{bytes .LocalsRetainedSize}}</td></tr>
+{{end}}</table>
+{{range .}}
+<h2 id="thread-{{.SerialNumber}}">{{.Name}}</h2>
+<div class="stack">
+{{range .Frames}}<div>at {{.Class}}.{{.Method}}({{if eq .Line -3}}Native Method{{else if .SourceFile}}{{.SourceFile}}{{if gt .Line 0}}:{{.Line}}{{end}}{{else}}Unknown Source{{end}})</div>
+{{range .Locals}}<div class="local">local {{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}, retained {{bytes .RetainedSize}}</div>
+{{end}}{{end}}{{range .Locals}}<div class="local">local {{.Class}} (id {{.Id}}){{if .Display}} "{{.Display}}"{{end}}, retained {{bytes .RetainedSize}}</div>
+{{end}}</div>
+{{end}}
+</body>
+</html>
+`
+
+var (
+	threadsTextTemplate = template.Must(template.New("threads").Funcs(funcs).Parse(threadsText))
+	threadsHTMLTemplate = htmltemplate.Must(htmltemplate.New("threads").Funcs(funcs).Parse(threadsHTML))
+)
+
+// WriteThreadsText 输出纯文本格式的线程概览
+func WriteThreadsText(w io.Writer, r []*snapshot.ThreadInfo) error {
+	return threadsTextTemplate.Execute(w, r)
+}
+
+// WriteThreadsHTML 输出 HTML 格式的线程概览
+func WriteThreadsHTML(w io.Writer, r []*snapshot.ThreadInfo) error {
+	return threadsHTMLTemplate.Execute(w, r)
+}
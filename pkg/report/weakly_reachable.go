@@ -0,0 +1,63 @@
+package report
+
+import (
+	"hprof-tool/pkg/snapshot"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+const weaklyReachableText = `Weakly reachable objects
+{{.Count}} object(s), {{bytes .ShallowSize}} only reachable through soft, weak, finalizer or phantom references
+Reachability follows: {{range $idx, $s := .ReachabilityStrengths}}{{if $idx}}, {{end}}{{$s}}{{end}}
+Retained sizes follow: {{range $idx, $s := .DominatorStrengths}}{{if $idx}}, {{end}}{{$s}}{{end}}
+{{- range .Strengths}}
+
+{{.Strength}}: {{.Count}} object(s), {{bytes .ShallowSize}}
+{{- range .Classes}}
+  {{.Class}}: {{.Count}} object(s), {{bytes .ShallowSize}}
+{{- end}}
+{{- end}}
+`
+
+const weaklyReachableHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Weakly reachable objects</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Weakly reachable objects</h1>
+<p>{{.Count}} object(s), {{bytes .ShallowSize}} only reachable through soft, weak, finalizer or phantom references</p>
+<p>Reachability follows: {{range $idx, $s := .ReachabilityStrengths}}{{if $idx}}, {{end}}{{$s}}{{end}}<br>
+Retained sizes follow: {{range $idx, $s := .DominatorStrengths}}{{if $idx}}, {{end}}{{$s}}{{end}}</p>
+{{range .Strengths}}
+<h2>{{.Strength}}: {{.Count}} object(s), {{bytes .ShallowSize}}</h2>
+<table>
+<tr><th>Class</th><th>Objects</th><th>Shallow</th></tr>
+{{range .Classes}}<tr><td>{{.Class}}</td><td>{{.Count}}</td><td>{{bytes .ShallowSize}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`
+
+var (
+	weaklyReachableTextTemplate = template.Must(template.New("weakly-reachable").Funcs(funcs).Parse(weaklyReachableText))
+	weaklyReachableHTMLTemplate = htmltemplate.Must(htmltemplate.New("weakly-reachable").Funcs(funcs).Parse(weaklyReachableHTML))
+)
+
+// WriteWeaklyReachableText 输出纯文本格式的弱可达对象报告
+func WriteWeaklyReachableText(w io.Writer, r *snapshot.WeaklyReachableReport) error {
+	return weaklyReachableTextTemplate.Execute(w, r)
+}
+
+// WriteWeaklyReachableHTML 输出 HTML 格式的弱可达对象报告
+func WriteWeaklyReachableHTML(w io.Writer, r *snapshot.WeaklyReachableReport) error {
+	return weaklyReachableHTMLTemplate.Execute(w, r)
+}
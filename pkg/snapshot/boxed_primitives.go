@@ -0,0 +1,313 @@
+package snapshot
+
+import (
+	"errors"
+	"hprof-tool/pkg/hprof"
+	"sort"
+)
+
+// boxedType 包装类和 JDK 缓存的信息
+type boxedType struct {
+	class     string
+	primitive hprof.HProfValueType
+	// 缓存所在的类和静态字段，为空表示没有缓存
+	cacheClass string
+	cacheField string
+	// valueOf 会使用缓存的范围
+	low, high int64
+}
+
+var boxedTypes = []*boxedType{
+	{"java.lang.Boolean", hprof.HProfValueType_BOOLEAN, "", "", 0, 1},
+	{"java.lang.Byte", hprof.HProfValueType_BYTE, "java.lang.Byte$ByteCache", "cache", -128, 127},
+	{"java.lang.Short", hprof.HProfValueType_SHORT, "java.lang.Short$ShortCache", "cache", -128, 127},
+	{"java.lang.Character", hprof.HProfValueType_CHAR, "java.lang.Character$CharacterCache", "cache", 0, 127},
+	{"java.lang.Integer", hprof.HProfValueType_INT, "java.lang.Integer$IntegerCache", "cache", -128, 127},
+	{"java.lang.Long", hprof.HProfValueType_LONG, "java.lang.Long$LongCache", "cache", -128, 127},
+	{"java.lang.Float", hprof.HProfValueType_FLOAT, "", "", 1, 0},
+	{"java.lang.Double", hprof.HProfValueType_DOUBLE, "", "", 1, 0},
+}
+
+// collectionBaseClassNames 集合类的公共父类，用于判断装箱对象属于哪个集合
+var collectionBaseClassNames = map[string]bool{
+	"java.util.AbstractCollection": true,
+	"java.util.AbstractMap":        true,
+	"java.util.Dictionary":         true,
+}
+
+type BoxedPrimitivesOptions struct {
+	// 最多列出的持有装箱对象的集合类个数
+	MaxOwners int
+	// 沿支配树向上查找集合的最大层数
+	MaxOwnerDepth int
+	Reachability  Reachability
+}
+
+func DefaultBoxedPrimitivesOptions() *BoxedPrimitivesOptions {
+	return &BoxedPrimitivesOptions{
+		MaxOwners:     20,
+		MaxOwnerDepth: 8,
+		Reachability:  ReachableObjects,
+	}
+}
+
+// BoxedTypeStatistics 一种包装类所有实例的汇总
+type BoxedTypeStatistics struct {
+	Class       string `json:"class"`
+	Count       int64  `json:"count"`
+	ShallowSize int64  `json:"shallowSize"`
+	// 值在 JDK 缓存范围内但不是缓存中的实例，通常是 new Integer(x) 这种写法创建的
+	UncachedInRange      int64 `json:"uncachedInRange"`
+	UncachedInRangeBytes int64 `json:"uncachedInRangeBytes"`
+	// 被集合持有的实例个数
+	InCollections int64 `json:"inCollections"`
+	// 集合改用基本类型实现时节省的字节数
+	EstimatedSaving int64 `json:"estimatedSaving"`
+}
+
+// BoxedOwner 持有装箱对象的集合类
+type BoxedOwner struct {
+	Class string `json:"class"`
+	// 持有装箱对象的集合个数
+	Collections int64 `json:"collections"`
+	Count       int64 `json:"count"`
+	ShallowSize int64 `json:"shallowSize"`
+	// 各包装类的实例个数
+	Types           map[string]int64 `json:"types"`
+	EstimatedSaving int64            `json:"estimatedSaving"`
+}
+
+type BoxedPrimitivesReport struct {
+	Count                int64                  `json:"count"`
+	ShallowSize          int64                  `json:"shallowSize"`
+	UncachedInRangeBytes int64                  `json:"uncachedInRangeBytes"`
+	EstimatedSaving      int64                  `json:"estimatedSaving"`
+	Types                []*BoxedTypeStatistics `json:"types"`
+	Owners               []*BoxedOwner          `json:"owners"`
+}
+
+// AnalyzeBoxedPrimitives 统计装箱对象，找出没有使用 JDK 缓存的实例，
+// 并沿支配树找到持有装箱对象的集合，估算改用基本类型集合可以节省的内存
+// 节省的字节数是装箱对象本身加上引用和基本类型大小的差，缓存中的实例是共享的，不计算在内
+func (s *Snapshot) AnalyzeBoxedPrimitives(opts *BoxedPrimitivesOptions) (*BoxedPrimitivesReport, error) {
+	if opts == nil {
+		opts = DefaultBoxedPrimitivesOptions()
+	}
+	layout := s.ObjectLayout()
+	refSize := int64(layout.ReferenceSize())
+	report := &BoxedPrimitivesReport{}
+	owners := map[string]*BoxedOwner{}
+	ownerCollections := map[uint64]bool{}
+	finder := &collectionFinder{s: s, maxDepth: opts.MaxOwnerDepth, classes: map[uint64]string{}}
+
+	for _, bt := range boxedTypes {
+		cid := s.i.GetClassIdByName(bt.class)
+		if cid == 0 {
+			continue
+		}
+		cached, high, err := s.readBoxCache(bt)
+		if err != nil {
+			return nil, err
+		}
+		type boxObject struct {
+			id   uint64
+			size int64
+		}
+		var objects []boxObject
+		err = s.i.GetInstancesStatistics(cid, hprof.HProfHDRecordTypeInstanceDump, opts.Reachability, func(id uint64, size, retained int64) error {
+			objects = append(objects, boxObject{id, size})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(objects) == 0 {
+			continue
+		}
+
+		statistics := &BoxedTypeStatistics{Class: bt.class}
+		saving := refSize - int64(layout.ValueSize(bt.primitive))
+		for _, o := range objects {
+			statistics.Count++
+			statistics.ShallowSize += o.size
+			if cached[o.id] {
+				continue
+			}
+			_, fields, err := s.ReadFields(o.id)
+			if err != nil {
+				return nil, err
+			}
+			if value, ok := boxedValue(fields); ok && value >= bt.low && value <= high {
+				statistics.UncachedInRange++
+				statistics.UncachedInRangeBytes += o.size
+			}
+
+			cid, class, err := finder.find(o.id)
+			if err != nil {
+				return nil, err
+			}
+			if cid == 0 {
+				continue
+			}
+			statistics.InCollections++
+			statistics.EstimatedSaving += o.size + saving
+			owner, exist := owners[class]
+			if !exist {
+				owner = &BoxedOwner{Class: class, Types: map[string]int64{}}
+				owners[class] = owner
+			}
+			if !ownerCollections[cid] {
+				ownerCollections[cid] = true
+				owner.Collections++
+			}
+			owner.Count++
+			owner.ShallowSize += o.size
+			owner.Types[bt.class]++
+			owner.EstimatedSaving += o.size + saving
+		}
+		report.Count += statistics.Count
+		report.ShallowSize += statistics.ShallowSize
+		report.UncachedInRangeBytes += statistics.UncachedInRangeBytes
+		report.EstimatedSaving += statistics.EstimatedSaving
+		report.Types = append(report.Types, statistics)
+	}
+	sort.Slice(report.Types, func(a, b int) bool {
+		if report.Types[a].ShallowSize != report.Types[b].ShallowSize {
+			return report.Types[a].ShallowSize > report.Types[b].ShallowSize
+		}
+		return report.Types[a].Class < report.Types[b].Class
+	})
+
+	for _, owner := range owners {
+		report.Owners = append(report.Owners, owner)
+	}
+	sort.Slice(report.Owners, func(a, b int) bool {
+		if report.Owners[a].EstimatedSaving != report.Owners[b].EstimatedSaving {
+			return report.Owners[a].EstimatedSaving > report.Owners[b].EstimatedSaving
+		}
+		return report.Owners[a].Class < report.Owners[b].Class
+	})
+	if opts.MaxOwners > 0 && len(report.Owners) > opts.MaxOwners {
+		report.Owners = report.Owners[:opts.MaxOwners]
+	}
+	return report, nil
+}
+
+// readBoxCache 返回 JDK 缓存中的所有实例，Boolean 使用 TRUE 和 FALSE 两个静态字段
+// Integer 的缓存上限可以通过 java.lang.Integer.IntegerCache.high 修改，返回实际的上限
+func (s *Snapshot) readBoxCache(bt *boxedType) (map[uint64]bool, int64, error) {
+	cached := map[uint64]bool{}
+	high := bt.high
+	if bt.cacheClass == "" {
+		if bt.primitive != hprof.HProfValueType_BOOLEAN {
+			return cached, high, nil
+		}
+		fields, err := s.i.GetStaticFields(s.i.GetClassIdByName(bt.class))
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, sf := range fields {
+			if sf.Type == hprof.HProfValueType_OBJECT && (sf.Name == "TRUE" || sf.Name == "FALSE") {
+				cached[sf.Value] = true
+			}
+		}
+		return cached, high, nil
+	}
+
+	cid := s.i.GetClassIdByName(bt.cacheClass)
+	if cid == 0 {
+		// 缓存类还没有加载
+		return cached, high, nil
+	}
+	fields, err := s.i.GetStaticFields(cid)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, sf := range fields {
+		switch {
+		case sf.Name == bt.cacheField && sf.Type == hprof.HProfValueType_OBJECT && sf.Value != 0:
+			elements, err := s.i.GetObjectArrayElements(sf.Value)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, id := range elements {
+				if id != 0 {
+					cached[id] = true
+				}
+			}
+		case sf.Name == "high" && sf.Type == hprof.HProfValueType_INT:
+			high = int64(int32(sf.Value))
+		}
+	}
+	return cached, high, nil
+}
+
+// boxedValue 返回整数和 boolean 包装类的值，浮点数没有缓存，返回 false
+func boxedValue(fields FieldValues) (int64, bool) {
+	if v, ok := fields["value"].(*hprof.HProfInstanceBooleanValue); ok {
+		if v.Value {
+			return 1, true
+		}
+		return 0, true
+	}
+	return fields.Integer("value")
+}
+
+// collectionFinder 沿支配树向上查找最近的集合
+type collectionFinder struct {
+	s        *Snapshot
+	maxDepth int
+	// 类 id 到集合类名的缓存，不是集合的类保存为空字符串
+	classes map[uint64]string
+}
+
+// find 返回支配 id 的最近的集合和它的类名，没有找到时返回 0
+func (f *collectionFinder) find(id uint64) (uint64, string, error) {
+	for depth := 0; depth < f.maxDepth; depth++ {
+		dominator, _, err := f.s.i.GetDominator(id)
+		if errors.Is(err, ErrNotFound) {
+			// 不可达的对象没有支配信息
+			return 0, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		if dominator == 0 {
+			return 0, "", nil
+		}
+		cid, err := f.s.i.GetObjectClassId(dominator)
+		if err != nil {
+			return 0, "", err
+		}
+		if cid != 0 {
+			class, err := f.collectionClass(cid)
+			if err != nil {
+				return 0, "", err
+			}
+			if class != "" {
+				return dominator, class, nil
+			}
+		}
+		id = dominator
+	}
+	return 0, "", nil
+}
+
+func (f *collectionFinder) collectionClass(cid uint64) (string, error) {
+	if class, exist := f.classes[cid]; exist {
+		return class, nil
+	}
+	names, err := f.s.i.GetSuperClassNames(cid)
+	if err != nil {
+		return "", err
+	}
+	class := ""
+	for _, name := range names {
+		if collectionBaseClassNames[name] {
+			class = names[0]
+			break
+		}
+	}
+	f.classes[cid] = class
+	return class, nil
+}
@@ -0,0 +1,159 @@
+package snapshot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ClassGrouping 类统计的分组方式
+type ClassGrouping string
+
+const (
+	// GroupByPackage 按包名前缀分组
+	GroupByPackage ClassGrouping = "package"
+	// GroupByClassLoader 按加载类的 ClassLoader 分组
+	GroupByClassLoader ClassGrouping = "loader"
+	// GroupBySuperclass 按父类分组，每个类计入自己和所有父类，hprof 中没有记录类实现的接口
+	GroupBySuperclass ClassGrouping = "superclass"
+)
+
+const (
+	defaultPackageName       = "<default>"
+	primitiveArraysGroupName = "<primitive arrays>"
+)
+
+// ParseClassGrouping 解析 package、loader、superclass
+func ParseClassGrouping(s string) (ClassGrouping, error) {
+	switch g := ClassGrouping(s); g {
+	case GroupByPackage, GroupByClassLoader, GroupBySuperclass:
+		return g, nil
+	}
+	return "", fmt.Errorf("unknown class grouping: %s", s)
+}
+
+// ClassGroupStatistics 一组类的汇总
+// RetainedSize 是各个类的 retained size 之和，组内的类互相持有时会重复计算
+type ClassGroupStatistics struct {
+	Name          string
+	ClassCount    int64
+	InstanceCount int64
+	InstanceSize  int64
+	RetainedSize  int64
+}
+
+// GroupClassesStatistics 按 grouping 汇总 ListClassesStatistics 的结果，按 shallow size 降序
+// 按包名分组时 level 是保留的包名层数，比如 level 为 2 时 com.acme.cache.Foo 计入 com.acme，0 表示完整的包名
+func (s *Snapshot) GroupClassesStatistics(reachability Reachability, grouping ClassGrouping, level int) ([]ClassGroupStatistics, error) {
+	classes, err := s.ListClassesStatistics(reachability)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string]*ClassGroupStatistics{}
+	add := func(name string, c ClassStatistics) {
+		g, exist := groups[name]
+		if !exist {
+			g = &ClassGroupStatistics{Name: name}
+			groups[name] = g
+		}
+		g.ClassCount++
+		g.InstanceCount += c.InstanceCount
+		g.InstanceSize += c.InstanceSize
+		g.RetainedSize += c.RetainedSize
+	}
+	loaderNames := map[uint64]string{}
+	for _, c := range classes {
+		primitiveArray := strings.HasSuffix(c.Name, "[]")
+		switch grouping {
+		case GroupByPackage:
+			if primitiveArray {
+				add(primitiveArraysGroupName, c)
+				continue
+			}
+			add(packagePrefix(c.Name, level), c)
+		case GroupByClassLoader:
+			var loader uint64
+			if !primitiveArray {
+				loader, err = s.i.GetClassLoaderId(c.Id)
+				if err != nil {
+					return nil, err
+				}
+			}
+			name, exist := loaderNames[loader]
+			if !exist {
+				name, err = s.classLoaderName(loader)
+				if err != nil {
+					return nil, err
+				}
+				loaderNames[loader] = name
+			}
+			add(name, c)
+		case GroupBySuperclass:
+			if primitiveArray {
+				add(c.Name, c)
+				continue
+			}
+			names, err := s.i.GetSuperClassNames(c.Id)
+			if err != nil {
+				return nil, err
+			}
+			if len(names) == 0 {
+				add(c.Name, c)
+				continue
+			}
+			// 数组类的名字和 GetSuperClassNames 的第一个元素格式不同，使用统计中的类名
+			add(c.Name, c)
+			for _, name := range names[1:] {
+				add(name, c)
+			}
+		default:
+			return nil, fmt.Errorf("unknown class grouping: %s", grouping)
+		}
+	}
+
+	result := make([]ClassGroupStatistics, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].InstanceSize != result[j].InstanceSize {
+			return result[i].InstanceSize > result[j].InstanceSize
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// packagePrefix 返回类的包名的前 level 段，数组使用元素类型的包名
+func packagePrefix(className string, level int) string {
+	name := strings.TrimLeft(className, "[")
+	if name != className {
+		// [Ljava.lang.String; 这种格式的数组类名
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "L"), ";")
+	}
+	idx := strings.LastIndex(name, ".")
+	if idx < 0 {
+		return defaultPackageName
+	}
+	pkg := name[:idx]
+	if level <= 0 {
+		return pkg
+	}
+	parts := strings.SplitN(pkg, ".", level+1)
+	if len(parts) > level {
+		parts = parts[:level]
+	}
+	return strings.Join(parts, ".")
+}
+
+// classLoaderName 返回 ClassLoader 的类名和 id
+func (s *Snapshot) classLoaderName(id uint64) (string, error) {
+	if id == 0 {
+		return bootstrapClassLoaderName, nil
+	}
+	class, err := s.i.GetObjectClassName(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@0x%x", class, id), nil
+}
@@ -0,0 +1,276 @@
+package snapshot
+
+import (
+	"errors"
+	"hprof-tool/pkg/hprof"
+	"sort"
+	"strings"
+)
+
+// bootstrapClassLoaderName 由 bootstrap ClassLoader 加载的类 ClassLoaderObjectId 为 0
+const bootstrapClassLoaderName = "<bootstrap>"
+
+type ClassLoadersOptions struct {
+	// 到 GC root 的路径不超过 MaxPaths 条并且加载了重复类的 ClassLoader 被认为可能泄漏
+	MaxPaths int
+	// 最多列出的重复类个数
+	MaxDuplicates int
+	// 统计实例个数和大小时使用的可达性
+	Reachability Reachability
+}
+
+func DefaultClassLoadersOptions() *ClassLoadersOptions {
+	return &ClassLoadersOptions{
+		MaxPaths:      1,
+		MaxDuplicates: 100,
+		Reachability:  ReachableObjects,
+	}
+}
+
+// ClassLoaderInfo 一个 ClassLoader 和它加载的类
+type ClassLoaderInfo struct {
+	Id      uint64 `json:"id"`
+	Class   string `json:"class"`
+	Display string `json:"display,omitempty"`
+	// 加载的类的个数
+	ClassCount int64 `json:"classCount"`
+	// 加载的类的实例个数和 shallow size
+	InstanceCount int64 `json:"instanceCount"`
+	InstanceSize  int64 `json:"instanceSize"`
+	// ClassLoader 对象、加载的类和类的可达实例的 retained size 之和，
+	// 被其中其他对象支配的对象不重复计算，bootstrap ClassLoader 只包括类和实例
+	RetainedSize int64 `json:"retainedSize"`
+	// 同名的类也被其他 ClassLoader 加载的类个数
+	DuplicateClasses int64 `json:"duplicateClasses"`
+	// 忽略弱引用后到 GC root 的路径条数，最多统计到 MaxPaths + 1
+	PathCount     int         `json:"pathCount"`
+	LeakCandidate bool        `json:"leakCandidate"`
+	PathToGCRoot  *GCRootPath `json:"pathToGCRoot,omitempty"`
+}
+
+// DuplicateClass 被多个 ClassLoader 加载的类
+type DuplicateClass struct {
+	Class   string   `json:"class"`
+	Loaders []uint64 `json:"loaders"`
+}
+
+type ClassLoadersReport struct {
+	Loaders []*ClassLoaderInfo `json:"loaders"`
+	// 重复类的总数，DuplicateClasses 可能被截断
+	DuplicateCount   int64             `json:"duplicateCount"`
+	DuplicateClasses []*DuplicateClass `json:"duplicateClasses"`
+	LeakCandidates   int64             `json:"leakCandidates"`
+}
+
+// AnalyzeClassLoaders 按 ClassLoaderObjectId 对类分组，找出被多个 ClassLoader 加载的类，
+// 加载了重复类并且只通过很少几条路径和 GC root 相连的 ClassLoader 通常是重新部署后没有释放的
+func (s *Snapshot) AnalyzeClassLoaders(opts *ClassLoadersOptions) (*ClassLoadersReport, error) {
+	if opts == nil {
+		opts = DefaultClassLoadersOptions()
+	}
+	// 先读出所有类，避免在遍历数据库结果时查询其他数据
+	classLoaders := map[uint64]uint64{}
+	err := s.i.ForEachClassesWithName(func(cid uint64, cname string) error {
+		classLoaders[cid] = 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loaders := map[uint64]*ClassLoaderInfo{}
+	loaderClasses := map[uint64][]uint64{}
+	classNames := map[string][]uint64{}
+	for cid := range classLoaders {
+		loader, err := s.i.GetClassLoaderId(cid)
+		if err != nil {
+			return nil, err
+		}
+		classLoaders[cid] = loader
+		info, exist := loaders[loader]
+		if !exist {
+			info = &ClassLoaderInfo{Id: loader}
+			loaders[loader] = info
+		}
+		info.ClassCount++
+		loaderClasses[loader] = append(loaderClasses[loader], cid)
+		name := s.i.GetClassNameById(cid, "")
+		classNames[name] = append(classNames[name], loader)
+	}
+
+	err = s.i.GetClassesStatistics(opts.Reachability, func(cid uint64, cname string, count, size, retained int64) error {
+		loader, exist := classLoaders[cid]
+		if !exist {
+			// primitive array 的 cid 是元素类型
+			return nil
+		}
+		loaders[loader].InstanceCount += count
+		loaders[loader].InstanceSize += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ClassLoadersReport{}
+	for name, ids := range classNames {
+		distinct := uniqueIds(ids)
+		if len(distinct) < 2 {
+			continue
+		}
+		report.DuplicateCount++
+		for _, loader := range distinct {
+			loaders[loader].DuplicateClasses++
+		}
+		report.DuplicateClasses = append(report.DuplicateClasses, &DuplicateClass{Class: name, Loaders: distinct})
+	}
+	sort.Slice(report.DuplicateClasses, func(a, b int) bool {
+		if len(report.DuplicateClasses[a].Loaders) != len(report.DuplicateClasses[b].Loaders) {
+			return len(report.DuplicateClasses[a].Loaders) > len(report.DuplicateClasses[b].Loaders)
+		}
+		return report.DuplicateClasses[a].Class < report.DuplicateClasses[b].Class
+	})
+	if opts.MaxDuplicates > 0 && len(report.DuplicateClasses) > opts.MaxDuplicates {
+		report.DuplicateClasses = report.DuplicateClasses[:opts.MaxDuplicates]
+	}
+
+	for _, info := range loaders {
+		if info.RetainedSize, err = s.classLoaderRetainedSize(info.Id, loaderClasses[info.Id]); err != nil {
+			return nil, err
+		}
+		if err := s.fillClassLoaderInfo(info, opts); err != nil {
+			return nil, err
+		}
+		if info.LeakCandidate {
+			report.LeakCandidates++
+		}
+		report.Loaders = append(report.Loaders, info)
+	}
+	sort.Slice(report.Loaders, func(a, b int) bool {
+		if report.Loaders[a].RetainedSize != report.Loaders[b].RetainedSize {
+			return report.Loaders[a].RetainedSize > report.Loaders[b].RetainedSize
+		}
+		return report.Loaders[a].Id < report.Loaders[b].Id
+	})
+	return report, nil
+}
+
+// fillClassLoaderInfo 读取 ClassLoader 对象的类名和到 GC root 的路径
+func (s *Snapshot) fillClassLoaderInfo(info *ClassLoaderInfo, opts *ClassLoadersOptions) error {
+	if info.Id == 0 {
+		info.Class = bootstrapClassLoaderName
+		return nil
+	}
+	var err error
+	info.Class, err = s.i.GetObjectClassName(info.Id)
+	if err != nil {
+		return err
+	}
+	info.Display, err = s.RenderValue(info.Id)
+	if err != nil {
+		return err
+	}
+	if _, _, err = s.i.GetDominator(info.Id); errors.Is(err, ErrNotFound) {
+		// 不可达的 ClassLoader 没有支配信息
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	paths, err := s.FindPathsToGCRoots(info.Id, opts.MaxPaths+1, weakReferenceStrengths)
+	if err != nil {
+		return err
+	}
+	info.PathCount = len(paths)
+	info.LeakCandidate = info.DuplicateClasses > 0 && len(paths) > 0 && len(paths) <= opts.MaxPaths
+	if info.LeakCandidate {
+		info.PathToGCRoot = paths[0]
+	}
+	return nil
+}
+
+// classLoaderRetainedSize 返回 ClassLoader 对象、classes 和 classes 的可达实例的 retained size 之和
+// 支配树中祖先也在其中的对象已经包含在祖先的 retained size 中，不重复计算
+func (s *Snapshot) classLoaderRetainedSize(loader uint64, classes []uint64) (int64, error) {
+	members := map[uint64]bool{}
+	if loader != 0 {
+		members[loader] = true
+	}
+	for _, cid := range classes {
+		members[cid] = true
+	}
+	// 先读出所有实例，避免在遍历数据库结果时查询支配信息
+	for _, cid := range classes {
+		typ := hprof.HProfHDRecordTypeInstanceDump
+		if strings.HasPrefix(s.i.GetClassNameById(cid, ""), "[") {
+			typ = hprof.HProfHDRecordTypeObjectArrayDump
+		}
+		err := s.i.GetInstancesStatistics(cid, typ, ReachableObjects, func(id uint64, size, retained int64) error {
+			members[id] = true
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// covered 记录支配树中对象自身或者祖先是否在 members 中
+	covered := map[uint64]bool{}
+	isCovered := func(id uint64) (bool, error) {
+		var chain []uint64
+		result := false
+		for id != 0 {
+			if c, exist := covered[id]; exist {
+				result = c
+				break
+			}
+			if members[id] {
+				result = true
+				break
+			}
+			chain = append(chain, id)
+			idom, _, err := s.i.GetDominator(id)
+			if err != nil {
+				return false, err
+			}
+			id = idom
+		}
+		for _, c := range chain {
+			covered[c] = result
+		}
+		return result, nil
+	}
+
+	var total int64
+	for id := range members {
+		idom, retained, err := s.i.GetDominator(id)
+		if errors.Is(err, ErrNotFound) {
+			// 不可达的对象没有支配信息
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		c, err := isCovered(idom)
+		if err != nil {
+			return 0, err
+		}
+		if !c {
+			total += retained
+		}
+	}
+	return total, nil
+}
+
+func uniqueIds(ids []uint64) []uint64 {
+	seen := map[uint64]bool{}
+	var result []uint64
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a] < result[b] })
+	return result
+}
@@ -1,13 +1,52 @@
 package snapshot
 
+import (
+	"fmt"
+	"hprof-tool/pkg/storage"
+)
+
+// Reachability 统计时按对象是否从 GC roots 可达过滤
+type Reachability = storage.Reachability
+
+const (
+	AllObjects         = storage.AllObjects
+	ReachableObjects   = storage.ReachableObjects
+	UnreachableObjects = storage.UnreachableObjects
+)
+
+// ParseReachability 解析 all、reachable、unreachable，空字符串表示 all
+func ParseReachability(s string) (Reachability, error) {
+	switch s {
+	case "", "all":
+		return AllObjects, nil
+	case "reachable":
+		return ReachableObjects, nil
+	case "unreachable":
+		return UnreachableObjects, nil
+	}
+	return AllObjects, fmt.Errorf("unknown reachability: %s", s)
+}
+
 type ClassStatistics struct {
 	Id            uint64
 	Name          string
 	InstanceCount int64
 	InstanceSize  int64
+	RetainedSize  int64
 }
 
 type InstanceStatistics struct {
-	Id   uint64
-	Size int64
+	Id           uint64
+	Size         int64
+	RetainedSize int64
+	// RenderValue 的结果
+	Display string
+}
+
+// Dominator 对象在支配树中的信息
+// ImmediateDominator 为 0 表示被 GC root 直接支配
+type Dominator struct {
+	Id                 uint64
+	ImmediateDominator uint64
+	RetainedSize       int64
 }
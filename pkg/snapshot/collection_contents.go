@@ -0,0 +1,338 @@
+package snapshot
+
+import "errors"
+
+const (
+	linkedHashMapClassName = "java.util.LinkedHashMap"
+	treeMapClassName       = "java.util.TreeMap"
+	linkedListClassName    = "java.util.LinkedList"
+	arrayDequeClassName    = "java.util.ArrayDeque"
+)
+
+// contentsExtractors 支持读取内容的集合类，子类按最近的父类处理
+var contentsExtractors = map[string]func(s *Snapshot, fields FieldValues, visit entryVisitor) error{
+	hashMapClassName:           (*Snapshot).walkHashMap,
+	linkedHashMapClassName:     (*Snapshot).walkLinkedHashMap,
+	concurrentHashMapClassName: (*Snapshot).walkHashMap,
+	treeMapClassName:           (*Snapshot).walkTreeMap,
+	hashSetClassName:           (*Snapshot).walkHashSet,
+	arrayListClassName:         (*Snapshot).walkArrayList,
+	linkedListClassName:        (*Snapshot).walkLinkedList,
+	arrayDequeClassName:        (*Snapshot).walkArrayDeque,
+}
+
+// ObjectRef 集合中的一个对象，Id 为 0 表示 null
+type ObjectRef struct {
+	Id      uint64 `json:"id"`
+	Class   string `json:"class,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// CollectionEntry Map 的一个键值对，List 和 Set 只有 Value
+type CollectionEntry struct {
+	Key   *ObjectRef `json:"key,omitempty"`
+	Value *ObjectRef `json:"value"`
+}
+
+type CollectionContents struct {
+	Id    uint64 `json:"id"`
+	Class string `json:"class"`
+	// 集合的实现类型，比如 java.util.LinkedHashMap
+	Kind    string             `json:"kind"`
+	Offset  int                `json:"offset"`
+	Limit   int                `json:"limit"`
+	Entries []*CollectionEntry `json:"entries"`
+	// 后面是否还有更多元素
+	More bool `json:"more"`
+}
+
+// entryVisitor 返回 false 时停止遍历，List 和 Set 的 key 为 0
+type entryVisitor func(key, value uint64) (bool, error)
+
+// GetCollectionContents 按遍历顺序返回集合中从 offset 开始的 limit 个元素
+func (s *Snapshot) GetCollectionContents(id uint64, offset, limit int) (*CollectionContents, error) {
+	cid, fields, err := s.ReadFields(id)
+	if err != nil {
+		return nil, err
+	}
+	names, err := s.i.GetSuperClassNames(cid)
+	if err != nil {
+		return nil, err
+	}
+	result := &CollectionContents{Id: id, Class: names[0], Offset: offset, Limit: limit, Entries: []*CollectionEntry{}}
+	var walk func(s *Snapshot, fields FieldValues, visit entryVisitor) error
+	for _, name := range names {
+		if fn, exist := contentsExtractors[name]; exist {
+			result.Kind = name
+			walk = fn
+			break
+		}
+	}
+	if walk == nil {
+		return nil, &UnsupportedClassError{Id: id, Class: names[0]}
+	}
+
+	skipped := 0
+	err = walk(s, fields, func(key, value uint64) (bool, error) {
+		if skipped < offset {
+			skipped++
+			return true, nil
+		}
+		if len(result.Entries) >= limit {
+			result.More = true
+			return false, nil
+		}
+		entry := &CollectionEntry{}
+		var err error
+		if isMapKind(result.Kind) {
+			entry.Key, err = s.newObjectRef(key)
+			if err != nil {
+				return false, err
+			}
+		}
+		entry.Value, err = s.newObjectRef(value)
+		if err != nil {
+			return false, err
+		}
+		result.Entries = append(result.Entries, entry)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func isMapKind(kind string) bool {
+	switch kind {
+	case hashMapClassName, linkedHashMapClassName, concurrentHashMapClassName, treeMapClassName:
+		return true
+	}
+	return false
+}
+
+func (s *Snapshot) newObjectRef(id uint64) (*ObjectRef, error) {
+	if id == 0 {
+		return &ObjectRef{}, nil
+	}
+	class, err := s.i.GetObjectClassName(id)
+	if errors.Is(err, ErrNotFound) {
+		return &ObjectRef{Id: id, Display: missingDisplay(id)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	display, err := s.RenderValue(id)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectRef{Id: id, Class: class, Display: display}, nil
+}
+
+// walkHashMap 按 table 的顺序遍历每个桶的链表，也用于 ConcurrentHashMap
+// 树化的桶中 TreeNode 仍然通过 next 连接
+func (s *Snapshot) walkHashMap(fields FieldValues, visit entryVisitor) error {
+	table := fields.Object("table")
+	if table == 0 {
+		return nil
+	}
+	// ConcurrentHashMap 扩容时多个 ForwardingNode 指向同一个 nextTable
+	tables := map[uint64][]uint64{}
+	buckets, err := s.hashTableBuckets(tables, table)
+	if err != nil {
+		return err
+	}
+	for idx := range buckets {
+		more, err := s.walkHashBucket(tables, buckets, idx, visit)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) hashTableBuckets(tables map[uint64][]uint64, table uint64) ([]uint64, error) {
+	if buckets, exist := tables[table]; exist {
+		return buckets, nil
+	}
+	buckets, err := s.i.GetObjectArrayElements(table)
+	if err != nil {
+		return nil, err
+	}
+	tables[table] = buckets
+	return buckets, nil
+}
+
+// walkHashBucket 遍历 buckets[idx] 的链表，visit 返回 false 时返回 false
+func (s *Snapshot) walkHashBucket(tables map[uint64][]uint64, buckets []uint64, idx int, visit entryVisitor) (bool, error) {
+	for node := buckets[idx]; node != 0; {
+		_, nodeFields, err := s.ReadFields(node)
+		if err != nil {
+			return false, err
+		}
+		if _, forwarding := nodeFields["nextTable"]; forwarding {
+			// ConcurrentHashMap 扩容时的 ForwardingNode，桶中的元素已经移到 nextTable 的 idx 和 idx+n 两个桶中
+			nextTable := nodeFields.Object("nextTable")
+			if nextTable == 0 {
+				return true, nil
+			}
+			next, err := s.hashTableBuckets(tables, nextTable)
+			if err != nil {
+				return false, err
+			}
+			for _, i := range []int{idx, idx + len(buckets)} {
+				if i >= len(next) {
+					continue
+				}
+				more, err := s.walkHashBucket(tables, next, i, visit)
+				if err != nil || !more {
+					return more, err
+				}
+			}
+			return true, nil
+		}
+		if _, treeBin := nodeFields["first"]; treeBin {
+			// ConcurrentHashMap 树化的桶是 TreeBin，元素从 first 开始
+			node = nodeFields.Object("first")
+			continue
+		}
+		value := nodeFields.Object("value")
+		if _, exist := nodeFields["val"]; exist {
+			// ConcurrentHashMap.Node 的值字段是 val
+			value = nodeFields.Object("val")
+		}
+		more, err := visit(nodeFields.Object("key"), value)
+		if err != nil || !more {
+			return more, err
+		}
+		node = nodeFields.Object("next")
+	}
+	return true, nil
+}
+
+// walkLinkedHashMap 按插入或访问顺序遍历
+func (s *Snapshot) walkLinkedHashMap(fields FieldValues, visit entryVisitor) error {
+	for node := fields.Object("head"); node != 0; {
+		_, nodeFields, err := s.ReadFields(node)
+		if err != nil {
+			return err
+		}
+		more, err := visit(nodeFields.Object("key"), nodeFields.Object("value"))
+		if err != nil || !more {
+			return err
+		}
+		node = nodeFields.Object("after")
+	}
+	return nil
+}
+
+// walkTreeMap 中序遍历红黑树，按 key 的顺序返回
+func (s *Snapshot) walkTreeMap(fields FieldValues, visit entryVisitor) error {
+	var stack []FieldValues
+	node := fields.Object("root")
+	for node != 0 || len(stack) > 0 {
+		for node != 0 {
+			_, nodeFields, err := s.ReadFields(node)
+			if err != nil {
+				return err
+			}
+			stack = append(stack, nodeFields)
+			node = nodeFields.Object("left")
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		more, err := visit(top.Object("key"), top.Object("value"))
+		if err != nil || !more {
+			return err
+		}
+		node = top.Object("right")
+	}
+	return nil
+}
+
+// walkHashSet 遍历内部 map 的 key
+func (s *Snapshot) walkHashSet(fields FieldValues, visit entryVisitor) error {
+	m := fields.Object("map")
+	if m == 0 {
+		return nil
+	}
+	cid, mapFields, err := s.ReadFields(m)
+	if err != nil {
+		return err
+	}
+	names, err := s.i.GetSuperClassNames(cid)
+	if err != nil {
+		return err
+	}
+	walk := (*Snapshot).walkHashMap
+	for _, name := range names {
+		if name == linkedHashMapClassName {
+			// LinkedHashSet
+			walk = (*Snapshot).walkLinkedHashMap
+			break
+		}
+	}
+	return walk(s, mapFields, func(key, value uint64) (bool, error) {
+		return visit(0, key)
+	})
+}
+
+func (s *Snapshot) walkArrayList(fields FieldValues, visit entryVisitor) error {
+	data := fields.Object("elementData")
+	if data == 0 {
+		return nil
+	}
+	elements, err := s.i.GetObjectArrayElements(data)
+	if err != nil {
+		return err
+	}
+	size, _ := fields.Integer("size")
+	if size < 0 || size > int64(len(elements)) {
+		size = int64(len(elements))
+	}
+	for _, e := range elements[:size] {
+		more, err := visit(0, e)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) walkLinkedList(fields FieldValues, visit entryVisitor) error {
+	for node := fields.Object("first"); node != 0; {
+		_, nodeFields, err := s.ReadFields(node)
+		if err != nil {
+			return err
+		}
+		more, err := visit(0, nodeFields.Object("item"))
+		if err != nil || !more {
+			return err
+		}
+		node = nodeFields.Object("next")
+	}
+	return nil
+}
+
+// walkArrayDeque 从 head 到 tail 遍历循环数组
+func (s *Snapshot) walkArrayDeque(fields FieldValues, visit entryVisitor) error {
+	data := fields.Object("elements")
+	if data == 0 {
+		return nil
+	}
+	elements, err := s.i.GetObjectArrayElements(data)
+	if err != nil || len(elements) == 0 {
+		return err
+	}
+	head, _ := fields.Integer("head")
+	tail, _ := fields.Integer("tail")
+	n := int64(len(elements))
+	count := (tail - head + n) % n
+	for k := int64(0); k < count; k++ {
+		more, err := visit(0, elements[(head+k)%n])
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
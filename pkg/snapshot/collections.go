@@ -0,0 +1,335 @@
+package snapshot
+
+import (
+	"errors"
+	"hprof-tool/pkg/hprof"
+	"sort"
+	"strings"
+)
+
+const (
+	hashMapClassName           = "java.util.HashMap"
+	hashSetClassName           = "java.util.HashSet"
+	arrayListClassName         = "java.util.ArrayList"
+	concurrentHashMapClassName = "java.util.concurrent.ConcurrentHashMap"
+)
+
+// fillRatioClassNames 支持计算填充率的集合类，子类按最近的父类处理
+var fillRatioClassNames = map[string]bool{
+	hashMapClassName:           true,
+	hashSetClassName:           true,
+	arrayListClassName:         true,
+	concurrentHashMapClassName: true,
+}
+
+type CollectionsOptions struct {
+	// 最多列出的浪费最多的集合个数
+	Limit int
+	// 每个集合最多列出的持有者个数
+	MaxHolders   int
+	Reachability Reachability
+}
+
+func DefaultCollectionsOptions() *CollectionsOptions {
+	return &CollectionsOptions{
+		Limit:        20,
+		MaxHolders:   3,
+		Reachability: ReachableObjects,
+	}
+}
+
+// CollectionStatistics 同一个集合类所有实例的汇总
+type CollectionStatistics struct {
+	Class string `json:"class"`
+	// 集合的实现类型，比如 LinkedHashMap 为 java.util.HashMap
+	Kind  string `json:"kind"`
+	Count int64  `json:"count"`
+	// size 为 0 的集合个数
+	EmptyCount int64 `json:"emptyCount"`
+	// 空集合本身和底层数组的大小，可以用 Collections.emptyMap() 这类共享的空集合代替
+	EmptyBytes int64 `json:"emptyBytes"`
+	Size       int64 `json:"size"`
+	Capacity   int64 `json:"capacity"`
+	// Size / Capacity
+	FillRatio   float64 `json:"fillRatio"`
+	WastedBytes int64   `json:"wastedBytes"`
+}
+
+// Holder 引用了对象的对象和字段
+type Holder struct {
+	Id      uint64 `json:"id"`
+	Class   string `json:"class"`
+	Display string `json:"display,omitempty"`
+	Field   string `json:"field"`
+}
+
+type CollectionInstance struct {
+	Id          uint64    `json:"id"`
+	Class       string    `json:"class"`
+	Size        int64     `json:"size"`
+	Capacity    int64     `json:"capacity"`
+	FillRatio   float64   `json:"fillRatio"`
+	WastedBytes int64     `json:"wastedBytes"`
+	Holders     []*Holder `json:"holders"`
+}
+
+type CollectionsReport struct {
+	WastedBytes int64 `json:"wastedBytes"`
+	// 内部数组或者节点引用了不存在的对象，没有统计的集合个数
+	Skipped int64                   `json:"skipped"`
+	Classes []*CollectionStatistics `json:"classes"`
+	// 浪费最多的集合
+	Offenders []*CollectionInstance `json:"offenders"`
+}
+
+// AnalyzeCollections 计算集合的元素个数和容量
+// 浪费的字节数是底层数组中没有使用的部分，空集合的整个数组都算浪费
+func (s *Snapshot) AnalyzeCollections(opts *CollectionsOptions) (*CollectionsReport, error) {
+	if opts == nil {
+		opts = DefaultCollectionsOptions()
+	}
+	type collectionObject struct {
+		id    uint64
+		size  int64
+		class string
+		kind  string
+	}
+	type collectionClass struct {
+		cid   uint64
+		class string
+		kind  string
+	}
+	// 先找出所有集合类，避免在遍历数据库结果时查询实例
+	var collectionClasses []collectionClass
+	err := s.i.ForEachClassesWithName(func(cid uint64, cname string) error {
+		// cname 是 java/util/HashMap 这种格式，使用 GetSuperClassNames 返回的类名
+		names, err := s.i.GetSuperClassNames(cid)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if fillRatioClassNames[name] {
+				collectionClasses = append(collectionClasses, collectionClass{cid, names[0], name})
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 同名的类可能被不同 ClassLoader 加载，按类名汇总
+	statistics := map[string]*CollectionStatistics{}
+	var classes []*CollectionStatistics
+	var objects []collectionObject
+	for _, cc := range collectionClasses {
+		if _, exist := statistics[cc.class]; !exist {
+			c := &CollectionStatistics{Class: cc.class, Kind: cc.kind}
+			statistics[cc.class] = c
+			classes = append(classes, c)
+		}
+		err = s.i.GetInstancesStatistics(cc.cid, hprof.HProfHDRecordTypeInstanceDump, opts.Reachability, func(id uint64, size, retained int64) error {
+			objects = append(objects, collectionObject{id, size, cc.class, cc.kind})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// HashSet 内部的 HashMap 算在 HashSet 上
+	internalMaps := map[uint64]bool{}
+	for _, o := range objects {
+		if o.kind != hashSetClassName {
+			continue
+		}
+		_, fields, err := s.ReadFields(o.id)
+		if err != nil {
+			return nil, err
+		}
+		internalMaps[fields.Object("map")] = true
+	}
+
+	report := &CollectionsReport{}
+	var instances []*CollectionInstance
+	for _, o := range objects {
+		if internalMaps[o.id] {
+			continue
+		}
+		size, capacity, err := s.readCollectionCapacity(o.id, o.kind)
+		if errors.Is(err, ErrNotFound) {
+			report.Skipped++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		instance := &CollectionInstance{
+			Id:          o.id,
+			Class:       o.class,
+			Size:        size,
+			Capacity:    capacity,
+			FillRatio:   fillRatio(size, capacity),
+			WastedBytes: s.wastedArrayBytes(size, capacity),
+		}
+		instances = append(instances, instance)
+
+		c := statistics[o.class]
+		c.Count++
+		if size == 0 {
+			c.EmptyCount++
+			c.EmptyBytes += o.size + instance.WastedBytes
+		}
+		c.Size += size
+		c.Capacity += capacity
+		c.WastedBytes += instance.WastedBytes
+		report.WastedBytes += instance.WastedBytes
+	}
+
+	for _, c := range classes {
+		if c.Count == 0 {
+			continue
+		}
+		c.FillRatio = fillRatio(c.Size, c.Capacity)
+		report.Classes = append(report.Classes, c)
+	}
+	sort.Slice(report.Classes, func(a, b int) bool {
+		if report.Classes[a].WastedBytes != report.Classes[b].WastedBytes {
+			return report.Classes[a].WastedBytes > report.Classes[b].WastedBytes
+		}
+		return report.Classes[a].Class < report.Classes[b].Class
+	})
+
+	sort.Slice(instances, func(a, b int) bool {
+		if instances[a].WastedBytes != instances[b].WastedBytes {
+			return instances[a].WastedBytes > instances[b].WastedBytes
+		}
+		return instances[a].Id < instances[b].Id
+	})
+	if opts.Limit > 0 && len(instances) > opts.Limit {
+		instances = instances[:opts.Limit]
+	}
+	for _, instance := range instances {
+		if instance.WastedBytes == 0 {
+			break
+		}
+		instance.Holders, err = s.listHolders(instance.Id, opts.MaxHolders)
+		if err != nil {
+			return nil, err
+		}
+		report.Offenders = append(report.Offenders, instance)
+	}
+	return report, nil
+}
+
+// readCollectionCapacity 根据集合的内部实现读取元素个数和底层数组的长度
+func (s *Snapshot) readCollectionCapacity(id uint64, kind string) (int64, int64, error) {
+	_, fields, err := s.ReadFields(id)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch kind {
+	case hashSetClassName:
+		if m := fields.Object("map"); m != 0 {
+			return s.readCollectionCapacity(m, hashMapClassName)
+		}
+		return 0, 0, nil
+	case arrayListClassName:
+		size, _ := fields.Integer("size")
+		capacity, err := s.arrayLength(fields.Object("elementData"))
+		return size, capacity, err
+	case concurrentHashMapClassName:
+		size, err := s.concurrentHashMapSize(fields)
+		if err != nil {
+			return 0, 0, err
+		}
+		capacity, err := s.arrayLength(fields.Object("table"))
+		return size, capacity, err
+	default:
+		size, _ := fields.Integer("size")
+		capacity, err := s.arrayLength(fields.Object("table"))
+		return size, capacity, err
+	}
+}
+
+// concurrentHashMapSize 和 ConcurrentHashMap.sumCount 一样，由 baseCount 和 counterCells 相加
+func (s *Snapshot) concurrentHashMapSize(fields FieldValues) (int64, error) {
+	size, _ := fields.Integer("baseCount")
+	cells := fields.Object("counterCells")
+	if cells == 0 {
+		return size, nil
+	}
+	ids, err := s.i.GetObjectArrayElements(cells)
+	if err != nil {
+		return 0, err
+	}
+	for _, cell := range ids {
+		if cell == 0 {
+			continue
+		}
+		_, cellFields, err := s.ReadFields(cell)
+		if err != nil {
+			return 0, err
+		}
+		value, _ := cellFields.Integer("value")
+		size += value
+	}
+	return size, nil
+}
+
+// arrayLength 返回 object array 的长度，id 为 0 时返回 0
+func (s *Snapshot) arrayLength(id uint64) (int64, error) {
+	if id == 0 {
+		return 0, nil
+	}
+	elements, err := s.i.GetObjectArrayElements(id)
+	return int64(len(elements)), err
+}
+
+func (s *Snapshot) wastedArrayBytes(size, capacity int64) int64 {
+	if capacity == 0 || size >= capacity {
+		return 0
+	}
+	layout := s.ObjectLayout()
+	wasted := layout.ArraySize(hprof.HProfValueType_OBJECT, int(capacity))
+	if size > 0 {
+		wasted -= layout.ArraySize(hprof.HProfValueType_OBJECT, int(size))
+	}
+	return wasted
+}
+
+func fillRatio(size, capacity int64) float64 {
+	if capacity == 0 {
+		return 0
+	}
+	return float64(size) / float64(capacity)
+}
+
+// listHolders 列出引用了对象的最多 limit 个对象和字段
+func (s *Snapshot) listHolders(id uint64, limit int) ([]*Holder, error) {
+	froms, err := s.listInbounds(id)
+	if err != nil {
+		return nil, err
+	}
+	var result []*Holder
+	for _, in := range froms {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		class, err := s.i.GetObjectClassName(in.from)
+		if err != nil {
+			return nil, err
+		}
+		names, err := s.i.GetReferenceFieldNames(in.from, id)
+		if err != nil {
+			return nil, err
+		}
+		display, err := s.RenderValue(in.from)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &Holder{Id: in.from, Class: class, Display: display, Field: strings.Join(names, ", ")})
+	}
+	return result, nil
+}
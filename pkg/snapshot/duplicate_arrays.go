@@ -0,0 +1,131 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/indexer"
+	"sort"
+)
+
+type DuplicateArraysOptions struct {
+	// 出现次数不少于 MinCount 才算重复
+	MinCount int64
+	// 最多返回的重复数组组数，按浪费的字节数排序
+	Limit int
+	// 每组最多列出的持有者类个数
+	MaxHolders   int
+	Reachability Reachability
+}
+
+func DefaultDuplicateArraysOptions() *DuplicateArraysOptions {
+	return &DuplicateArraysOptions{
+		MinCount:     2,
+		Limit:        100,
+		MaxHolders:   5,
+		Reachability: ReachableObjects,
+	}
+}
+
+// DuplicateArray 内容相同的一组 primitive array
+type DuplicateArray struct {
+	Type   string `json:"type"`
+	Length int    `json:"length"`
+	Count  int64  `json:"count"`
+	// 每个数组的 shallow size
+	Size        int64 `json:"size"`
+	WastedBytes int64 `json:"wastedBytes"`
+	// 其中一个数组的 id，用于查看内容
+	SampleId uint64         `json:"sampleId"`
+	Holders  []*HolderClass `json:"holders"`
+}
+
+type DuplicateArraysReport struct {
+	TotalArrays    int64 `json:"totalArrays"`
+	DistinctArrays int64 `json:"distinctArrays"`
+	// 所有重复数组浪费的字节数之和
+	WastedBytes int64             `json:"wastedBytes"`
+	Arrays      []*DuplicateArray `json:"arrays"`
+}
+
+// arrayKey 只保存内容的摘要，不需要把数组内容留在内存中
+type arrayKey struct {
+	typ    hprof.HProfValueType
+	length int
+	digest [sha256.Size]byte
+}
+
+type arrayGroup struct {
+	ids  []uint64
+	size int64
+}
+
+// FindDuplicateArrays 逐个读取 primitive array 计算内容摘要，按元素类型、长度和内容分组
+func (s *Snapshot) FindDuplicateArrays(opts *DuplicateArraysOptions) (*DuplicateArraysReport, error) {
+	if opts == nil {
+		opts = DefaultDuplicateArraysOptions()
+	}
+	report := &DuplicateArraysReport{}
+	groups := map[arrayKey]*arrayGroup{}
+	for typ := hprof.HProfValueType_BOOLEAN; typ <= hprof.HProfValueType_LONG; typ++ {
+		err := s.i.ForEachPrimitiveArrayRecords(typ, opts.Reachability, func(record *hprof.HProfPrimitiveArrayRecord, size int64) error {
+			key := arrayKey{
+				typ:    typ,
+				length: len(record.Values) / hprof.ValueSize[typ],
+				digest: sha256.Sum256(record.Values),
+			}
+			g, exist := groups[key]
+			if !exist {
+				g = &arrayGroup{size: size}
+				groups[key] = g
+			}
+			g.ids = append(g.ids, record.ArrayObjectId)
+			report.TotalArrays++
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	report.DistinctArrays = int64(len(groups))
+
+	type duplicate struct {
+		group *arrayGroup
+		*DuplicateArray
+	}
+	var duplicates []*duplicate
+	for key, g := range groups {
+		count := int64(len(g.ids))
+		if count < opts.MinCount || count < 2 {
+			continue
+		}
+		wasted := (count - 1) * g.size
+		report.WastedBytes += wasted
+		duplicates = append(duplicates, &duplicate{g, &DuplicateArray{
+			Type:        indexer.PRIMITIVE_TYPE_ARRAY[key.typ],
+			Length:      key.length,
+			Count:       count,
+			Size:        g.size,
+			WastedBytes: wasted,
+			SampleId:    g.ids[0],
+		}})
+	}
+	sort.Slice(duplicates, func(a, b int) bool {
+		if duplicates[a].WastedBytes != duplicates[b].WastedBytes {
+			return duplicates[a].WastedBytes > duplicates[b].WastedBytes
+		}
+		return duplicates[a].SampleId < duplicates[b].SampleId
+	})
+	if opts.Limit > 0 && len(duplicates) > opts.Limit {
+		duplicates = duplicates[:opts.Limit]
+	}
+
+	for _, d := range duplicates {
+		holders, err := s.groupHoldersByClass(d.group.ids, opts.MaxHolders)
+		if err != nil {
+			return nil, err
+		}
+		d.Holders = holders
+		report.Arrays = append(report.Arrays, d.DuplicateArray)
+	}
+	return report, nil
+}
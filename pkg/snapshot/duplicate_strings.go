@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"errors"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/indexer"
+	"sort"
+)
+
+type DuplicateStringsOptions struct {
+	// 出现次数不少于 MinCount 才算重复
+	MinCount int64
+	// 最多返回的重复值个数，按浪费的字节数排序
+	Limit int
+	// 每个重复值最多列出的持有者类个数
+	MaxHolders int
+	// 返回的字符串超过 MaxValueLength 个字符时截断，0 表示不截断
+	MaxValueLength int
+	Reachability   Reachability
+}
+
+func DefaultDuplicateStringsOptions() *DuplicateStringsOptions {
+	return &DuplicateStringsOptions{
+		MinCount:       2,
+		Limit:          100,
+		MaxHolders:     5,
+		MaxValueLength: 200,
+		Reachability:   ReachableObjects,
+	}
+}
+
+// HolderClass 引用了对象的类和引用次数
+type HolderClass struct {
+	Class string `json:"class"`
+	Count int64  `json:"count"`
+}
+
+// DuplicateString 内容相同的一组 String
+type DuplicateString struct {
+	Value string `json:"value"`
+	// 字符串的实际长度，Value 可能被截断
+	Length int   `json:"length"`
+	Count  int64 `json:"count"`
+	// 不同的 value 数组个数，多个 String 可能共享同一个数组
+	Arrays      int64          `json:"arrays"`
+	WastedBytes int64          `json:"wastedBytes"`
+	Holders     []*HolderClass `json:"holders"`
+}
+
+type DuplicateStringsReport struct {
+	TotalStrings   int64 `json:"totalStrings"`
+	DistinctValues int64 `json:"distinctValues"`
+	// value 数组缺失或者不是 char[]、byte[] 的 String 个数，这些 String 不参与分组
+	Skipped int64 `json:"skipped"`
+	// 所有重复值浪费的字节数之和
+	WastedBytes int64              `json:"wastedBytes"`
+	Values      []*DuplicateString `json:"values"`
+}
+
+type stringGroup struct {
+	ids       []uint64
+	arrays    map[uint64]struct{}
+	size      int64
+	arraySize int64
+}
+
+// FindDuplicateStrings 按内容对 String 分组，保留一份时其余 String 和 value 数组都是浪费的
+func (s *Snapshot) FindDuplicateStrings(opts *DuplicateStringsOptions) (*DuplicateStringsReport, error) {
+	if opts == nil {
+		opts = DefaultDuplicateStringsOptions()
+	}
+	type stringObject struct {
+		id   uint64
+		size int64
+	}
+	// 先读出所有 String，避免在遍历数据库结果时读取其他记录
+	var objects []stringObject
+	for _, cid := range s.i.GetStringClassIds() {
+		err := s.i.GetInstancesStatistics(cid, hprof.HProfHDRecordTypeInstanceDump, opts.Reachability, func(id uint64, size, retained int64) error {
+			objects = append(objects, stringObject{id, size})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	groups := map[string]*stringGroup{}
+	var skipped int64
+	for _, o := range objects {
+		str, err := s.i.ReadString(o.id)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, indexer.ErrStringValue) {
+			// value 数组缺失或者类型不对
+			skipped++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		g, exist := groups[str.Value]
+		if !exist {
+			g = &stringGroup{arrays: map[uint64]struct{}{}, size: o.size, arraySize: str.ArraySize}
+			groups[str.Value] = g
+		}
+		g.ids = append(g.ids, o.id)
+		if str.ArrayId != 0 {
+			g.arrays[str.ArrayId] = struct{}{}
+		}
+	}
+
+	report := &DuplicateStringsReport{
+		TotalStrings:   int64(len(objects)),
+		DistinctValues: int64(len(groups)),
+		Skipped:        skipped,
+	}
+	type duplicate struct {
+		value string
+		group *stringGroup
+		*DuplicateString
+	}
+	var duplicates []*duplicate
+	for value, g := range groups {
+		count := int64(len(g.ids))
+		if count < opts.MinCount || count < 2 {
+			continue
+		}
+		arrays := int64(len(g.arrays))
+		wasted := (count - 1) * g.size
+		if arrays > 1 {
+			wasted += (arrays - 1) * g.arraySize
+		}
+		report.WastedBytes += wasted
+		duplicates = append(duplicates, &duplicate{value, g, &DuplicateString{
+			Count:       count,
+			Arrays:      arrays,
+			WastedBytes: wasted,
+		}})
+	}
+	sort.Slice(duplicates, func(a, b int) bool {
+		if duplicates[a].WastedBytes != duplicates[b].WastedBytes {
+			return duplicates[a].WastedBytes > duplicates[b].WastedBytes
+		}
+		return duplicates[a].value < duplicates[b].value
+	})
+	if opts.Limit > 0 && len(duplicates) > opts.Limit {
+		duplicates = duplicates[:opts.Limit]
+	}
+
+	for _, d := range duplicates {
+		runes := []rune(d.value)
+		d.Length = len(runes)
+		d.Value = d.value
+		if opts.MaxValueLength > 0 && len(runes) > opts.MaxValueLength {
+			d.Value = string(runes[:opts.MaxValueLength]) + "..."
+		}
+		holders, err := s.groupHoldersByClass(d.group.ids, opts.MaxHolders)
+		if err != nil {
+			return nil, err
+		}
+		d.Holders = holders
+		report.Values = append(report.Values, d.DuplicateString)
+	}
+	return report, nil
+}
+
+// groupHoldersByClass 把引用了 ids 的对象按类汇总，返回引用次数最多的 limit 个类
+func (s *Snapshot) groupHoldersByClass(ids []uint64, limit int) ([]*HolderClass, error) {
+	classes := map[string]*HolderClass{}
+	for _, id := range ids {
+		froms, err := s.listInbounds(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range froms {
+			name, err := s.i.GetObjectClassName(in.from)
+			if err != nil {
+				return nil, err
+			}
+			c, exist := classes[name]
+			if !exist {
+				c = &HolderClass{Class: name}
+				classes[name] = c
+			}
+			c.Count++
+		}
+	}
+	result := make([]*HolderClass, 0, len(classes))
+	for _, c := range classes {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Count != result[b].Count {
+			return result[a].Count > result[b].Count
+		}
+		return result[a].Class < result[b].Class
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
@@ -0,0 +1,40 @@
+package snapshot
+
+import (
+	"fmt"
+	"hprof-tool/pkg/storage"
+)
+
+// 对外暴露的错误类型，使用 errors.Is 判断
+var (
+	ErrNotFound    = storage.ErrNotFound
+	ErrCorrupt     = storage.ErrCorrupt
+	ErrUnsupported = storage.ErrUnsupported
+)
+
+// UnsupportedClassError 对象的类不支持当前的操作，比如读取非集合对象的内容
+type UnsupportedClassError struct {
+	Id    uint64
+	Class string
+}
+
+func (e *UnsupportedClassError) Error() string {
+	return fmt.Sprintf("unsupported class %s of 0x%x", e.Class, e.Id)
+}
+
+func (e *UnsupportedClassError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// UnknownClassError 按类名查找的类不存在
+type UnknownClassError struct {
+	Name string
+}
+
+func (e *UnknownClassError) Error() string {
+	return fmt.Sprintf("class %s not found", e.Name)
+}
+
+func (e *UnknownClassError) Is(target error) bool {
+	return target == ErrNotFound
+}
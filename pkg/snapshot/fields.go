@@ -0,0 +1,57 @@
+package snapshot
+
+import "hprof-tool/pkg/hprof"
+
+// FieldValues 按字段名索引的 instance 字段值
+type FieldValues map[string]hprof.HProfInstanceFieldValue
+
+// Object 返回引用字段的对象 id，字段不存在或为 null 时返回 0
+func (f FieldValues) Object(name string) uint64 {
+	if v, ok := f[name].(*hprof.HProfInstanceObjectValue); ok {
+		return v.Value
+	}
+	return 0
+}
+
+// Integer 返回整数类型字段的值
+func (f FieldValues) Integer(name string) (int64, bool) {
+	switch v := f[name].(type) {
+	case *hprof.HProfInstanceByteValue:
+		return int64(int8(v.Value)), true
+	case *hprof.HProfInstanceShortValue:
+		return int64(v.Value), true
+	case *hprof.HProfInstanceCharValue:
+		return int64(v.Value), true
+	case *hprof.HProfInstanceIntValue:
+		return int64(v.Value), true
+	case *hprof.HProfInstanceLongValue:
+		return v.Value, true
+	}
+	return 0, false
+}
+
+// Boolean 返回 boolean 字段的值，字段不存在时返回 false
+func (f FieldValues) Boolean(name string) bool {
+	v, ok := f[name].(*hprof.HProfInstanceBooleanValue)
+	return ok && v.Value
+}
+
+// ReadFields 返回 instance 的类 id 和所有字段的值，子类和父类有同名字段时使用子类的
+func (s *Snapshot) ReadFields(id uint64) (uint64, FieldValues, error) {
+	cid, fields, err := s.i.ReadInstanceFields(id)
+	return cid, fields, err
+}
+
+// ReadString 返回 java.lang.String 对象的内容
+func (s *Snapshot) ReadString(id uint64) (string, error) {
+	str, err := s.i.ReadString(id)
+	if err != nil {
+		return "", err
+	}
+	return str.Value, nil
+}
+
+// ReadDeclaredFields 返回 instance 中由 className 声明的字段的值
+func (s *Snapshot) ReadDeclaredFields(id uint64, className string) (FieldValues, error) {
+	return s.i.ReadDeclaredFields(id, className)
+}
@@ -0,0 +1,256 @@
+package snapshot
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	finalizerClassName      = "java.lang.ref.Finalizer"
+	referenceClassName      = "java.lang.ref.Reference"
+	referenceQueueClassName = "java.lang.ref.ReferenceQueue"
+
+	finalizerThreadName        = "Finalizer"
+	referenceHandlerThreadName = "Reference Handler"
+)
+
+// maxReferenceChainLength 遍历 Reference 链表的最大长度，避免 dump 中的链表有环
+const maxReferenceChainLength = 10000000
+
+type FinalizersOptions struct {
+	// 每部分最多列出的类个数
+	MaxClasses int
+	// 每部分最多列出的对象个数
+	MaxObjects int
+}
+
+func DefaultFinalizersOptions() *FinalizersOptions {
+	return &FinalizersOptions{
+		MaxClasses: 20,
+		MaxObjects: 20,
+	}
+}
+
+// FinalizerClass 一个类的对象的汇总
+type FinalizerClass struct {
+	Class        string `json:"class"`
+	Count        int64  `json:"count"`
+	ShallowSize  int64  `json:"shallowSize"`
+	RetainedSize int64  `json:"retainedSize"`
+}
+
+// FinalizerObjects 一组对象的汇总
+// RetainedSize 是各个对象的 retained size 之和，对象互相持有时会重复计算
+type FinalizerObjects struct {
+	Count        int64             `json:"count"`
+	ShallowSize  int64             `json:"shallowSize"`
+	RetainedSize int64             `json:"retainedSize"`
+	Classes      []*FinalizerClass `json:"classes"`
+	// retained size 最大的对象
+	Objects []*ObjectSize `json:"objects"`
+}
+
+type FinalizersReport struct {
+	// Finalizer.queue 中等待 finalizer 线程执行 finalize 的对象
+	Pending *FinalizerObjects `json:"pending"`
+	// ReferenceQueue.queueLength 记录的队列长度
+	QueueLength int64 `json:"queueLength"`
+	// Finalizer.unfinalized 中注册了 finalize 方法、还没有被执行的对象，包括 Pending 中的对象
+	Unfinalized *FinalizerObjects `json:"unfinalized"`
+	// Reference.pending 中还没有被 Reference Handler 线程放入队列的引用，按引用的类统计
+	// JDK 9 之后这个链表在 VM 中，dump 中读不到
+	PendingReferences *FinalizerObjects `json:"pendingReferences"`
+	FinalizerThread   *ThreadInfo       `json:"finalizerThread,omitempty"`
+	ReferenceHandler  *ThreadInfo       `json:"referenceHandler,omitempty"`
+}
+
+// AnalyzeFinalizers 统计等待 finalize 的对象和还没有进入队列的引用，并给出 finalizer 线程的状态
+// finalizer 线程执行得比对象进入队列慢时，队列中的对象和它们持有的内存都无法回收
+func (s *Snapshot) AnalyzeFinalizers(opts *FinalizersOptions) (*FinalizersReport, error) {
+	if opts == nil {
+		opts = DefaultFinalizersOptions()
+	}
+	report := &FinalizersReport{
+		Pending:           &FinalizerObjects{},
+		Unfinalized:       &FinalizerObjects{},
+		PendingReferences: &FinalizerObjects{},
+	}
+	if cid := s.i.GetClassIdByName(finalizerClassName); cid != 0 {
+		statics, err := s.i.GetStaticFields(cid)
+		if err != nil {
+			return nil, err
+		}
+		for _, sf := range statics {
+			var err error
+			switch sf.Name {
+			case "queue":
+				if sf.Value == 0 {
+					continue
+				}
+				report.Pending, report.QueueLength, err = s.finalizerQueue(sf.Value, opts)
+			case "unfinalized":
+				report.Unfinalized, err = s.unfinalized(sf.Value, opts)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cid := s.i.GetClassIdByName(referenceClassName); cid != 0 {
+		statics, err := s.i.GetStaticFields(cid)
+		if err != nil {
+			return nil, err
+		}
+		for _, sf := range statics {
+			if sf.Name != "pending" {
+				continue
+			}
+			if report.PendingReferences, err = s.pendingReferences(sf.Value, opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	threads, err := s.GetThreadOverview()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range threads {
+		class, err := s.i.GetObjectClassName(t.ObjectId)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case t.Name == finalizerThreadName || strings.HasSuffix(class, "Finalizer$FinalizerThread"):
+			report.FinalizerThread = t
+		case t.Name == referenceHandlerThreadName || strings.HasSuffix(class, "Reference$ReferenceHandler"):
+			report.ReferenceHandler = t
+		}
+	}
+	return report, nil
+}
+
+// finalizerQueue 从 ReferenceQueue.head 开始沿 Reference.next 遍历队列，最后一个元素的 next 指向自己
+// Finalizer 自己的 next 字段遮住了 Reference.next，所以要按声明的类读取
+func (s *Snapshot) finalizerQueue(queue uint64, opts *FinalizersOptions) (*FinalizerObjects, int64, error) {
+	queueFields, err := s.ReadDeclaredFields(queue, referenceQueueClassName)
+	if err != nil {
+		return nil, 0, err
+	}
+	length, _ := queueFields.Integer("queueLength")
+	var referents []uint64
+	visited := map[uint64]bool{}
+	for ref := queueFields.Object("head"); ref != 0 && !visited[ref] && len(visited) < maxReferenceChainLength; {
+		visited[ref] = true
+		fields, err := s.ReadDeclaredFields(ref, referenceClassName)
+		if err != nil {
+			return nil, 0, err
+		}
+		if referent := fields.Object("referent"); referent != 0 {
+			referents = append(referents, referent)
+		}
+		ref = fields.Object("next")
+	}
+	objects, err := s.summarizeObjects(referents, opts)
+	return objects, length, err
+}
+
+// unfinalized 沿 Finalizer.next 遍历还没有执行 finalize 的对象
+func (s *Snapshot) unfinalized(head uint64, opts *FinalizersOptions) (*FinalizerObjects, error) {
+	var referents []uint64
+	visited := map[uint64]bool{}
+	for f := head; f != 0 && !visited[f] && len(visited) < maxReferenceChainLength; {
+		visited[f] = true
+		_, fields, err := s.ReadFields(f)
+		if err != nil {
+			return nil, err
+		}
+		if referent := fields.Object("referent"); referent != 0 {
+			referents = append(referents, referent)
+		}
+		f = fields.Object("next")
+	}
+	return s.summarizeObjects(referents, opts)
+}
+
+// pendingReferences 沿 Reference.discovered 遍历 JDK 8 的 Reference.pending 链表
+func (s *Snapshot) pendingReferences(head uint64, opts *FinalizersOptions) (*FinalizerObjects, error) {
+	var refs []uint64
+	visited := map[uint64]bool{}
+	for ref := head; ref != 0 && !visited[ref] && len(visited) < maxReferenceChainLength; {
+		visited[ref] = true
+		refs = append(refs, ref)
+		fields, err := s.ReadDeclaredFields(ref, referenceClassName)
+		if err != nil {
+			return nil, err
+		}
+		ref = fields.Object("discovered")
+	}
+	return s.summarizeObjects(refs, opts)
+}
+
+// summarizeObjects 按类汇总对象的个数和大小，不可达的对象 retained size 为 0
+func (s *Snapshot) summarizeObjects(ids []uint64, opts *FinalizersOptions) (*FinalizerObjects, error) {
+	result := &FinalizerObjects{}
+	classes := map[string]*FinalizerClass{}
+	var objects []*ObjectSize
+	for _, id := range ids {
+		class, err := s.i.GetObjectClassName(id)
+		if err != nil {
+			return nil, err
+		}
+		shallow, err := s.GetShallowSize(id)
+		if err != nil {
+			return nil, err
+		}
+		retained, err := s.GetRetainedSize(id)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		c, exist := classes[class]
+		if !exist {
+			c = &FinalizerClass{Class: class}
+			classes[class] = c
+		}
+		c.Count++
+		c.ShallowSize += shallow
+		c.RetainedSize += retained
+		result.Count++
+		result.ShallowSize += shallow
+		result.RetainedSize += retained
+		objects = append(objects, &ObjectSize{Id: id, Class: class, RetainedSize: retained})
+	}
+
+	for _, c := range classes {
+		result.Classes = append(result.Classes, c)
+	}
+	sort.Slice(result.Classes, func(a, b int) bool {
+		if result.Classes[a].RetainedSize != result.Classes[b].RetainedSize {
+			return result.Classes[a].RetainedSize > result.Classes[b].RetainedSize
+		}
+		return result.Classes[a].Class < result.Classes[b].Class
+	})
+	if opts.MaxClasses > 0 && len(result.Classes) > opts.MaxClasses {
+		result.Classes = result.Classes[:opts.MaxClasses]
+	}
+
+	sort.Slice(objects, func(a, b int) bool {
+		if objects[a].RetainedSize != objects[b].RetainedSize {
+			return objects[a].RetainedSize > objects[b].RetainedSize
+		}
+		return objects[a].Id < objects[b].Id
+	})
+	if opts.MaxObjects > 0 && len(objects) > opts.MaxObjects {
+		objects = objects[:opts.MaxObjects]
+	}
+	for _, o := range objects {
+		display, err := s.RenderValue(o.Id)
+		if err != nil {
+			return nil, err
+		}
+		o.Display = display
+	}
+	result.Objects = objects
+	return result, nil
+}
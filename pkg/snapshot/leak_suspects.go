@@ -0,0 +1,233 @@
+package snapshot
+
+import (
+	"hprof-tool/pkg/model"
+	"sort"
+)
+
+// LeakSuspectsOptions 泄漏分析的阈值
+type LeakSuspectsOptions struct {
+	// retained size 占堆大小的比例超过 Threshold 才算可疑
+	Threshold float64
+	// 最大的子节点 retained size 占当前节点的比例超过 AccumulationRatio 时继续向下查找累积点
+	AccumulationRatio float64
+	// 每个可疑点最多列出的被支配类个数
+	MaxClasses int
+}
+
+func DefaultLeakSuspectsOptions() *LeakSuspectsOptions {
+	return &LeakSuspectsOptions{
+		Threshold:         0.1,
+		AccumulationRatio: 0.8,
+		MaxClasses:        10,
+	}
+}
+
+const (
+	LeakSuspectObject = "object"
+	LeakSuspectClass  = "class"
+)
+
+// LeakSuspect 一个可疑的泄漏点
+// Kind 为 object 时是单个对象，为 class 时是同一个类的很多个对象
+type LeakSuspect struct {
+	Kind          string  `json:"kind"`
+	Class         string  `json:"class"`
+	Id            uint64  `json:"id,omitempty"`
+	InstanceCount int64   `json:"instanceCount"`
+	RetainedSize  int64   `json:"retainedSize"`
+	Percentage    float64 `json:"percentage"`
+	// 大部分内存最终由这个对象持有
+	AccumulationPoint *ObjectSize `json:"accumulationPoint,omitempty"`
+	PathToGCRoot      *GCRootPath `json:"pathToGCRoot,omitempty"`
+	// 累积点直接支配的对象，按类汇总
+	DominatedClasses []*ClassSize `json:"dominatedClasses"`
+}
+
+type ObjectSize struct {
+	Id           uint64 `json:"id"`
+	Class        string `json:"class"`
+	Display      string `json:"display,omitempty"`
+	RetainedSize int64  `json:"retainedSize"`
+}
+
+type ClassSize struct {
+	Class        string `json:"class"`
+	Count        int64  `json:"count"`
+	RetainedSize int64  `json:"retainedSize"`
+}
+
+type LeakSuspectsReport struct {
+	// 所有可达对象的大小
+	HeapSize int64          `json:"heapSize"`
+	Suspects []*LeakSuspect `json:"suspects"`
+}
+
+// FindLeakSuspects 在支配树的顶层查找 retained size 很大的对象或者类
+func (s *Snapshot) FindLeakSuspects(opts *LeakSuspectsOptions) (*LeakSuspectsReport, error) {
+	if opts == nil {
+		opts = DefaultLeakSuspectsOptions()
+	}
+	top, err := s.ListDominated(0)
+	if err != nil {
+		return nil, err
+	}
+	report := &LeakSuspectsReport{}
+	for _, d := range top {
+		report.HeapSize += d.RetainedSize
+	}
+	if report.HeapSize == 0 {
+		return report, nil
+	}
+	threshold := int64(float64(report.HeapSize) * opts.Threshold)
+
+	// 按类汇总不够大的顶层对象
+	groups := map[string][]Dominator{}
+	for _, d := range top {
+		class, err := s.i.GetObjectClassName(d.Id)
+		if err != nil {
+			return nil, err
+		}
+		if d.RetainedSize >= threshold {
+			suspect, err := s.newObjectSuspect(d, class, report.HeapSize, opts)
+			if err != nil {
+				return nil, err
+			}
+			report.Suspects = append(report.Suspects, suspect)
+			continue
+		}
+		groups[class] = append(groups[class], d)
+	}
+	for class, members := range groups {
+		var retained int64
+		for _, d := range members {
+			retained += d.RetainedSize
+		}
+		if retained < threshold {
+			continue
+		}
+		suspect, err := s.newClassSuspect(class, members, retained, report.HeapSize, opts)
+		if err != nil {
+			return nil, err
+		}
+		report.Suspects = append(report.Suspects, suspect)
+	}
+	sort.Slice(report.Suspects, func(a, b int) bool {
+		return report.Suspects[a].RetainedSize > report.Suspects[b].RetainedSize
+	})
+	return report, nil
+}
+
+func (s *Snapshot) newObjectSuspect(d Dominator, class string, heapSize int64, opts *LeakSuspectsOptions) (*LeakSuspect, error) {
+	suspect := &LeakSuspect{
+		Kind:          LeakSuspectObject,
+		Class:         class,
+		Id:            d.Id,
+		InstanceCount: 1,
+		RetainedSize:  d.RetainedSize,
+		Percentage:    float64(d.RetainedSize) * 100 / float64(heapSize),
+	}
+	point, err := s.findAccumulationPoint(d, class, opts.AccumulationRatio)
+	if err != nil {
+		return nil, err
+	}
+	suspect.AccumulationPoint = point
+	paths, err := s.FindPathsToGCRoots(d.Id, 1, weakReferenceStrengths)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) > 0 {
+		suspect.PathToGCRoot = paths[0]
+	}
+	suspect.DominatedClasses, err = s.groupDominatedByClass([]uint64{point.Id}, opts.MaxClasses)
+	return suspect, err
+}
+
+func (s *Snapshot) newClassSuspect(class string, members []Dominator, retained, heapSize int64, opts *LeakSuspectsOptions) (*LeakSuspect, error) {
+	suspect := &LeakSuspect{
+		Kind:          LeakSuspectClass,
+		Class:         class,
+		InstanceCount: int64(len(members)),
+		RetainedSize:  retained,
+		Percentage:    float64(retained) * 100 / float64(heapSize),
+	}
+	// members 已经按 retained size 降序排列，用最大的一个展示引用路径
+	paths, err := s.FindPathsToGCRoots(members[0].Id, 1, weakReferenceStrengths)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) > 0 {
+		suspect.PathToGCRoot = paths[0]
+	}
+	ids := make([]uint64, 0, len(members))
+	for _, d := range members {
+		ids = append(ids, d.Id)
+	}
+	suspect.DominatedClasses, err = s.groupDominatedByClass(ids, opts.MaxClasses)
+	return suspect, err
+}
+
+// weakReferenceStrengths 查找泄漏路径时忽略的引用
+var weakReferenceStrengths = []model.ReferenceStrength{
+	model.ReferenceSoft, model.ReferenceWeak, model.ReferencePhantom, model.ReferenceFinal,
+}
+
+// findAccumulationPoint 沿着支配树中 retained size 最大的子节点向下查找，
+// 直到子节点的 retained size 占比小于 ratio
+func (s *Snapshot) findAccumulationPoint(d Dominator, class string, ratio float64) (*ObjectSize, error) {
+	point := &ObjectSize{Id: d.Id, Class: class, RetainedSize: d.RetainedSize}
+	for {
+		children, err := s.ListDominated(point.Id)
+		if err != nil {
+			return nil, err
+		}
+		if len(children) == 0 || float64(children[0].RetainedSize) < float64(point.RetainedSize)*ratio {
+			point.Display, err = s.RenderValue(point.Id)
+			if err != nil {
+				return nil, err
+			}
+			return point, nil
+		}
+		child := children[0]
+		class, err := s.i.GetObjectClassName(child.Id)
+		if err != nil {
+			return nil, err
+		}
+		point = &ObjectSize{Id: child.Id, Class: class, RetainedSize: child.RetainedSize}
+	}
+}
+
+// groupDominatedByClass 把 ids 直接支配的对象按类汇总，返回 retained size 最大的 limit 个类
+func (s *Snapshot) groupDominatedByClass(ids []uint64, limit int) ([]*ClassSize, error) {
+	classes := map[string]*ClassSize{}
+	for _, id := range ids {
+		children, err := s.ListDominated(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			name, err := s.i.GetObjectClassName(child.Id)
+			if err != nil {
+				return nil, err
+			}
+			c, exist := classes[name]
+			if !exist {
+				c = &ClassSize{Class: name}
+				classes[name] = c
+			}
+			c.Count++
+			c.RetainedSize += child.RetainedSize
+		}
+	}
+	result := make([]*ClassSize, 0, len(classes))
+	for _, c := range classes {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].RetainedSize > result[b].RetainedSize
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
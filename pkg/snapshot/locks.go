@@ -0,0 +1,305 @@
+package snapshot
+
+import (
+	"hprof-tool/pkg/model"
+	"sort"
+)
+
+const abstractOwnableSynchronizerClassName = "java.util.concurrent.locks.AbstractOwnableSynchronizer"
+
+// maxQueueLength 遍历 AQS 等待队列的最大长度，避免 dump 中的链表有环
+const maxQueueLength = 100000
+
+const (
+	// MonitorIntrinsic synchronized 使用的对象锁，来自 ROOT MONITOR USED
+	MonitorIntrinsic = "monitor"
+	// MonitorSynchronizer java.util.concurrent.locks 中基于 AQS 的锁
+	MonitorSynchronizer = "synchronizer"
+)
+
+// ThreadRef 线程的简要信息
+type ThreadRef struct {
+	SerialNumber uint32 `json:"serialNumber,omitempty"`
+	ObjectId     uint64 `json:"objectId"`
+	Name         string `json:"name"`
+	State        string `json:"state,omitempty"`
+}
+
+// MonitorInfo 被用作锁的对象
+// hprof 没有记录内置锁的持有者，Owner 只对 synchronizer 有效，内置锁只能给出可能的持有者
+type MonitorInfo struct {
+	Id      uint64     `json:"id"`
+	Class   string     `json:"class"`
+	Display string     `json:"display,omitempty"`
+	Kind    string     `json:"kind"`
+	Owner   *ThreadRef `json:"owner,omitempty"`
+	// 调用栈中引用了这个对象，并且没有在等待它的线程
+	OwnerCandidates []*ThreadRef `json:"ownerCandidates,omitempty"`
+	// 等待获取锁的线程
+	Blocked []*ThreadRef `json:"blocked,omitempty"`
+	// 在 Object.wait 中等待通知的线程，已经释放了锁
+	Waiting []*ThreadRef `json:"waiting,omitempty"`
+}
+
+// LockWait 线程等待另一个线程持有的锁，Inferred 表示持有者是根据调用栈推测的
+type LockWait struct {
+	Thread   *ThreadRef `json:"thread"`
+	Lock     *ObjectRef `json:"lock"`
+	Owner    *ThreadRef `json:"owner"`
+	Inferred bool       `json:"inferred"`
+}
+
+// Deadlock 互相等待的一组线程
+type Deadlock struct {
+	Waits    []*LockWait `json:"waits"`
+	Inferred bool        `json:"inferred"`
+}
+
+type LocksReport struct {
+	Monitors  []*MonitorInfo `json:"monitors"`
+	Waits     []*LockWait    `json:"waits"`
+	Deadlocks []*Deadlock    `json:"deadlocks"`
+}
+
+// lockAnalyzer 保存分析过程中的线程信息
+type lockAnalyzer struct {
+	s       *Snapshot
+	threads map[uint64]*ThreadInfo
+	refs    map[uint64]*ThreadRef
+}
+
+// AnalyzeLocks 列出被用作锁的对象和等待锁的线程，并在等待关系中查找死锁
+// 内置锁来自 ROOT MONITOR USED，结合线程调用栈中的局部变量推测等待和持有的线程，
+// synchronizer 从 exclusiveOwnerThread 和 AQS 等待队列中读出持有和等待的线程
+func (s *Snapshot) AnalyzeLocks() (*LocksReport, error) {
+	overview, err := s.GetThreadOverview()
+	if err != nil {
+		return nil, err
+	}
+	a := &lockAnalyzer{s: s, threads: map[uint64]*ThreadInfo{}, refs: map[uint64]*ThreadRef{}}
+	for _, t := range overview {
+		a.threads[t.ObjectId] = t
+	}
+
+	report := &LocksReport{}
+	for _, id := range s.ListGCRootIds(model.GCRootType_BUSY_MONITOR) {
+		monitor, waits, err := a.intrinsicMonitor(id)
+		if err != nil {
+			return nil, err
+		}
+		report.Monitors = append(report.Monitors, monitor)
+		report.Waits = append(report.Waits, waits...)
+	}
+	synchronizers, err := s.listInstances(abstractOwnableSynchronizerClassName, true, ReachableObjects)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range synchronizers {
+		monitor, waits, err := a.synchronizer(id)
+		if err != nil {
+			return nil, err
+		}
+		if monitor == nil {
+			continue
+		}
+		report.Monitors = append(report.Monitors, monitor)
+		report.Waits = append(report.Waits, waits...)
+	}
+	report.Deadlocks = findDeadlocks(report.Waits)
+	return report, nil
+}
+
+// intrinsicMonitor 根据调用栈推测内置锁的等待和持有线程
+// 栈顶是 Object.wait 并且前两个栈帧引用了锁对象的线程在等待通知，
+// BLOCKED 状态并且栈顶栈帧引用了锁对象的线程在等待获取锁
+func (a *lockAnalyzer) intrinsicMonitor(id uint64) (*MonitorInfo, []*LockWait, error) {
+	monitor, err := a.newMonitor(id, MonitorIntrinsic)
+	if err != nil {
+		return nil, nil, err
+	}
+	var blocked []*ThreadInfo
+	for _, t := range a.sortedThreads() {
+		depth := localDepth(t, id)
+		if depth < 0 {
+			continue
+		}
+		ref := a.threadRef(t)
+		switch {
+		case len(t.Frames) > 0 && t.Frames[0].Class == "java.lang.Object" && t.Frames[0].Method == "wait" && depth <= 1:
+			monitor.Waiting = append(monitor.Waiting, ref)
+		case t.State == "BLOCKED" && depth == 0:
+			monitor.Blocked = append(monitor.Blocked, ref)
+			blocked = append(blocked, t)
+		default:
+			monitor.OwnerCandidates = append(monitor.OwnerCandidates, ref)
+		}
+	}
+	var waits []*LockWait
+	if len(monitor.OwnerCandidates) == 1 {
+		lock := &ObjectRef{Id: monitor.Id, Class: monitor.Class, Display: monitor.Display}
+		for _, t := range blocked {
+			waits = append(waits, &LockWait{
+				Thread:   a.threadRef(t),
+				Lock:     lock,
+				Owner:    monitor.OwnerCandidates[0],
+				Inferred: true,
+			})
+		}
+	}
+	return monitor, waits, nil
+}
+
+// synchronizer 读取 AQS 的持有线程和等待队列，没有被持有也没有等待线程时返回 nil
+func (a *lockAnalyzer) synchronizer(id uint64) (*MonitorInfo, []*LockWait, error) {
+	_, fields, err := a.s.ReadFields(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	owner := fields.Object("exclusiveOwnerThread")
+	// JDK 14 之前等待线程在 Node.thread 中，之后是 Node.waiter
+	var waiters []uint64
+	visited := map[uint64]bool{}
+	for node := fields.Object("head"); node != 0 && !visited[node] && len(visited) < maxQueueLength; {
+		visited[node] = true
+		_, nodeFields, err := a.s.ReadFields(node)
+		if err != nil {
+			return nil, nil, err
+		}
+		if t := nodeFields.Object("thread"); t != 0 {
+			waiters = append(waiters, t)
+		} else if t := nodeFields.Object("waiter"); t != 0 {
+			waiters = append(waiters, t)
+		}
+		node = nodeFields.Object("next")
+	}
+	if owner == 0 && len(waiters) == 0 {
+		return nil, nil, nil
+	}
+
+	monitor, err := a.newMonitor(id, MonitorSynchronizer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if owner != 0 {
+		if monitor.Owner, err = a.threadRefById(owner); err != nil {
+			return nil, nil, err
+		}
+	}
+	var waits []*LockWait
+	lock := &ObjectRef{Id: monitor.Id, Class: monitor.Class, Display: monitor.Display}
+	for _, t := range waiters {
+		ref, err := a.threadRefById(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		monitor.Blocked = append(monitor.Blocked, ref)
+		if monitor.Owner != nil && t != owner {
+			waits = append(waits, &LockWait{Thread: ref, Lock: lock, Owner: monitor.Owner})
+		}
+	}
+	return monitor, waits, nil
+}
+
+func (a *lockAnalyzer) newMonitor(id uint64, kind string) (*MonitorInfo, error) {
+	class, err := a.s.i.GetObjectClassName(id)
+	if err != nil {
+		return nil, err
+	}
+	display, err := a.s.RenderValue(id)
+	if err != nil {
+		return nil, err
+	}
+	return &MonitorInfo{Id: id, Class: class, Display: display, Kind: kind}, nil
+}
+
+// sortedThreads 按 SerialNumber 返回线程，保证结果的顺序稳定
+func (a *lockAnalyzer) sortedThreads() []*ThreadInfo {
+	result := make([]*ThreadInfo, 0, len(a.threads))
+	for _, t := range a.threads {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SerialNumber < result[j].SerialNumber })
+	return result
+}
+
+func (a *lockAnalyzer) threadRef(t *ThreadInfo) *ThreadRef {
+	if ref, exist := a.refs[t.ObjectId]; exist {
+		return ref
+	}
+	ref := &ThreadRef{SerialNumber: t.SerialNumber, ObjectId: t.ObjectId, Name: t.Name, State: t.State}
+	a.refs[t.ObjectId] = ref
+	return ref
+}
+
+// threadRefById 返回线程对象对应的线程，不在线程列表中的线程对象使用 RenderValue 作为名字
+func (a *lockAnalyzer) threadRefById(id uint64) (*ThreadRef, error) {
+	if t, exist := a.threads[id]; exist {
+		return a.threadRef(t), nil
+	}
+	if ref, exist := a.refs[id]; exist {
+		return ref, nil
+	}
+	name, err := a.s.RenderValue(id)
+	if err != nil {
+		return nil, err
+	}
+	ref := &ThreadRef{ObjectId: id, Name: name}
+	a.refs[id] = ref
+	return ref, nil
+}
+
+// localDepth 返回引用了对象的最上面的栈帧下标，没有引用时返回 -1
+func localDepth(t *ThreadInfo, id uint64) int {
+	for i, f := range t.Frames {
+		for _, local := range f.Locals {
+			if local.Id == id {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// findDeadlocks 在线程的等待关系中查找环，每个环只返回一次
+func findDeadlocks(waits []*LockWait) []*Deadlock {
+	edges := map[uint64][]*LockWait{}
+	var threads []uint64
+	for _, w := range waits {
+		if _, exist := edges[w.Thread.ObjectId]; !exist {
+			threads = append(threads, w.Thread.ObjectId)
+		}
+		edges[w.Thread.ObjectId] = append(edges[w.Thread.ObjectId], w)
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i] < threads[j] })
+
+	var result []*Deadlock
+	// 只从环中 id 最小的线程开始记录，避免同一个环出现多次
+	var path []*LockWait
+	onPath := map[uint64]bool{}
+	var visit func(start, current uint64)
+	visit = func(start, current uint64) {
+		onPath[current] = true
+		for _, w := range edges[current] {
+			next := w.Owner.ObjectId
+			if next < start {
+				continue
+			}
+			path = append(path, w)
+			if next == start {
+				d := &Deadlock{Waits: append([]*LockWait(nil), path...)}
+				for _, pw := range d.Waits {
+					d.Inferred = d.Inferred || pw.Inferred
+				}
+				result = append(result, d)
+			} else if !onPath[next] {
+				visit(start, next)
+			}
+			path = path[:len(path)-1]
+		}
+		onPath[current] = false
+	}
+	for _, t := range threads {
+		visit(t, t)
+	}
+	return result
+}
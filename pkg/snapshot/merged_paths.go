@@ -0,0 +1,198 @@
+package snapshot
+
+import (
+	"hprof-tool/pkg/model"
+	"sort"
+)
+
+type MergedPathsOptions struct {
+	// 最多计算路径的对象个数，超过时只计算 id 最小的对象
+	MaxObjects int
+	// 这些引用强度的 referent 字段不会出现在路径上
+	Excluded []model.ReferenceStrength
+}
+
+func DefaultMergedPathsOptions() *MergedPathsOptions {
+	return &MergedPathsOptions{
+		MaxObjects: 1000,
+	}
+}
+
+// MergedPathNode 合并后的路径树的一个节点，路径上类和字段都相同的对象合并到同一个节点
+type MergedPathNode struct {
+	Class string `json:"class"`
+	// 上一层节点中指向这一层对象的字段，顶层节点为空
+	Field string `json:"field,omitempty"`
+	// 顶层节点的 GC root 类型
+	RootTypes []string `json:"rootTypes,omitempty"`
+	// 经过这个节点的不同对象的个数和 shallow size
+	Objects     int   `json:"objects"`
+	ShallowSize int64 `json:"shallowSize"`
+	// 路径经过这个节点的目标对象的个数和 shallow size
+	Targets    int               `json:"targets"`
+	TargetSize int64             `json:"targetSize"`
+	Children   []*MergedPathNode `json:"children"`
+
+	objects  map[uint64]bool
+	children map[string]*MergedPathNode
+}
+
+type MergedPathsReport struct {
+	// 选中的对象个数，Analyzed 是实际计算了路径的个数
+	Objects     int   `json:"objects"`
+	Analyzed    int   `json:"analyzed"`
+	TargetSize  int64 `json:"targetSize"`
+	Unreachable int   `json:"unreachable"`
+	// 从 GC root 出发的路径树，按 Targets 降序
+	Roots []*MergedPathNode `json:"roots"`
+}
+
+// MergePathsToGCRoots 计算每个对象到 GC root 的最短路径，从 GC root 开始按类和字段合并成一棵树
+func (s *Snapshot) MergePathsToGCRoots(ids []uint64, opts *MergedPathsOptions) (*MergedPathsReport, error) {
+	if opts == nil {
+		opts = DefaultMergedPathsOptions()
+	}
+	report := &MergedPathsReport{Objects: len(ids), Roots: []*MergedPathNode{}}
+	if len(ids) > opts.MaxObjects {
+		sorted := append([]uint64(nil), ids...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		ids = sorted[:opts.MaxObjects]
+	}
+	root := &MergedPathNode{children: map[string]*MergedPathNode{}}
+	// class 对象的 shallow size 为 0
+	sizes := map[uint64]int64{}
+	sizeOf := func(id uint64) (int64, error) {
+		size, exist := sizes[id]
+		if !exist {
+			var err error
+			if size, err = s.GetShallowSize(id); err != nil {
+				return 0, err
+			}
+			sizes[id] = size
+		}
+		return size, nil
+	}
+	paths, err := s.shortestPathsToGCRoots(ids, opts.Excluded)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		path := paths[id]
+		report.Analyzed++
+		targetSize, err := sizeOf(id)
+		if err != nil {
+			return nil, err
+		}
+		report.TargetSize += targetSize
+		if path == nil {
+			report.Unreachable++
+			continue
+		}
+		parent := root
+		for idx, v := range path {
+			class, err := s.i.GetObjectClassName(v)
+			if err != nil {
+				return nil, err
+			}
+			field := ""
+			if idx > 0 {
+				if field, err = s.referenceFieldName(path[idx-1], v); err != nil {
+					return nil, err
+				}
+			}
+			key := field + " " + class
+			node, exist := parent.children[key]
+			if !exist {
+				node = &MergedPathNode{Class: class, Field: field, objects: map[uint64]bool{}, children: map[string]*MergedPathNode{}}
+				if idx == 0 {
+					for _, r := range s.i.GetGCRoots(v) {
+						node.RootTypes = append(node.RootTypes, model.GCRootTypeName(r.Typ))
+					}
+				}
+				parent.children[key] = node
+				parent.Children = append(parent.Children, node)
+			}
+			if !node.objects[v] {
+				node.objects[v] = true
+				size, err := sizeOf(v)
+				if err != nil {
+					return nil, err
+				}
+				node.Objects++
+				node.ShallowSize += size
+			}
+			node.Targets++
+			node.TargetSize += targetSize
+			parent = node
+		}
+	}
+	report.Roots = root.Children
+	sortMergedPathNodes(report.Roots)
+	return report, nil
+}
+
+func sortMergedPathNodes(nodes []*MergedPathNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Targets != nodes[j].Targets {
+			return nodes[i].Targets > nodes[j].Targets
+		}
+		return nodes[i].ShallowSize > nodes[j].ShallowSize
+	})
+	for _, node := range nodes {
+		if node.Children == nil {
+			node.Children = []*MergedPathNode{}
+		}
+		sortMergedPathNodes(node.Children)
+	}
+}
+
+// shortestPathsToGCRoots 返回从 GC root 到每个对象的一条最短路径，第一个是 GC root，不可达的对象没有路径
+// 从所有 GC root 同时开始 BFS，每个对象记录第一次访问到它的对象，所有对象都访问到后停止
+func (s *Snapshot) shortestPathsToGCRoots(ids []uint64, excluded []model.ReferenceStrength) (map[uint64][]uint64, error) {
+	// 从 GC root 不可达的对象不会被访问到，不需要等它们
+	remaining := map[uint64]bool{}
+	for _, id := range ids {
+		reachable, _, err := s.i.GetReachability(id)
+		if err != nil {
+			return nil, err
+		}
+		if reachable {
+			remaining[id] = true
+		}
+	}
+	// prev 记录 BFS 时每个对象指向 GC root 方向的上一个对象，GC root 指向自身
+	prev := map[uint64]uint64{}
+	var queue []uint64
+	for _, root := range s.i.ListAllGCRootIds() {
+		prev[root] = root
+		queue = append(queue, root)
+	}
+	result := map[uint64][]uint64{}
+	for len(queue) > 0 && len(remaining) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		if remaining[v] {
+			delete(remaining, v)
+			path := []uint64{v}
+			for u := v; prev[u] != u; u = prev[u] {
+				path = append(path, prev[u])
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			result[v] = path
+		}
+		err := s.i.ListOutboundReferences(v, func(to uint64, typ int, strength model.ReferenceStrength) error {
+			if _, visited := prev[to]; visited || model.ContainsReferenceStrength(excluded, strength) {
+				return nil
+			}
+			prev[to] = v
+			queue = append(queue, to)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
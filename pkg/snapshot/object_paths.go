@@ -0,0 +1,257 @@
+package snapshot
+
+import (
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+	"sort"
+)
+
+// ReferenceKind 引用的来源，按引用所在的记录区分
+type ReferenceKind string
+
+const (
+	// ReferenceKindField instance 的字段，包括指向自身 class 的引用
+	ReferenceKindField ReferenceKind = "field"
+	// ReferenceKindArray object array 的元素
+	ReferenceKindArray ReferenceKind = "array"
+	// ReferenceKindClass class 的静态字段、父类和 ClassLoader
+	ReferenceKindClass ReferenceKind = "class"
+)
+
+// ParseReferenceKind 解析 field、array、class
+func ParseReferenceKind(s string) (ReferenceKind, error) {
+	switch k := ReferenceKind(s); k {
+	case ReferenceKindField, ReferenceKindArray, ReferenceKindClass:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown reference kind: %s", s)
+}
+
+func referenceKindOf(typ int) ReferenceKind {
+	switch typ {
+	case hprof.HProfHDRecordTypeObjectArrayDump:
+		return ReferenceKindArray
+	case hprof.HProfHDRecordTypeClassDump:
+		return ReferenceKindClass
+	}
+	return ReferenceKindField
+}
+
+type ObjectPathsOptions struct {
+	// 最多返回的路径数
+	MaxPaths int
+	// 路径最多经过的引用数
+	MaxDepth int
+	// 这些引用强度的 referent 字段不会出现在路径上
+	Excluded []model.ReferenceStrength
+	// 只经过这些来源的引用，为空时不限制
+	Kinds []ReferenceKind
+}
+
+func DefaultObjectPathsOptions() *ObjectPathsOptions {
+	return &ObjectPathsOptions{
+		MaxPaths: 10,
+		MaxDepth: 10,
+	}
+}
+
+// ObjectPath 从起点对象到终点对象的引用路径，第一个节点是起点，最后一个节点是终点
+type ObjectPath struct {
+	Nodes []*PathNode `json:"nodes"`
+}
+
+// pathSearch 双向 BFS 中一个方向的状态
+type pathSearch struct {
+	// 到起点的距离
+	dist map[uint64]int
+	// 上一层中指向起点方向的对象，同一层可能有多个
+	links    map[uint64][]uint64
+	frontier []uint64
+	depth    int
+}
+
+func newPathSearch(origin uint64) *pathSearch {
+	return &pathSearch{
+		dist:     map[uint64]int{origin: 0},
+		links:    map[uint64][]uint64{},
+		frontier: []uint64{origin},
+	}
+}
+
+// FindPathsBetween 返回从 from 到 to 的最短引用路径，最多 opts.MaxPaths 条
+// 从两端交替做 BFS，每次扩展 frontier 较小的一端，超过 opts.MaxDepth 时返回空
+func (s *Snapshot) FindPathsBetween(from, to uint64, opts *ObjectPathsOptions) ([]*ObjectPath, error) {
+	if opts == nil {
+		opts = DefaultObjectPathsOptions()
+	}
+	// 确认对象存在
+	for _, id := range []uint64{from, to} {
+		if _, err := s.i.GetObjectClassName(id); err != nil {
+			return nil, err
+		}
+	}
+	if from == to {
+		nodes, err := s.newPathNodes([]uint64{from})
+		if err != nil {
+			return nil, err
+		}
+		return []*ObjectPath{{Nodes: nodes}}, nil
+	}
+
+	allowed := func(typ int, strength model.ReferenceStrength) bool {
+		if model.ContainsReferenceStrength(opts.Excluded, strength) {
+			return false
+		}
+		if len(opts.Kinds) == 0 {
+			return true
+		}
+		kind := referenceKindOf(typ)
+		for _, k := range opts.Kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+	forward, backward := newPathSearch(from), newPathSearch(to)
+	length := -1
+	for forward.depth+backward.depth < opts.MaxDepth {
+		if len(forward.frontier) == 0 || len(backward.frontier) == 0 {
+			return []*ObjectPath{}, nil
+		}
+		var err error
+		if len(forward.frontier) <= len(backward.frontier) {
+			err = forward.expand(func(id uint64) ([]uint64, error) {
+				var result []uint64
+				err := s.i.ListOutboundReferences(id, func(ref uint64, typ int, strength model.ReferenceStrength) error {
+					if allowed(typ, strength) {
+						result = append(result, ref)
+					}
+					return nil
+				})
+				return result, err
+			})
+		} else {
+			err = backward.expand(func(id uint64) ([]uint64, error) {
+				froms, err := s.listInbounds(id)
+				if err != nil {
+					return nil, err
+				}
+				var result []uint64
+				for _, in := range froms {
+					if allowed(in.typ, in.strength) {
+						result = append(result, in.from)
+					}
+				}
+				return result, nil
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+		// 扩展完一整层后，两端都访问过的对象中距离之和最小的就是最短路径的长度
+		for id, d := range forward.dist {
+			if db, exist := backward.dist[id]; exist && (length < 0 || d+db < length) {
+				length = d + db
+			}
+		}
+		if length >= 0 {
+			break
+		}
+	}
+	if length < 0 {
+		return []*ObjectPath{}, nil
+	}
+
+	// 每条最短路径上距离 from 为 k 的对象两端都访问过，以这些对象为分界点拼接路径，不会重复
+	k := forward.depth
+	if k > length {
+		k = length
+	}
+	var meetings []uint64
+	for id, d := range forward.dist {
+		if db, exist := backward.dist[id]; exist && d == k && db == length-k {
+			meetings = append(meetings, id)
+		}
+	}
+	sort.Slice(meetings, func(i, j int) bool { return meetings[i] < meetings[j] })
+
+	result := []*ObjectPath{}
+	for _, m := range meetings {
+		prefixes := chainsToOrigin(forward.links, m, opts.MaxPaths-len(result))
+		for _, prefix := range prefixes {
+			suffixes := chainsToOrigin(backward.links, m, opts.MaxPaths-len(result))
+			for _, suffix := range suffixes {
+				// prefix 从 m 到 from，suffix 从 m 到 to
+				ids := make([]uint64, 0, len(prefix)+len(suffix)-1)
+				for i := len(prefix) - 1; i >= 0; i-- {
+					ids = append(ids, prefix[i])
+				}
+				ids = append(ids, suffix[1:]...)
+				nodes, err := s.newPathNodes(ids)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, &ObjectPath{Nodes: nodes})
+				if len(result) >= opts.MaxPaths {
+					return result, nil
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// expand 扩展一层，neighbors 返回对象在搜索方向上相邻的对象
+func (search *pathSearch) expand(neighbors func(id uint64) ([]uint64, error)) error {
+	var next []uint64
+	depth := search.depth + 1
+	for _, v := range search.frontier {
+		list, err := neighbors(v)
+		if err != nil {
+			return err
+		}
+		for _, n := range list {
+			d, visited := search.dist[n]
+			if !visited {
+				search.dist[n] = depth
+				search.links[n] = []uint64{v}
+				next = append(next, n)
+				continue
+			}
+			if d != depth {
+				continue
+			}
+			// 两个对象之间可能有多个引用
+			links := search.links[n]
+			if links[len(links)-1] != v {
+				search.links[n] = append(links, v)
+			}
+		}
+	}
+	search.frontier = next
+	search.depth = depth
+	return nil
+}
+
+// chainsToOrigin 沿 links 返回从 id 到起点的最多 limit 条对象链
+func chainsToOrigin(links map[uint64][]uint64, id uint64, limit int) [][]uint64 {
+	if limit <= 0 {
+		return nil
+	}
+	prev, exist := links[id]
+	if !exist {
+		return [][]uint64{{id}}
+	}
+	var result [][]uint64
+	for _, p := range prev {
+		for _, chain := range chainsToOrigin(links, p, limit-len(result)) {
+			result = append(result, append([]uint64{id}, chain...))
+		}
+		if len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
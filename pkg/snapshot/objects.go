@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"math"
+	"strings"
+)
+
+// GetObjectClassName 返回对象的类名，class 对象返回 "class xxx"
+func (s *Snapshot) GetObjectClassName(id uint64) (string, error) {
+	return s.i.GetObjectClassName(id)
+}
+
+// GetObjectArrayElements 返回 object array 的元素，null 元素为 0
+func (s *Snapshot) GetObjectArrayElements(id uint64) ([]uint64, error) {
+	return s.i.GetObjectArrayElements(id)
+}
+
+// ReadPrimitiveArray 返回 primitive array 的元素
+// boolean 为 bool，char 为 rune，float 和 double 为 float64，其他整数类型为 int64
+func (s *Snapshot) ReadPrimitiveArray(id uint64) ([]interface{}, error) {
+	array, err := s.i.GetPrimitiveArray(id)
+	if err != nil {
+		return nil, err
+	}
+	size := hprof.ValueSize[array.ElementType]
+	if size <= 0 {
+		return nil, fmt.Errorf("unknown primitive array type %d of 0x%x", array.ElementType, id)
+	}
+	result := make([]interface{}, len(array.Values)/size)
+	for idx := range result {
+		b := array.Values[idx*size : (idx+1)*size]
+		switch array.ElementType {
+		case hprof.HProfValueType_BOOLEAN:
+			result[idx] = b[0] != 0
+		case hprof.HProfValueType_BYTE:
+			result[idx] = int64(int8(b[0]))
+		case hprof.HProfValueType_CHAR:
+			result[idx] = rune(binary.BigEndian.Uint16(b))
+		case hprof.HProfValueType_SHORT:
+			result[idx] = int64(int16(binary.BigEndian.Uint16(b)))
+		case hprof.HProfValueType_INT:
+			result[idx] = int64(int32(binary.BigEndian.Uint32(b)))
+		case hprof.HProfValueType_LONG:
+			result[idx] = int64(binary.BigEndian.Uint64(b))
+		case hprof.HProfValueType_FLOAT:
+			result[idx] = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		case hprof.HProfValueType_DOUBLE:
+			result[idx] = math.Float64frombits(binary.BigEndian.Uint64(b))
+		}
+	}
+	return result, nil
+}
+
+// CountInboundReferences 返回引用了对象的不同对象个数
+func (s *Snapshot) CountInboundReferences(id uint64) (int, error) {
+	froms, err := s.listInbounds(id)
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[uint64]bool, len(froms))
+	for _, in := range froms {
+		seen[in.from] = true
+	}
+	return len(seen), nil
+}
+
+// GetArrayLength 返回数组的元素个数
+func (s *Snapshot) GetArrayLength(id uint64) (int, error) {
+	className, err := s.i.GetObjectClassName(id)
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasPrefix(className, "[") {
+		elements, err := s.i.GetObjectArrayElements(id)
+		return len(elements), err
+	}
+	array, err := s.i.GetPrimitiveArray(id)
+	if err != nil {
+		return 0, err
+	}
+	size := hprof.ValueSize[array.ElementType]
+	if size <= 0 {
+		return 0, fmt.Errorf("unknown primitive array type %d of 0x%x", array.ElementType, id)
+	}
+	return len(array.Values) / size, nil
+}
+
+// GetObjectRef 返回对象的类名和便于阅读的值，id 为 0 时返回表示 null 的 ObjectRef
+func (s *Snapshot) GetObjectRef(id uint64) (*ObjectRef, error) {
+	return s.newObjectRef(id)
+}
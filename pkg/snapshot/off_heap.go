@@ -0,0 +1,412 @@
+package snapshot
+
+import (
+	"errors"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+	"sort"
+	"strings"
+)
+
+const (
+	directByteBufferClassName = "java.nio.DirectByteBuffer"
+	bitsClassName             = "java.nio.Bits"
+	nettyPoolArenaClassName   = "io.netty.buffer.PoolArena"
+	nettyPlatformClassName    = "io.netty.util.internal.PlatformDependent"
+)
+
+const (
+	// DirectBufferActive 可达的 buffer，内存还在使用
+	DirectBufferActive = "active"
+	// DirectBufferPending 已经不是强可达的 buffer，下次 GC 后 Cleaner 会释放内存
+	DirectBufferPending = "pending"
+	// DirectBufferFreed Cleaner 已经执行，内存已经释放
+	DirectBufferFreed = "freed"
+	// DirectBufferUnmanaged 没有 Cleaner，比如 JNI NewDirectByteBuffer 或 Netty 自己释放的内存
+	DirectBufferUnmanaged = "unmanaged"
+)
+
+// offHeapOwnerSkippedPrefixes 查找 buffer 的持有者时跳过的 NIO 和 Reference 内部类
+var offHeapOwnerSkippedPrefixes = []string{
+	"java.nio.",
+	"sun.nio.",
+	"java.lang.ref.",
+	"sun.misc.Cleaner",
+	"jdk.internal.ref.",
+}
+
+const (
+	offHeapOwnerGCRoot      = "<GC root>"
+	offHeapOwnerPending     = "<pending cleanup>"
+	offHeapOwnerUnreachable = "<unreachable>"
+)
+
+type OffHeapOptions struct {
+	// 最多列出的 buffer 个数
+	MaxBuffers int
+	// 最多列出的持有者个数
+	MaxOwners int
+	// 沿支配树向上查找持有者的最大层数
+	MaxOwnerDepth int
+}
+
+func DefaultOffHeapOptions() *OffHeapOptions {
+	return &OffHeapOptions{
+		MaxBuffers:    20,
+		MaxOwners:     20,
+		MaxOwnerDepth: 8,
+	}
+}
+
+// DirectBuffer 一个自己分配了内存的 DirectByteBuffer，slice、duplicate 和视图共享原 buffer 的内存，不单独列出
+type DirectBuffer struct {
+	Id       uint64 `json:"id"`
+	Class    string `json:"class"`
+	Capacity int64  `json:"capacity"`
+	Address  uint64 `json:"address"`
+	// FileChannel.map 创建的 buffer，内存来自 mmap，不受 MaxDirectMemorySize 限制
+	Mapped bool       `json:"mapped"`
+	State  string     `json:"state"`
+	Owner  *ObjectRef `json:"owner,omitempty"`
+}
+
+// OffHeapOwner 持有 buffer 的一类对象
+type OffHeapOwner struct {
+	Class    string `json:"class"`
+	Count    int64  `json:"count"`
+	Capacity int64  `json:"capacity"`
+}
+
+// NettyArena Netty 的 PoolArena，chunk 的内存在 DirectByteBuffer 中也会被统计
+type NettyArena struct {
+	Id        uint64 `json:"id"`
+	Class     string `json:"class"`
+	Chunks    int64  `json:"chunks"`
+	ChunkSize int64  `json:"chunkSize"`
+	FreeBytes int64  `json:"freeBytes"`
+}
+
+type OffHeapReport struct {
+	// 所有自己分配了内存的 buffer，不包括已经释放的
+	DirectCount    int64 `json:"directCount"`
+	DirectCapacity int64 `json:"directCapacity"`
+	// 其中等待 Cleaner 释放的
+	PendingCount    int64 `json:"pendingCount"`
+	PendingCapacity int64 `json:"pendingCapacity"`
+	MappedCount     int64 `json:"mappedCount"`
+	MappedCapacity  int64 `json:"mappedCapacity"`
+	// slice、duplicate 和其他视图的个数
+	ViewCount int64 `json:"viewCount"`
+	// 估计的堆外内存，等于 DirectCapacity
+	EstimatedNativeMemory int64 `json:"estimatedNativeMemory"`
+
+	// java.nio.Bits 中的统计，-1 表示 dump 中没有
+	ReservedMemory  int64 `json:"reservedMemory"`
+	TotalCapacity   int64 `json:"totalCapacity"`
+	BufferCount     int64 `json:"bufferCount"`
+	MaxDirectMemory int64 `json:"maxDirectMemory"`
+	// io.netty.util.internal.PlatformDependent.DIRECT_MEMORY_COUNTER，-1 表示没有
+	NettyDirectMemory int64 `json:"nettyDirectMemory"`
+
+	Buffers     []*DirectBuffer `json:"buffers"`
+	Owners      []*OffHeapOwner `json:"owners"`
+	NettyArenas []*NettyArena   `json:"nettyArenas"`
+}
+
+// AnalyzeOffHeap 根据堆中的 DirectByteBuffer 和 Netty 的 PoolArena 估计堆外内存，按持有者汇总
+func (s *Snapshot) AnalyzeOffHeap(opts *OffHeapOptions) (*OffHeapReport, error) {
+	report := &OffHeapReport{
+		ReservedMemory:    -1,
+		TotalCapacity:     -1,
+		BufferCount:       -1,
+		MaxDirectMemory:   -1,
+		NettyDirectMemory: -1,
+	}
+	ids, err := s.listInstances(directByteBufferClassName, true, AllObjects)
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string]*OffHeapOwner{}
+	var buffers []*DirectBuffer
+	for _, id := range ids {
+		buffer, err := s.readDirectBuffer(id)
+		if err != nil {
+			return nil, err
+		}
+		if buffer == nil {
+			report.ViewCount++
+			continue
+		}
+		if buffer.State == DirectBufferFreed {
+			continue
+		}
+		if err = s.findOffHeapOwner(buffer, opts.MaxOwnerDepth); err != nil {
+			return nil, err
+		}
+		report.DirectCount++
+		report.DirectCapacity += buffer.Capacity
+		if buffer.State == DirectBufferPending {
+			report.PendingCount++
+			report.PendingCapacity += buffer.Capacity
+		}
+		if buffer.Mapped {
+			report.MappedCount++
+			report.MappedCapacity += buffer.Capacity
+		}
+		name := buffer.Owner.Class
+		o, exist := owners[name]
+		if !exist {
+			o = &OffHeapOwner{Class: name}
+			owners[name] = o
+		}
+		o.Count++
+		o.Capacity += buffer.Capacity
+		buffers = append(buffers, buffer)
+	}
+	report.EstimatedNativeMemory = report.DirectCapacity
+
+	sort.Slice(buffers, func(a, b int) bool {
+		if buffers[a].Capacity != buffers[b].Capacity {
+			return buffers[a].Capacity > buffers[b].Capacity
+		}
+		return buffers[a].Id < buffers[b].Id
+	})
+	if opts.MaxBuffers > 0 && len(buffers) > opts.MaxBuffers {
+		buffers = buffers[:opts.MaxBuffers]
+	}
+	report.Buffers = buffers
+	for _, o := range owners {
+		report.Owners = append(report.Owners, o)
+	}
+	sort.Slice(report.Owners, func(a, b int) bool {
+		if report.Owners[a].Capacity != report.Owners[b].Capacity {
+			return report.Owners[a].Capacity > report.Owners[b].Capacity
+		}
+		return report.Owners[a].Class < report.Owners[b].Class
+	})
+	if opts.MaxOwners > 0 && len(report.Owners) > opts.MaxOwners {
+		report.Owners = report.Owners[:opts.MaxOwners]
+	}
+
+	if err = s.readBitsCounters(report); err != nil {
+		return nil, err
+	}
+	if report.NettyArenas, err = s.readNettyArenas(); err != nil {
+		return nil, err
+	}
+	if cid := s.i.GetClassIdByName(nettyPlatformClassName); cid != 0 {
+		value, ok, err := s.readStaticCounter(cid, "DIRECT_MEMORY_COUNTER")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			report.NettyDirectMemory = value
+		}
+	}
+	return report, nil
+}
+
+// readDirectBuffer 读取 DirectByteBuffer 的容量、地址和 Cleaner 状态，slice 这类共享内存的 buffer 返回 nil
+func (s *Snapshot) readDirectBuffer(id uint64) (*DirectBuffer, error) {
+	_, fields, err := s.ReadFields(id)
+	if err != nil {
+		return nil, err
+	}
+	if fields.Object("att") != 0 {
+		return nil, nil
+	}
+	class, err := s.i.GetObjectClassName(id)
+	if err != nil {
+		return nil, err
+	}
+	buffer := &DirectBuffer{Id: id, Class: class}
+	buffer.Capacity, _ = fields.Integer("capacity")
+	address, _ := fields.Integer("address")
+	buffer.Address = uint64(address)
+	// MappedByteBuffer.fd 只有映射文件时才不为 null
+	buffer.Mapped = fields.Object("fd") != 0
+
+	cleaner := fields.Object("cleaner")
+	if cleaner == 0 {
+		buffer.State = DirectBufferUnmanaged
+		return buffer, nil
+	}
+	_, cleanerFields, err := s.ReadFields(cleaner)
+	if err != nil {
+		return nil, err
+	}
+	// Deallocator 释放内存后把 address 置为 0，Unmapper 也是一样
+	if thunk := cleanerFields.Object("thunk"); thunk != 0 {
+		_, thunkFields, err := s.ReadFields(thunk)
+		if err != nil {
+			return nil, err
+		}
+		if address, ok := thunkFields.Integer("address"); ok && address == 0 {
+			buffer.State = DirectBufferFreed
+			return buffer, nil
+		}
+	}
+	reachable, strength, err := s.i.GetReachability(id)
+	if err != nil {
+		return nil, err
+	}
+	if reachable && strength != model.ReferenceFinal && strength != model.ReferencePhantom {
+		buffer.State = DirectBufferActive
+	} else {
+		buffer.State = DirectBufferPending
+	}
+	return buffer, nil
+}
+
+// findOffHeapOwner 沿支配树向上找到第一个不是 NIO 或 Reference 内部类的对象
+func (s *Snapshot) findOffHeapOwner(buffer *DirectBuffer, maxDepth int) error {
+	if buffer.State == DirectBufferPending {
+		buffer.Owner = &ObjectRef{Class: offHeapOwnerPending}
+		return nil
+	}
+	id := buffer.Id
+	for depth := 0; depth < maxDepth; depth++ {
+		idom, _, err := s.i.GetDominator(id)
+		if errors.Is(err, ErrNotFound) {
+			buffer.Owner = &ObjectRef{Class: offHeapOwnerUnreachable}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if idom == 0 {
+			break
+		}
+		id = idom
+		class, err := s.i.GetObjectClassName(id)
+		if err != nil {
+			return err
+		}
+		if !hasAnyPrefix(class, offHeapOwnerSkippedPrefixes) {
+			buffer.Owner, err = s.newObjectRef(id)
+			return err
+		}
+	}
+	buffer.Owner = &ObjectRef{Class: offHeapOwnerGCRoot}
+	return nil
+}
+
+// readBitsCounters 读取 java.nio.Bits 记录的 direct memory 使用量，JDK 8 和之后的字段名不同
+func (s *Snapshot) readBitsCounters(report *OffHeapReport) error {
+	cid := s.i.GetClassIdByName(bitsClassName)
+	if cid == 0 {
+		return nil
+	}
+	counters := []struct {
+		names []string
+		value *int64
+	}{
+		{[]string{"reservedMemory", "RESERVED_MEMORY"}, &report.ReservedMemory},
+		{[]string{"totalCapacity", "TOTAL_CAPACITY"}, &report.TotalCapacity},
+		{[]string{"count", "COUNT"}, &report.BufferCount},
+		{[]string{"maxMemory", "MAX_MEMORY"}, &report.MaxDirectMemory},
+	}
+	for _, c := range counters {
+		for _, name := range c.names {
+			value, ok, err := s.readStaticCounter(cid, name)
+			if err != nil {
+				return err
+			}
+			if ok {
+				*c.value = value
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// readStaticCounter 读取 long 类型或 AtomicLong 类型的静态字段
+func (s *Snapshot) readStaticCounter(cid uint64, name string) (int64, bool, error) {
+	statics, err := s.i.GetStaticFields(cid)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, sf := range statics {
+		if sf.Name != name {
+			continue
+		}
+		switch sf.Type {
+		case hprof.HProfValueType_LONG:
+			return int64(sf.Value), true, nil
+		case hprof.HProfValueType_OBJECT:
+			if sf.Value == 0 {
+				return 0, false, nil
+			}
+			_, fields, err := s.ReadFields(sf.Value)
+			if err != nil {
+				return 0, false, err
+			}
+			value, ok := fields.Integer("value")
+			return value, ok, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// readNettyArenas 遍历 PoolArena 的各个 PoolChunkList，统计 chunk 的大小和空闲字节数
+func (s *Snapshot) readNettyArenas() ([]*NettyArena, error) {
+	if s.i.GetClassIdByName(nettyPoolArenaClassName) == 0 {
+		return nil, nil
+	}
+	ids, err := s.listInstances(nettyPoolArenaClassName, true, ReachableObjects)
+	if err != nil {
+		return nil, err
+	}
+	var result []*NettyArena
+	for _, id := range ids {
+		class, err := s.i.GetObjectClassName(id)
+		if err != nil {
+			return nil, err
+		}
+		// 只统计 DirectArena，HeapArena 的内存在堆中
+		if !strings.HasSuffix(class, "$DirectArena") {
+			continue
+		}
+		arena := &NettyArena{Id: id, Class: class}
+		_, fields, err := s.ReadFields(id)
+		if err != nil {
+			return nil, err
+		}
+		visited := map[uint64]bool{}
+		for _, name := range []string{"qInit", "q000", "q025", "q050", "q075", "q100"} {
+			list := fields.Object(name)
+			if list == 0 {
+				continue
+			}
+			_, listFields, err := s.ReadFields(list)
+			if err != nil {
+				return nil, err
+			}
+			for chunk := listFields.Object("head"); chunk != 0 && !visited[chunk] && len(visited) < maxQueueLength; {
+				visited[chunk] = true
+				_, chunkFields, err := s.ReadFields(chunk)
+				if err != nil {
+					return nil, err
+				}
+				size, _ := chunkFields.Integer("chunkSize")
+				free, _ := chunkFields.Integer("freeBytes")
+				arena.Chunks++
+				arena.ChunkSize += size
+				arena.FreeBytes += free
+				chunk = chunkFields.Object("next")
+			}
+		}
+		result = append(result, arena)
+	}
+	return result, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
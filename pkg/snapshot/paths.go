@@ -0,0 +1,185 @@
+package snapshot
+
+import (
+	"hprof-tool/pkg/model"
+	"strings"
+)
+
+// PathNode 路径上的一个对象
+type PathNode struct {
+	Id      uint64 `json:"id"`
+	Class   string `json:"class"`
+	Display string `json:"display,omitempty"`
+	// 指向路径中下一个对象的字段，最后一个节点为空
+	Field string `json:"field,omitempty"`
+}
+
+// GCRootPath 从 GC root 到目标对象的引用路径
+type GCRootPath struct {
+	// 第一个节点是 GC root，最后一个节点是目标对象
+	Nodes     []*PathNode `json:"nodes"`
+	RootTypes []string    `json:"rootTypes"`
+	// GC root 所属线程的名称
+	Thread string `json:"thread,omitempty"`
+}
+
+// FindPathsToGCRoots 返回从 GC root 到对象的最多 n 条最短路径，按长度升序
+// 同一个 GC root 可能有多条相同长度的路径，经过同一个对象的不同字段也算不同的路径
+// excluded 中引用强度的 referent 字段不会出现在路径上
+func (s *Snapshot) FindPathsToGCRoots(id uint64, n int, excluded []model.ReferenceStrength) ([]*GCRootPath, error) {
+	// 确认对象存在
+	if _, err := s.i.GetObjectClassName(id); err != nil {
+		return nil, err
+	}
+	// 从对象开始反向 BFS，links 记录每个对象在上一层中指向对象方向的所有对象
+	search := newPathSearch(id)
+	result := []*GCRootPath{}
+	for len(search.frontier) > 0 && len(result) < n {
+		for _, v := range search.frontier {
+			roots := s.i.GetGCRoots(v)
+			if len(roots) == 0 {
+				continue
+			}
+			for _, ids := range chainsToOrigin(search.links, v, n-len(result)) {
+				paths, err := s.buildGCRootPaths(ids, roots, n-len(result))
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, paths...)
+			}
+			if len(result) >= n {
+				return result, nil
+			}
+		}
+		err := search.expand(func(v uint64) ([]uint64, error) {
+			// 路径在 GC root 处结束
+			if len(s.i.GetGCRoots(v)) > 0 {
+				return nil, nil
+			}
+			froms, err := s.listInbounds(v)
+			if err != nil {
+				return nil, err
+			}
+			var result []uint64
+			for _, in := range froms {
+				if !model.ContainsReferenceStrength(excluded, in.strength) {
+					result = append(result, in.from)
+				}
+			}
+			return result, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+type inbound struct {
+	from     uint64
+	typ      int
+	strength model.ReferenceStrength
+}
+
+// listInbounds 先读出所有引用，避免在遍历数据库结果时读取其他记录
+func (s *Snapshot) listInbounds(id uint64) ([]inbound, error) {
+	var result []inbound
+	err := s.i.ListInboundReferences(id, func(from uint64, typ int, strength model.ReferenceStrength) error {
+		result = append(result, inbound{from, typ, strength})
+		return nil
+	})
+	return result, err
+}
+
+// buildGCRootPaths 返回经过 ids 的最多 limit 条路径，ids 的第一个是 GC root
+// 相邻的两个对象之间有多个字段时，每个字段是一条路径
+func (s *Snapshot) buildGCRootPaths(ids []uint64, roots []*model.GCRootInfo, limit int) ([]*GCRootPath, error) {
+	nodes, err := s.newPathNodes(ids)
+	if err != nil {
+		return nil, err
+	}
+	var rootTypes []string
+	var threadId uint64
+	for _, r := range roots {
+		rootTypes = append(rootTypes, model.GCRootTypeName(r.Typ))
+		if r.ThreadId != 0 {
+			threadId = r.ThreadId
+		} else if r.Typ == model.GCRootType_THREAD_OBJ {
+			threadId = ids[0]
+		}
+	}
+	var thread string
+	if threadId != 0 {
+		if thread, err = s.threadName(threadId); err != nil {
+			return nil, err
+		}
+	}
+
+	fields := make([][]string, len(ids)-1)
+	for idx := range fields {
+		if fields[idx], err = s.i.GetReferenceFieldNames(ids[idx], ids[idx+1]); err != nil {
+			return nil, err
+		}
+		if len(fields[idx]) == 0 {
+			fields[idx] = []string{""}
+		}
+	}
+	var result []*GCRootPath
+	var walk func(idx int, path []*PathNode)
+	walk = func(idx int, path []*PathNode) {
+		if len(result) >= limit {
+			return
+		}
+		if idx == len(fields) {
+			result = append(result, &GCRootPath{Nodes: append(path, nodes[idx]), RootTypes: rootTypes, Thread: thread})
+			return
+		}
+		for _, field := range fields[idx] {
+			node := *nodes[idx]
+			node.Field = field
+			walk(idx+1, append(path[:len(path):len(path)], &node))
+		}
+	}
+	walk(0, nil)
+	return result, nil
+}
+
+// threadName 返回线程名，没有 START THREAD 记录时从线程对象的 name 字段读取
+func (s *Snapshot) threadName(threadId uint64) (string, error) {
+	name, err := s.i.GetThreadName(threadId)
+	if err != nil || name != "" {
+		return name, err
+	}
+	return s.RenderValue(threadId)
+}
+
+// newPathNodes 返回路径上每个对象的节点，Field 是指向下一个对象的字段
+func (s *Snapshot) newPathNodes(ids []uint64) ([]*PathNode, error) {
+	nodes := make([]*PathNode, len(ids))
+	for idx, id := range ids {
+		class, err := s.i.GetObjectClassName(id)
+		if err != nil {
+			return nil, err
+		}
+		display, err := s.RenderValue(id)
+		if err != nil {
+			return nil, err
+		}
+		nodes[idx] = &PathNode{Id: id, Class: class, Display: display}
+		if idx+1 < len(ids) {
+			if nodes[idx].Field, err = s.referenceFieldName(id, ids[idx+1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// referenceFieldName 返回 from 中指向 to 的字段，有多个时用逗号分隔
+func (s *Snapshot) referenceFieldName(from, to uint64) (string, error) {
+	names, err := s.i.GetReferenceFieldNames(from, to)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(names, ", "), nil
+}
@@ -0,0 +1,353 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stringClassName = "java.lang.String"
+
+// maxDisplayLength 展示值超过这个字符数时截断
+const maxDisplayLength = 256
+
+// ValueRenderer 把对象转换成便于阅读的字符串，ok 为 false 表示无法处理这个对象
+type ValueRenderer func(s *Snapshot, id uint64, fields FieldValues) (display string, ok bool, err error)
+
+// RendererRegistry 按类名注册的 ValueRenderer，子类没有注册时使用父类的
+type RendererRegistry struct {
+	renderers map[string]ValueRenderer
+}
+
+func NewRendererRegistry() *RendererRegistry {
+	return &RendererRegistry{renderers: map[string]ValueRenderer{}}
+}
+
+// DefaultRendererRegistry 包含常用 JDK 类的 ValueRenderer
+func DefaultRendererRegistry() *RendererRegistry {
+	r := NewRendererRegistry()
+	r.Register(stringClassName, renderString)
+	for _, name := range []string{
+		"java.lang.Boolean", "java.lang.Byte", "java.lang.Short", "java.lang.Character",
+		"java.lang.Integer", "java.lang.Long", "java.lang.Float", "java.lang.Double",
+		"java.util.concurrent.atomic.AtomicInteger", "java.util.concurrent.atomic.AtomicLong",
+	} {
+		r.Register(name, renderPrimitiveField("value"))
+	}
+	r.Register("java.math.BigInteger", renderBigInteger)
+	r.Register("java.math.BigDecimal", renderBigDecimal)
+	r.Register("java.util.Date", renderDate)
+	r.Register("java.time.Instant", renderInstant)
+	r.Register("java.time.LocalDate", renderLocalDate)
+	r.Register("java.time.LocalTime", renderLocalTime)
+	r.Register("java.time.LocalDateTime", renderLocalDateTime)
+	r.Register("java.util.UUID", renderUUID)
+	r.Register("java.lang.Enum", renderStringField("name"))
+	r.Register("java.lang.Thread", renderThread)
+	r.Register("java.io.File", renderStringField("path"))
+	r.Register("sun.nio.fs.UnixPath", renderUnixPath)
+	r.Register("sun.nio.fs.WindowsPath", renderStringField("path"))
+	return r
+}
+
+// Register 注册类的 ValueRenderer，已经注册的会被替换
+func (r *RendererRegistry) Register(className string, renderer ValueRenderer) {
+	r.renderers[className] = renderer
+}
+
+// SetRendererRegistry 替换 RenderValue 使用的 RendererRegistry
+func (s *Snapshot) SetRendererRegistry(r *RendererRegistry) {
+	s.renderers = r
+}
+
+// RenderValue 返回对象便于阅读的值，没有对应的 ValueRenderer 时返回空字符串
+// class 对象返回类名，dump 中不存在的对象返回 "<missing 0x...>"
+// 引用指向 dump 中不存在的对象很常见，渲染时读不到的对象不作为错误
+func (s *Snapshot) RenderValue(id uint64) (string, error) {
+	display, err := s.renderValue(id)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return display, err
+}
+
+func (s *Snapshot) renderValue(id uint64) (string, error) {
+	if id == 0 {
+		return "null", nil
+	}
+	className, err := s.i.GetObjectClassName(id)
+	if errors.Is(err, ErrNotFound) {
+		return missingDisplay(id), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(className, "class ") {
+		return strings.TrimPrefix(className, "class "), nil
+	}
+	if strings.HasSuffix(className, "[]") || strings.HasPrefix(className, "[") {
+		// 数组没有字段
+		return "", nil
+	}
+	cid, fields, err := s.ReadFields(id)
+	if err != nil {
+		return "", err
+	}
+	names, err := s.i.GetSuperClassNames(cid)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		renderer, exist := s.renderers.renderers[name]
+		if !exist {
+			continue
+		}
+		display, ok, err := renderer(s, id, fields)
+		if err != nil || !ok {
+			return "", err
+		}
+		return truncateDisplay(display), nil
+	}
+	return "", nil
+}
+
+func missingDisplay(id uint64) string {
+	return fmt.Sprintf("<missing 0x%x>", id)
+}
+
+func truncateDisplay(display string) string {
+	runes := []rune(display)
+	if len(runes) <= maxDisplayLength {
+		return display
+	}
+	return string(runes[:maxDisplayLength]) + "..."
+}
+
+func renderString(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	str, err := s.ReadString(id)
+	if err != nil {
+		return "", false, err
+	}
+	return str, true, nil
+}
+
+// renderPrimitiveField 使用基本类型字段的值
+func renderPrimitiveField(name string) ValueRenderer {
+	return func(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+		v, exist := fields[name]
+		if !exist {
+			return "", false, nil
+		}
+		return formatPrimitiveValue(v), true, nil
+	}
+}
+
+// formatPrimitiveValue byte 按有符号数，浮点数使用最短的能精确还原的格式
+func formatPrimitiveValue(v hprof.HProfInstanceFieldValue) string {
+	switch x := v.(type) {
+	case *hprof.HProfInstanceByteValue:
+		return strconv.Itoa(int(int8(x.Value)))
+	case *hprof.HProfInstanceFloatValue:
+		return strconv.FormatFloat(float64(x.Value), 'g', -1, 32)
+	case *hprof.HProfInstanceDoubleValue:
+		return strconv.FormatFloat(x.Value, 'g', -1, 64)
+	}
+	return v.ValueString()
+}
+
+// renderStringField 使用 String 字段的内容
+func renderStringField(name string) ValueRenderer {
+	return func(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+		value := fields.Object(name)
+		if value == 0 {
+			return "", false, nil
+		}
+		str, err := s.ReadString(value)
+		if err != nil {
+			return "", false, err
+		}
+		return str, true, nil
+	}
+}
+
+// renderBigInteger 由 signum 和大端序的 int[] mag 计算
+func renderBigInteger(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	v, ok, err := s.readBigInteger(fields)
+	if err != nil || !ok {
+		return "", ok, err
+	}
+	return v.String(), true, nil
+}
+
+func (s *Snapshot) readBigInteger(fields FieldValues) (*big.Int, bool, error) {
+	signum, ok := fields.Integer("signum")
+	mag := fields.Object("mag")
+	if !ok || mag == 0 {
+		return nil, false, nil
+	}
+	array, err := s.i.GetPrimitiveArray(mag)
+	if err != nil {
+		return nil, false, err
+	}
+	// hprof 中的 int[] 也是大端序，和 mag 的顺序一致
+	v := new(big.Int).SetBytes(array.Values)
+	if signum < 0 {
+		v.Neg(v)
+	}
+	return v, true, nil
+}
+
+// renderBigDecimal intCompact 为 Long.MIN_VALUE 时数值保存在 intVal 中
+func renderBigDecimal(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	scale, ok := fields.Integer("scale")
+	if !ok {
+		return "", false, nil
+	}
+	var unscaled *big.Int
+	if intVal := fields.Object("intVal"); intVal != 0 {
+		_, intValFields, err := s.ReadFields(intVal)
+		if err != nil {
+			return "", false, err
+		}
+		unscaled, ok, err = s.readBigInteger(intValFields)
+		if err != nil || !ok {
+			return "", ok, err
+		}
+	} else {
+		compact, _ := fields.Integer("intCompact")
+		unscaled = big.NewInt(compact)
+	}
+	return formatDecimal(unscaled, scale), true, nil
+}
+
+// formatDecimal 计算 unscaled * 10^-scale，格式和 BigDecimal.toPlainString 一致
+func formatDecimal(unscaled *big.Int, scale int64) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits + strings.Repeat("0", int(-scale))
+	}
+	if int64(len(digits)) <= scale {
+		digits = strings.Repeat("0", int(scale)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func renderDate(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	millis, ok := fields.Integer("fastTime")
+	if !ok {
+		return "", false, nil
+	}
+	return time.Unix(millis/1000, millis%1000*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano), true, nil
+}
+
+func renderInstant(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	seconds, ok := fields.Integer("seconds")
+	if !ok {
+		return "", false, nil
+	}
+	nanos, _ := fields.Integer("nanos")
+	return time.Unix(seconds, nanos).UTC().Format(time.RFC3339Nano), true, nil
+}
+
+func renderLocalDate(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	year, ok := fields.Integer("year")
+	if !ok {
+		return "", false, nil
+	}
+	month, _ := fields.Integer("month")
+	day, _ := fields.Integer("day")
+	return fmt.Sprintf("%04d-%02d-%02d", year, month, day), true, nil
+}
+
+func renderLocalTime(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	hour, ok := fields.Integer("hour")
+	if !ok {
+		return "", false, nil
+	}
+	minute, _ := fields.Integer("minute")
+	second, _ := fields.Integer("second")
+	nano, _ := fields.Integer("nano")
+	if nano == 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", hour, minute, second), true, nil
+	}
+	return fmt.Sprintf("%02d:%02d:%02d.%09d", hour, minute, second, nano), true, nil
+}
+
+func renderLocalDateTime(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	date, dateTime := fields.Object("date"), fields.Object("time")
+	if date == 0 || dateTime == 0 {
+		return "", false, nil
+	}
+	_, dateFields, err := s.ReadFields(date)
+	if err != nil {
+		return "", false, err
+	}
+	_, timeFields, err := s.ReadFields(dateTime)
+	if err != nil {
+		return "", false, err
+	}
+	d, ok, err := renderLocalDate(s, date, dateFields)
+	if err != nil || !ok {
+		return "", ok, err
+	}
+	t, ok, err := renderLocalTime(s, dateTime, timeFields)
+	if err != nil || !ok {
+		return "", ok, err
+	}
+	return d + "T" + t, true, nil
+}
+
+func renderUUID(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	most, ok := fields.Integer("mostSigBits")
+	if !ok {
+		return "", false, nil
+	}
+	least, _ := fields.Integer("leastSigBits")
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(most))
+	binary.BigEndian.PutUint64(b[8:], uint64(least))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), true, nil
+}
+
+// renderThread JDK 8 的 Thread.name 是 char[]，JDK 9+ 是 String
+func renderThread(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	name := fields.Object("name")
+	if name == 0 {
+		return "", false, nil
+	}
+	className, err := s.i.GetObjectClassName(name)
+	if err != nil {
+		return "", false, err
+	}
+	if className != "char[]" {
+		return renderStringField("name")(s, id, fields)
+	}
+	value, err := s.i.ReadCharArray(name)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// renderUnixPath UnixPath.path 是文件系统编码的 byte[]
+func renderUnixPath(s *Snapshot, id uint64, fields FieldValues) (string, bool, error) {
+	path := fields.Object("path")
+	if path == 0 {
+		return "", false, nil
+	}
+	record, err := s.i.GetPrimitiveArray(path)
+	if err != nil {
+		return "", false, err
+	}
+	return string(record.Values), true, nil
+}
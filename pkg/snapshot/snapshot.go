@@ -1,6 +1,7 @@
 package snapshot
 
 import (
+	"errors"
 	"fmt"
 	"hprof-tool/pkg/hprof"
 	"hprof-tool/pkg/indexer"
@@ -8,10 +9,14 @@ import (
 	"hprof-tool/pkg/storage"
 	"os"
 	"sort"
+	"strings"
+	"time"
 )
 
 type Snapshot struct {
 	i *indexer.Indexer
+	// RenderValue 使用的 ValueRenderer
+	renderers *RendererRegistry
 }
 
 func NewSnapshot(fileName string) (*Snapshot, error) {
@@ -34,7 +39,30 @@ func NewSnapshot(fileName string) (*Snapshot, error) {
 
 	i := indexer.NewSqliteIndexer(hreader, s)
 
-	return &Snapshot{i}, nil
+	return &Snapshot{i, DefaultRendererRegistry()}, nil
+}
+
+// SetObjectLayout 指定计算 shallow size 的 ObjectLayout，需要在 EnsureCreateIndex 之前调用
+// 不指定时根据 hprof 文件自动推测
+func (s *Snapshot) SetObjectLayout(layout *hprof.ObjectLayout) {
+	s.i.SetObjectLayout(layout)
+}
+
+// ObjectLayout 返回计算 shallow size 使用的 ObjectLayout
+func (s *Snapshot) ObjectLayout() *hprof.ObjectLayout {
+	return s.i.ObjectLayout()
+}
+
+// SetReachabilityStrengths 指定标记可达对象时跟随的 Reference.referent 引用强度，需要在 EnsureCreateIndex 之前调用
+// 默认跟随所有引用，只能通过软引用、弱引用到达的对象也算作可达
+func (s *Snapshot) SetReachabilityStrengths(strengths []model.ReferenceStrength) {
+	s.i.SetReachabilityStrengths(strengths)
+}
+
+// SetDominatorStrengths 指定计算支配树和 retained size 时跟随的引用强度，需要在 EnsureCreateIndex 之前调用
+// 默认只跟随强引用和 Finalizer 的引用
+func (s *Snapshot) SetDominatorStrengths(strengths []model.ReferenceStrength) {
+	s.i.SetDominatorStrengths(strengths)
 }
 
 func (s *Snapshot) EnsureCreateIndex() error {
@@ -48,6 +76,16 @@ func (s *Snapshot) EnsureCreateIndex() error {
 	return s.i.Processor()
 }
 
+// ListGCRootIds 返回所有 typ 类型的 GC root 对象 id，typ 是 model.GCRootType_*
+func (s *Snapshot) ListGCRootIds(typ int) []uint64 {
+	return s.i.ListGCRootIds(typ)
+}
+
+// DumpTime 返回生成 dump 的时间
+func (s *Snapshot) DumpTime() time.Time {
+	return s.i.DumpTime()
+}
+
 // GetThreads 返回线程信息
 func (s *Snapshot) GetThreads() map[uint32]*model.Thread {
 	return s.i.GetThreads()
@@ -61,14 +99,16 @@ func (s *Snapshot) GetClassNameByClassSerialNumber(csn uint64) (string, error) {
 	return s.i.GetClassNameByClassSerialNumber(csn)
 }
 
-func (s *Snapshot) ListClassesStatistics() ([]ClassStatistics, error) {
+// ListClassesStatistics 按类统计对象个数和大小
+func (s *Snapshot) ListClassesStatistics(reachability Reachability) ([]ClassStatistics, error) {
 	var result []ClassStatistics
-	err := s.i.GetClassesStatistics(func(cid uint64, cname string, count, size int64) error {
+	err := s.i.GetClassesStatistics(reachability, func(cid uint64, cname string, count, size, retained int64) error {
 		result = append(result, ClassStatistics{
 			Id:            cid,
 			Name:          cname,
 			InstanceCount: count,
 			InstanceSize:  size,
+			RetainedSize:  retained,
 		})
 		return nil
 	})
@@ -81,23 +121,217 @@ func (s *Snapshot) ListClassesStatistics() ([]ClassStatistics, error) {
 	return result, err
 }
 
-func (s *Snapshot) ListInstancesStatistics(cid uint64, typ int) ([]InstanceStatistics, error) {
+// ListUnreachableClassesStatistics 只统计从 GC roots 不可达的对象
+func (s *Snapshot) ListUnreachableClassesStatistics() ([]ClassStatistics, error) {
+	return s.ListClassesStatistics(UnreachableObjects)
+}
+
+// ListObjectIds 返回类的所有对象 id，按 id 排序，类不存在时返回 ErrNotFound
+// className 可以是 java.lang.String、[Ljava.lang.String; 或 char[]，includeSubclasses 为 true 时包括子类的实例
+func (s *Snapshot) ListObjectIds(className string, includeSubclasses bool, reachability Reachability) ([]uint64, error) {
+	for typ, name := range indexer.PRIMITIVE_TYPE_ARRAY {
+		if name == "" || name != className {
+			continue
+		}
+		var result []uint64
+		err := s.i.GetInstancesStatistics(uint64(typ), hprof.HProfHDRecordTypePrimitiveArrayDump, reachability, func(id uint64, size, retained int64) error {
+			result = append(result, id)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+		return result, nil
+	}
+	if s.i.GetClassIdByName(className) == 0 {
+		return nil, &UnknownClassError{Name: className}
+	}
+	return s.listInstances(className, includeSubclasses, reachability)
+}
+
+// listInstances 返回 className 的所有实例 id，includeSubclasses 为 true 时包括子类，按 id 排序
+// 不同 ClassLoader 加载的同名类都会包括在内，数组类返回数组对象
+func (s *Snapshot) listInstances(className string, includeSubclasses bool, reachability Reachability) ([]uint64, error) {
+	// 先找出所有的类，避免在遍历数据库结果时查询实例
+	var cids []uint64
+	err := s.i.ForEachClassesWithName(func(cid uint64, cname string) error {
+		cids = append(cids, cid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result []uint64
+	for _, cid := range cids {
+		names, err := s.i.GetSuperClassNames(cid)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			continue
+		}
+		matched := names[0] == className
+		if !matched && includeSubclasses {
+			for _, name := range names[1:] {
+				if name == className {
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			continue
+		}
+		typ := hprof.HProfHDRecordTypeInstanceDump
+		if strings.HasPrefix(names[0], "[") {
+			typ = hprof.HProfHDRecordTypeObjectArrayDump
+		}
+		err = s.i.GetInstancesStatistics(cid, typ, reachability, func(id uint64, size, retained int64) error {
+			result = append(result, id)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+// ListInstancesStatistics 返回类的实例按 shallow size 降序排列后从 offset 开始的 limit 个
+// 只给返回的实例调用 RenderValue
+func (s *Snapshot) ListInstancesStatistics(cid uint64, typ int, reachability Reachability, offset, limit int) ([]InstanceStatistics, error) {
 	var result []InstanceStatistics
-	err := s.i.GetInstancesStatistics(cid, typ, func(cid uint64, size int64) error {
+	err := s.i.GetInstancesStatistics(cid, typ, reachability, func(cid uint64, size, retained int64) error {
 		result = append(result, InstanceStatistics{
-			Id:   cid,
-			Size: size,
+			Id:           cid,
+			Size:         size,
+			RetainedSize: retained,
 		})
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].Size > result[j].Size
 	})
-	return result, err
+	if offset >= len(result) {
+		return []InstanceStatistics{}, nil
+	}
+	result = result[offset:]
+	if limit < len(result) {
+		result = result[:limit]
+	}
+	for idx := range result {
+		result[idx].Display, err = s.RenderValue(result[idx].Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// instanceContentsLimit 对象详情中最多包含的集合元素个数，更多的元素通过 GetCollectionContents 分页读取
+const instanceContentsLimit = 20
+
+type InstanceDetail struct {
+	*indexer.Instance
+	// 集合对象的前 instanceContentsLimit 个元素，其他对象为空
+	Contents *CollectionContents `json:"contents,omitempty"`
 }
 
-func (s *Snapshot) GetInstanceDetail(id uint64) (*indexer.Instance, error) {
-	return s.i.GetInstanceDetail(id)
+func (s *Snapshot) GetInstanceDetail(id uint64) (*InstanceDetail, error) {
+	instance, err := s.i.GetInstanceDetail(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.renderInstance(instance, map[*indexer.Instance]bool{}); err != nil {
+		return nil, err
+	}
+	detail := &InstanceDetail{Instance: instance}
+	detail.Contents, err = s.GetCollectionContents(id, 0, instanceContentsLimit)
+	// 不是集合或者内部结构不完整时不影响对象详情
+	if errors.Is(err, ErrUnsupported) || errors.Is(err, ErrNotFound) {
+		return detail, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// renderInstance 给 instance 和引用字段加上 RenderValue 的结果
+func (s *Snapshot) renderInstance(instance *indexer.Instance, visited map[*indexer.Instance]bool) error {
+	if visited[instance] {
+		return nil
+	}
+	visited[instance] = true
+	var err error
+	instance.Display, err = s.RenderValue(instance.Id)
+	if err != nil {
+		return err
+	}
+	for _, field := range instance.Fields {
+		if field.ObjectId == 0 {
+			continue
+		}
+		if field.Reference != nil {
+			err = s.renderInstance(field.Reference, visited)
+			if err != nil {
+				return err
+			}
+			field.Display = field.Reference.Display
+			continue
+		}
+		// 数组和 class 对象没有展开
+		field.Display, err = s.RenderValue(field.ObjectId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDominator 返回对象的直接支配者和 retained size
+// 从 GC root 不可达的对象没有支配信息，返回 ErrNotFound
+func (s *Snapshot) GetDominator(id uint64) (*Dominator, error) {
+	idom, retained, err := s.i.GetDominator(id)
+	if err != nil {
+		return nil, err
+	}
+	return &Dominator{
+		Id:                 id,
+		ImmediateDominator: idom,
+		RetainedSize:       retained,
+	}, nil
+}
+
+// GetRetainedSize 返回对象的 retained size
+func (s *Snapshot) GetRetainedSize(id uint64) (int64, error) {
+	_, retained, err := s.i.GetDominator(id)
+	return retained, err
+}
+
+// GetShallowSize 返回对象本身的大小，class 对象返回 0
+func (s *Snapshot) GetShallowSize(id uint64) (int64, error) {
+	return s.i.GetObjectSize(id)
+}
+
+// ListDominated 返回在支配树中被 id 直接支配的对象，按 retained size 降序
+// id 为 0 时返回支配树的顶层对象
+func (s *Snapshot) ListDominated(id uint64) ([]Dominator, error) {
+	var result []Dominator
+	err := s.i.ListDominated(id, func(did uint64, retained int64) error {
+		result = append(result, Dominator{
+			Id:                 did,
+			ImmediateDominator: id,
+			RetainedSize:       retained,
+		})
+		return nil
+	})
+	return result, err
 }
 
 func (s *Snapshot) GetRecordInbound(id uint64, fn func(record hprof.HProfRecord) error) error {
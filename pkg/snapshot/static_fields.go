@@ -0,0 +1,193 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/indexer"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type StaticFieldsOptions struct {
+	// 最多列出的静态字段个数，0 表示不限制
+	MaxFields int
+}
+
+func DefaultStaticFieldsOptions() *StaticFieldsOptions {
+	return &StaticFieldsOptions{
+		MaxFields: 50,
+	}
+}
+
+// StaticFieldSize 一个引用类型的静态字段和它指向的对象
+type StaticFieldSize struct {
+	ClassId uint64     `json:"classId"`
+	Class   string     `json:"class"`
+	Field   string     `json:"field"`
+	Value   *ObjectRef `json:"value"`
+	// 字段指向的对象的 retained size，不可达的对象为 0
+	RetainedSize int64 `json:"retainedSize"`
+	// 对象的直接支配者是这个类，也就是只通过这个类才能访问到对象
+	Exclusive bool `json:"exclusive"`
+}
+
+type StaticFieldsReport struct {
+	// 非 null 的引用类型静态字段的个数
+	Count int `json:"count"`
+	// Exclusive 的字段指向的对象的 retained size 之和，不会重复计算
+	ExclusiveSize int64 `json:"exclusiveSize"`
+	// 按 retained size 降序
+	Fields []*StaticFieldSize `json:"fields"`
+}
+
+// AnalyzeStaticFields 列出所有类的引用类型静态字段，按指向的对象的 retained size 降序
+// 单例和静态缓存通过静态字段持有内存，多个字段指向同一个对象时每个字段都会列出
+func (s *Snapshot) AnalyzeStaticFields(opts *StaticFieldsOptions) (*StaticFieldsReport, error) {
+	if opts == nil {
+		opts = DefaultStaticFieldsOptions()
+	}
+	// 先找出所有的类，避免在遍历数据库结果时读取静态字段
+	var cids []uint64
+	err := s.i.ForEachClassesWithName(func(cid uint64, cname string) error {
+		cids = append(cids, cid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report := &StaticFieldsReport{}
+	var fields []*StaticFieldSize
+	for _, cid := range cids {
+		statics, err := s.i.GetStaticFields(cid)
+		if err != nil {
+			return nil, err
+		}
+		for _, sf := range statics {
+			if sf.Type != hprof.HProfValueType_OBJECT || sf.Value == 0 {
+				continue
+			}
+			field := &StaticFieldSize{ClassId: cid, Class: s.i.GetClassNameById(cid, "unknown"), Field: sf.Name, Value: &ObjectRef{Id: sf.Value}}
+			idom, retained, err := s.i.GetDominator(sf.Value)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			field.RetainedSize = retained
+			field.Exclusive = err == nil && idom == cid
+			if field.Exclusive {
+				report.ExclusiveSize += retained
+			}
+			fields = append(fields, field)
+		}
+	}
+	report.Count = len(fields)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].RetainedSize > fields[j].RetainedSize })
+	if opts.MaxFields > 0 && len(fields) > opts.MaxFields {
+		fields = fields[:opts.MaxFields]
+	}
+	// 只给列出的字段读取对象的类名和值
+	for _, field := range fields {
+		if field.Value, err = s.newObjectRef(field.Value.Id); err != nil {
+			return nil, err
+		}
+	}
+	report.Fields = fields
+	if report.Fields == nil {
+		report.Fields = []*StaticFieldSize{}
+	}
+	return report, nil
+}
+
+// StaticFieldValue 类的一个静态字段，Value 的格式和 instance 字段相同
+type StaticFieldValue struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// 引用字段指向的对象，null 为 0
+	ObjectId     uint64 `json:"objectId,omitempty"`
+	ObjectClass  string `json:"objectClass,omitempty"`
+	Display      string `json:"display,omitempty"`
+	RetainedSize int64  `json:"retainedSize,omitempty"`
+}
+
+type ClassDetail struct {
+	Id           uint64 `json:"id"`
+	Name         string `json:"name"`
+	SuperClassId uint64 `json:"superClassId,omitempty"`
+	SuperClass   string `json:"superClass,omitempty"`
+	// bootstrap ClassLoader 的 Id 为 0
+	ClassLoader *ObjectRef `json:"classLoader"`
+	// 类自身声明的静态字段，不包括父类的
+	StaticFields []*StaticFieldValue `json:"staticFields"`
+}
+
+// GetClassDetail 返回类的父类、ClassLoader 和静态字段的值
+func (s *Snapshot) GetClassDetail(cid uint64) (*ClassDetail, error) {
+	statics, err := s.i.GetStaticFields(cid)
+	if err != nil {
+		return nil, err
+	}
+	detail := &ClassDetail{Id: cid, Name: s.i.GetClassNameById(cid, "unknown"), StaticFields: []*StaticFieldValue{}}
+	if detail.SuperClassId, err = s.i.GetSuperClassId(cid); err != nil {
+		return nil, err
+	}
+	if detail.SuperClassId != 0 {
+		detail.SuperClass = s.i.GetClassNameById(detail.SuperClassId, "unknown")
+	}
+	loader, err := s.i.GetClassLoaderId(cid)
+	if err != nil {
+		return nil, err
+	}
+	if detail.ClassLoader, err = s.newObjectRef(loader); err != nil {
+		return nil, err
+	}
+	for _, sf := range statics {
+		field := &StaticFieldValue{Name: sf.Name, Type: hprof.HProfValueType_name[sf.Type], Value: formatStaticValue(sf)}
+		if sf.Type == hprof.HProfValueType_OBJECT && sf.Value != 0 {
+			ref, err := s.newObjectRef(sf.Value)
+			if err != nil {
+				return nil, err
+			}
+			field.ObjectId, field.ObjectClass, field.Display = ref.Id, ref.Class, ref.Display
+			_, retained, err := s.i.GetDominator(sf.Value)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			field.RetainedSize = retained
+		}
+		detail.StaticFields = append(detail.StaticFields, field)
+	}
+	return detail, nil
+}
+
+// formatStaticValue 把静态字段的原始位转换成和 formatPrimitiveValue 相同的格式
+func formatStaticValue(sf *indexer.StaticField) string {
+	switch sf.Type {
+	case hprof.HProfValueType_OBJECT:
+		if sf.Value == 0 {
+			return "null"
+		}
+		return fmt.Sprintf("0x%X", sf.Value)
+	case hprof.HProfValueType_BOOLEAN:
+		if sf.Value != 0 {
+			return "true"
+		}
+		return "false"
+	case hprof.HProfValueType_CHAR:
+		return fmt.Sprintf("%c", uint16(sf.Value))
+	case hprof.HProfValueType_FLOAT:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(sf.Value))), 'g', -1, 32)
+	case hprof.HProfValueType_DOUBLE:
+		return strconv.FormatFloat(math.Float64frombits(sf.Value), 'g', -1, 64)
+	case hprof.HProfValueType_BYTE:
+		return fmt.Sprintf("%d", int8(sf.Value))
+	case hprof.HProfValueType_SHORT:
+		return fmt.Sprintf("%d", int16(sf.Value))
+	case hprof.HProfValueType_INT:
+		return fmt.Sprintf("%d", int32(sf.Value))
+	case hprof.HProfValueType_LONG:
+		return fmt.Sprintf("%d", int64(sf.Value))
+	}
+	return "<?>"
+}
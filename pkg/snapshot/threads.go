@@ -0,0 +1,216 @@
+package snapshot
+
+import (
+	"errors"
+	"sort"
+)
+
+// Thread.State 对应的 JVMTI 线程状态位，和 sun.misc.VM.toThreadState 一致
+const (
+	jvmtiThreadStateAlive                 = 0x0001
+	jvmtiThreadStateTerminated            = 0x0002
+	jvmtiThreadStateRunnable              = 0x0004
+	jvmtiThreadStateWaitingIndefinitely   = 0x0010
+	jvmtiThreadStateWaitingWithTimeout    = 0x0020
+	jvmtiThreadStateBlockedOnMonitorEnter = 0x0400
+)
+
+// ThreadFrame 调用栈中的一个栈帧
+type ThreadFrame struct {
+	Class      string `json:"class"`
+	Method     string `json:"method"`
+	Signature  string `json:"signature,omitempty"`
+	SourceFile string `json:"sourceFile,omitempty"`
+	// 大于 0 是行号，-1 未知，-2 编译后的方法，-3 native 方法
+	Line int32 `json:"line"`
+	// 栈帧中作为 GC root 的局部变量
+	Locals []*ObjectSize `json:"locals,omitempty"`
+}
+
+// ThreadInfo 线程的概要信息
+type ThreadInfo struct {
+	SerialNumber uint32 `json:"serialNumber"`
+	ObjectId     uint64 `json:"objectId"`
+	Name         string `json:"name"`
+	Group        string `json:"group,omitempty"`
+	ParentGroup  string `json:"parentGroup,omitempty"`
+	// 从 java.lang.Thread 对象的字段读出，JDK 19 之后在 holder 对象中
+	Daemon   bool   `json:"daemon"`
+	Priority int64  `json:"priority"`
+	State    string `json:"state,omitempty"`
+	// Thread 对象的 retained size
+	RetainedSize int64 `json:"retainedSize"`
+	// 局部变量中只被 GC root 支配的对象的 retained size 之和，不包括线程对象
+	LocalsRetainedSize int64          `json:"localsRetainedSize"`
+	Frames             []*ThreadFrame `json:"frames"`
+	// 不知道在哪个栈帧中的局部变量
+	Locals []*ObjectSize `json:"locals,omitempty"`
+}
+
+// GetThreadOverview 返回所有线程的名称、状态、调用栈和持有的内存，按持有的内存降序
+func (s *Snapshot) GetThreadOverview() ([]*ThreadInfo, error) {
+	threads := s.i.GetThreads()
+	// 其他线程对象的内存算在对应的线程上
+	threadObjects := map[uint64]bool{}
+	for _, thread := range threads {
+		threadObjects[thread.ObjectId] = true
+	}
+	var result []*ThreadInfo
+	for sn, thread := range threads {
+		info := &ThreadInfo{SerialNumber: sn, ObjectId: thread.ObjectId}
+		var err error
+		if info.Name, err = s.optionalText(thread.NameId); err != nil {
+			return nil, err
+		}
+		if info.Group, err = s.optionalText(thread.GroupNameId); err != nil {
+			return nil, err
+		}
+		if info.ParentGroup, err = s.optionalText(thread.GroupParentNameId); err != nil {
+			return nil, err
+		}
+		if thread.ObjectId != 0 {
+			if err = s.readThreadObject(info); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, f := range thread.StackTrace.Frames {
+			frame := &ThreadFrame{Line: f.Line}
+			if f.MethodId != 0 {
+				if frame.Class, err = s.GetClassNameByClassSerialNumber(uint64(f.ClassSerialNumber)); err != nil {
+					return nil, err
+				}
+				if frame.Method, err = s.GetText(f.MethodId); err != nil {
+					return nil, err
+				}
+				if frame.Signature, err = s.optionalText(f.SignatureId); err != nil {
+					return nil, err
+				}
+				if frame.SourceFile, err = s.optionalText(f.SourceFileId); err != nil {
+					return nil, err
+				}
+			}
+			info.Frames = append(info.Frames, frame)
+		}
+
+		seen := map[uint64]bool{}
+		for _, local := range thread.StackTrace.Locals {
+			if seen[local.ObjectId] {
+				continue
+			}
+			seen[local.ObjectId] = true
+			object, idom, err := s.newLocalObject(local.ObjectId)
+			if err != nil {
+				return nil, err
+			}
+			if idom == 0 && !threadObjects[local.ObjectId] {
+				info.LocalsRetainedSize += object.RetainedSize
+			}
+			idx := int(local.LineNumber)
+			if idx >= 0 && idx < len(info.Frames) {
+				info.Frames[idx].Locals = append(info.Frames[idx].Locals, object)
+			} else {
+				info.Locals = append(info.Locals, object)
+			}
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		ra := result[a].RetainedSize + result[a].LocalsRetainedSize
+		rb := result[b].RetainedSize + result[b].LocalsRetainedSize
+		if ra != rb {
+			return ra > rb
+		}
+		return result[a].SerialNumber < result[b].SerialNumber
+	})
+	return result, nil
+}
+
+// readThreadObject 读取 java.lang.Thread 对象的字段和 retained size
+func (s *Snapshot) readThreadObject(info *ThreadInfo) error {
+	_, fields, err := s.ReadFields(info.ObjectId)
+	if err != nil {
+		return err
+	}
+	if info.Name == "" {
+		if info.Name, err = s.RenderValue(info.ObjectId); err != nil {
+			return err
+		}
+	}
+	if holder := fields.Object("holder"); holder != 0 {
+		// JDK 19 之后 daemon、priority 和 threadStatus 在 Thread.FieldHolder 中
+		if _, fields, err = s.ReadFields(holder); err != nil {
+			return err
+		}
+	}
+	if group := fields.Object("group"); group != 0 && info.Group == "" {
+		_, groupFields, err := s.ReadFields(group)
+		if err != nil {
+			return err
+		}
+		if name := groupFields.Object("name"); name != 0 {
+			if info.Group, err = s.ReadString(name); err != nil {
+				return err
+			}
+		}
+	}
+	info.Daemon = fields.Boolean("daemon")
+	info.Priority, _ = fields.Integer("priority")
+	if status, ok := fields.Integer("threadStatus"); ok {
+		info.State = threadState(status)
+	}
+	info.RetainedSize, err = s.GetRetainedSize(info.ObjectId)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// newLocalObject 返回局部变量引用的对象和它的直接支配者
+func (s *Snapshot) newLocalObject(id uint64) (*ObjectSize, uint64, error) {
+	class, err := s.i.GetObjectClassName(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	display, err := s.RenderValue(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	object := &ObjectSize{Id: id, Class: class, Display: display}
+	idom, retained, err := s.i.GetDominator(id)
+	if errors.Is(err, ErrNotFound) {
+		return object, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	object.RetainedSize = retained
+	return object, idom, nil
+}
+
+// optionalText 返回字符串，id 为 0 时返回空字符串
+func (s *Snapshot) optionalText(id uint64) (string, error) {
+	if id == 0 {
+		return "", nil
+	}
+	return s.GetText(id)
+}
+
+// threadState 把 Thread.threadStatus 转换成 Thread.State
+func threadState(status int64) string {
+	switch {
+	case status&jvmtiThreadStateRunnable != 0:
+		return "RUNNABLE"
+	case status&jvmtiThreadStateBlockedOnMonitorEnter != 0:
+		return "BLOCKED"
+	case status&jvmtiThreadStateWaitingIndefinitely != 0:
+		return "WAITING"
+	case status&jvmtiThreadStateWaitingWithTimeout != 0:
+		return "TIMED_WAITING"
+	case status&jvmtiThreadStateTerminated != 0:
+		return "TERMINATED"
+	case status&jvmtiThreadStateAlive == 0:
+		return "NEW"
+	}
+	return "RUNNABLE"
+}
@@ -0,0 +1,100 @@
+package snapshot
+
+import (
+	"hprof-tool/pkg/model"
+	"sort"
+)
+
+type WeaklyReachableOptions struct {
+	// 每种引用强度最多列出的类个数
+	MaxClasses int
+}
+
+func DefaultWeaklyReachableOptions() *WeaklyReachableOptions {
+	return &WeaklyReachableOptions{
+		MaxClasses: 20,
+	}
+}
+
+// WeaklyReachableClass 一个类中以某种强度可达的对象
+type WeaklyReachableClass struct {
+	Class       string `json:"class"`
+	Count       int64  `json:"count"`
+	ShallowSize int64  `json:"shallowSize"`
+}
+
+// WeaklyReachableObjects 以同一种强度可达的对象，比如只被 SoftReference 引用的缓存内容
+type WeaklyReachableObjects struct {
+	Strength    model.ReferenceStrength `json:"strength"`
+	Count       int64                   `json:"count"`
+	ShallowSize int64                   `json:"shallowSize"`
+	Classes     []*WeaklyReachableClass `json:"classes"`
+}
+
+type WeaklyReachableReport struct {
+	// 按 GC 判断可达性的顺序排列，不包括强引用
+	Strengths   []*WeaklyReachableObjects `json:"strengths"`
+	Count       int64                     `json:"count"`
+	ShallowSize int64                     `json:"shallowSize"`
+	// 标记可达对象和计算支配树时跟随的引用强度
+	ReachabilityStrengths []model.ReferenceStrength `json:"reachabilityStrengths"`
+	DominatorStrengths    []model.ReferenceStrength `json:"dominatorStrengths"`
+}
+
+// FindWeaklyReachable 统计没有强引用路径、只能通过软引用、弱引用等到达的对象
+// 对象的强度是从 GC root 出发所有路径中最强的那条路径上最弱的引用
+func (s *Snapshot) FindWeaklyReachable(opts *WeaklyReachableOptions) (*WeaklyReachableReport, error) {
+	if opts == nil {
+		opts = DefaultWeaklyReachableOptions()
+	}
+	report := &WeaklyReachableReport{
+		ReachabilityStrengths: s.i.ReachabilityStrengths(),
+		DominatorStrengths:    s.i.DominatorStrengths(),
+	}
+	groups := map[model.ReferenceStrength]*WeaklyReachableObjects{}
+	classes := map[model.ReferenceStrength]map[string]*WeaklyReachableClass{}
+	err := s.i.ListWeaklyReachable(func(id uint64, class string, size int64, strength model.ReferenceStrength) error {
+		g, exist := groups[strength]
+		if !exist {
+			g = &WeaklyReachableObjects{Strength: strength}
+			groups[strength] = g
+			classes[strength] = map[string]*WeaklyReachableClass{}
+		}
+		c, exist := classes[strength][class]
+		if !exist {
+			c = &WeaklyReachableClass{Class: class}
+			classes[strength][class] = c
+		}
+		c.Count++
+		c.ShallowSize += size
+		g.Count++
+		g.ShallowSize += size
+		report.Count++
+		report.ShallowSize += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, strength := range model.ReferenceStrengthsByReachability {
+		g, exist := groups[strength]
+		if !exist {
+			continue
+		}
+		for _, c := range classes[strength] {
+			g.Classes = append(g.Classes, c)
+		}
+		sort.Slice(g.Classes, func(a, b int) bool {
+			if g.Classes[a].ShallowSize != g.Classes[b].ShallowSize {
+				return g.Classes[a].ShallowSize > g.Classes[b].ShallowSize
+			}
+			return g.Classes[a].Class < g.Classes[b].Class
+		})
+		if opts.MaxClasses > 0 && len(g.Classes) > opts.MaxClasses {
+			g.Classes = g.Classes[:opts.MaxClasses]
+		}
+		report.Strengths = append(report.Strengths, g)
+	}
+	return report, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound 查询的记录不存在
+	ErrNotFound = errors.New("not found")
+	// ErrCorrupt 记录无法从 hprof 文件中解析
+	ErrCorrupt = errors.New("corrupt record")
+	// ErrUnsupported 不支持的记录类型
+	ErrUnsupported = errors.New("unsupported record type")
+)
+
+// 未找到的记录种类
+const (
+	KindText      = "text"
+	KindLoadClass = "load class"
+	KindClass     = "class"
+	KindInstance  = "instance"
+	KindObject    = "object"
+)
+
+// NotFoundError 记录不存在，带上记录种类和 id
+type NotFoundError struct {
+	Kind string
+	Id   uint64
+}
+
+func NewNotFoundError(kind string, id uint64) *NotFoundError {
+	return &NotFoundError{Kind: kind, Id: id}
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s 0x%x not found", e.Kind, e.Id)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// CorruptRecordError 读取文件中 Pos 位置的记录失败
+type CorruptRecordError struct {
+	Id  uint64
+	Pos int64
+	Err error
+}
+
+func NewCorruptRecordError(id uint64, pos int64, err error) *CorruptRecordError {
+	return &CorruptRecordError{Id: id, Pos: pos, Err: err}
+}
+
+func (e *CorruptRecordError) Error() string {
+	return fmt.Sprintf("corrupt record 0x%x at offset %d: %v", e.Id, e.Pos, e.Err)
+}
+
+func (e *CorruptRecordError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+func (e *CorruptRecordError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedRecordError 记录类型无法处理
+type UnsupportedRecordError struct {
+	Type int
+	Id   uint64
+	Pos  int64
+}
+
+func NewUnsupportedRecordError(typ int, id uint64, pos int64) *UnsupportedRecordError {
+	return &UnsupportedRecordError{Type: typ, Id: id, Pos: pos}
+}
+
+func (e *UnsupportedRecordError) Error() string {
+	return fmt.Sprintf("unsupported record type 0x%x of 0x%x at offset %d", e.Type, e.Id, e.Pos)
+}
+
+func (e *UnsupportedRecordError) Is(target error) bool {
+	return target == ErrUnsupported
+}
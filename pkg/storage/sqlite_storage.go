@@ -42,7 +42,11 @@ CREATE TABLE IF NOT EXISTS hprof_records (
     -- fake data, fake class data
 	'raw' BLOB,
     -- 对象大小
-    size INTEGER NOT NULL
+    size INTEGER NOT NULL,
+    -- 是否从 GC roots 可达
+    reachable INTEGER NOT NULL DEFAULT 0,
+    -- 可达时路径上最弱的引用强度，取所有路径中最强的，0 表示强可达
+    strength INTEGER NOT NULL DEFAULT 0
 );
 CREATE INDEX hprof_records_type_idx ON hprof_records ('type');
 
@@ -71,10 +75,28 @@ CREATE TABLE IF NOT EXISTS 'links' (
     'from' INTEGER NOT NULL,
 	'to' NTEGER NOT NULL,
 	-- 引用类型？
-	'type' INTEGER NOT NULL
+	'type' INTEGER NOT NULL,
+	-- 引用强度，Reference.referent 之外都是 0
+	strength INTEGER NOT NULL DEFAULT 0
 );
 CREATE INDEX links_from_idx ON links ('from');
 CREATE INDEX links_to_idx ON links ('to');
+-- 支配树，只包含从 GC root 可达的对象
+CREATE TABLE IF NOT EXISTS dominators (
+    id INTEGER PRIMARY KEY,
+    -- 直接支配者，0 表示被 GC root 直接支配
+    idom INTEGER NOT NULL,
+    retained INTEGER NOT NULL
+);
+CREATE INDEX dominators_idom_idx ON dominators ('idom');
+-- 按类汇总的 retained size
+CREATE TABLE IF NOT EXISTS class_retained (
+    id INTEGER PRIMARY KEY,
+    -- 同 hprof_records 的 type 和 cid
+    'type' INTEGER NOT NULL,
+    cid INTEGER NOT NULL,
+    retained INTEGER NOT NULL
+);
 `, "'", "`")
 
 type SqliteStorage struct {
@@ -144,8 +166,7 @@ func (s *SqliteStorage) GetText(id uint64) (int64, string, error) {
 	var pos int64
 	var raw []byte
 	if err = row.Scan(&pos, &raw); err == sql.ErrNoRows {
-		// TODO NotFound error
-		return 0, "", err
+		return 0, "", NewNotFoundError(KindText, id)
 	}
 	if raw != nil {
 		return -1, string(raw), nil
@@ -175,8 +196,7 @@ func (s *SqliteStorage) GetLoadClassById(id uint64) (uint64, uint64, error) {
 	var cid uint64
 	var nameId uint64
 	if err = row.Scan(&cid, &nameId); err == sql.ErrNoRows {
-		// TODO NotFound error
-		return 0, 0, err
+		return 0, 0, NewNotFoundError(KindLoadClass, id)
 	}
 	return cid, nameId, err
 }
@@ -188,8 +208,7 @@ func (s *SqliteStorage) GetLoadClassByClassId(cid uint64) (uint64, uint64, error
 	var id uint64
 	var nameId uint64
 	if err = row.Scan(&id, &nameId); err == sql.ErrNoRows {
-		// TODO NotFound error
-		return 0, 0, err
+		return 0, 0, NewNotFoundError(KindClass, cid)
 	}
 	return id, nameId, err
 }
@@ -224,8 +243,7 @@ func (s *SqliteStorage) GetClass(cid uint64) (int64, *hprof.HProfClassRecord, er
 	var pos int64
 	var raw []byte
 	if err = row.Scan(&pos, &raw); err == sql.ErrNoRows {
-		// TODO NotFound error
-		return -1, nil, err
+		return -1, nil, NewNotFoundError(KindClass, cid)
 	}
 	if raw != nil {
 		cla := &hprof.HProfClassRecord{}
@@ -280,8 +298,7 @@ func (s *SqliteStorage) GetInstanceById(id uint64) (int64, error) {
 	var err error
 	var pos int64
 	if err = row.Scan(&pos); err == sql.ErrNoRows {
-		// TODO NotFound error
-		return 0, err
+		return 0, NewNotFoundError(KindInstance, id)
 	}
 	return pos, err
 }
@@ -309,8 +326,9 @@ func (s *SqliteStorage) ListInstances(fn func(id uint64, pos int64, cid uint64)
 	return nil
 }
 
-func (s *SqliteStorage) ListInstancesByClass(cid uint64, fn func(id uint64, pos, size int64) error) error {
-	rows, err := s.db.Query("SELECT id, `pos`, `size` FROM hprof_records WHERE `type`=? AND cid=? ORDER BY id",
+func (s *SqliteStorage) ListInstancesByClass(cid uint64, reachability Reachability, fn func(id uint64, pos, size, retained int64) error) error {
+	rows, err := s.db.Query("SELECT r.id, r.`pos`, r.`size`, IFNULL(d.retained, 0) FROM hprof_records r "+
+		"LEFT JOIN dominators d ON d.id = r.id WHERE r.`type`=? AND r.cid=?"+reachabilityCondition("r.", reachability)+" ORDER BY r.id",
 		hprof.HProfHDRecordTypeInstanceDump, cid)
 	if err != nil {
 		return err
@@ -319,12 +337,13 @@ func (s *SqliteStorage) ListInstancesByClass(cid uint64, fn func(id uint64, pos,
 	var id uint64
 	var pos int64
 	var size int64
+	var retained int64
 	for rows.Next() {
-		err = rows.Scan(&id, &pos, &size)
+		err = rows.Scan(&id, &pos, &size, &retained)
 		if err != nil {
 			return err
 		}
-		err = fn(id, pos, size)
+		err = fn(id, pos, size, retained)
 		if err != nil {
 			return err
 		}
@@ -332,8 +351,8 @@ func (s *SqliteStorage) ListInstancesByClass(cid uint64, fn func(id uint64, pos,
 	return nil
 }
 
-func (s *SqliteStorage) CountInstancesByClass(fn func(cid uint64, count, size int64) error) error {
-	rows, err := s.db.Query("SELECT cid, COUNT(id) as c, SUM(`size`) as s FROM hprof_records WHERE `type`=? GROUP BY cid",
+func (s *SqliteStorage) CountInstancesByClass(reachability Reachability, fn func(cid uint64, count, size int64) error) error {
+	rows, err := s.db.Query("SELECT cid, COUNT(id) as c, SUM(`size`) as s FROM hprof_records WHERE `type`=?"+reachabilityCondition("", reachability)+" GROUP BY cid",
 		hprof.HProfHDRecordTypeInstanceDump)
 	if err != nil {
 		return err
@@ -355,6 +374,13 @@ func (s *SqliteStorage) CountInstancesByClass(fn func(cid uint64, count, size in
 	return nil
 }
 
+// UpdateInstanceSizes 更新某个类所有 instance 的大小
+func (s *SqliteStorage) UpdateInstanceSizes(cid uint64, size int64) error {
+	_, err := s.db.Exec("UPDATE hprof_records SET `size`=? WHERE `type`=? AND cid=?",
+		size, hprof.HProfHDRecordTypeInstanceDump, cid)
+	return err
+}
+
 // SaveObjectArray 记录 ObjectArray 索引
 func (s *SqliteStorage) SaveObjectArray(pos, oid, cid int64, size int) error {
 	_, err := s.db.Exec("INSERT INTO hprof_records (id, `type`, `pos`, cid, `size`) VALUES (?, ?, ?, ?, ?)",
@@ -362,8 +388,32 @@ func (s *SqliteStorage) SaveObjectArray(pos, oid, cid int64, size int) error {
 	return err
 }
 
-func (s *SqliteStorage) ListObjectArrayByClass(cid uint64, fn func(id uint64, pos, size int64) error) error {
-	rows, err := s.db.Query("SELECT id, `pos`, `size` FROM hprof_records WHERE `type`=? AND cid=? ORDER BY id",
+func (s *SqliteStorage) ListObjectArrays(fn func(id uint64, pos int64, cid uint64) error) error {
+	rows, err := s.db.Query("SELECT id, `pos`, cid FROM hprof_records WHERE `type`=? ORDER BY id",
+		hprof.HProfHDRecordTypeObjectArrayDump)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var id uint64
+	var pos int64
+	var cid uint64
+	for rows.Next() {
+		err = rows.Scan(&id, &pos, &cid)
+		if err != nil {
+			return err
+		}
+		err = fn(id, pos, cid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SqliteStorage) ListObjectArrayByClass(cid uint64, reachability Reachability, fn func(id uint64, pos, size, retained int64) error) error {
+	rows, err := s.db.Query("SELECT r.id, r.`pos`, r.`size`, IFNULL(d.retained, 0) FROM hprof_records r "+
+		"LEFT JOIN dominators d ON d.id = r.id WHERE r.`type`=? AND r.cid=?"+reachabilityCondition("r.", reachability)+" ORDER BY r.id",
 		hprof.HProfHDRecordTypeObjectArrayDump, cid)
 	if err != nil {
 		return err
@@ -372,12 +422,13 @@ func (s *SqliteStorage) ListObjectArrayByClass(cid uint64, fn func(id uint64, po
 	var id uint64
 	var pos int64
 	var size int64
+	var retained int64
 	for rows.Next() {
-		err = rows.Scan(&id, &pos, &size)
+		err = rows.Scan(&id, &pos, &size, &retained)
 		if err != nil {
 			return err
 		}
-		err = fn(id, pos, size)
+		err = fn(id, pos, size, retained)
 		if err != nil {
 			return err
 		}
@@ -385,8 +436,8 @@ func (s *SqliteStorage) ListObjectArrayByClass(cid uint64, fn func(id uint64, po
 	return nil
 }
 
-func (s *SqliteStorage) CountObjectArrayByClass(fn func(cid uint64, count, size int64) error) error {
-	rows, err := s.db.Query("SELECT cid, COUNT(id) as c, SUM(`size`) as s FROM hprof_records WHERE `type`=? GROUP BY cid",
+func (s *SqliteStorage) CountObjectArrayByClass(reachability Reachability, fn func(cid uint64, count, size int64) error) error {
+	rows, err := s.db.Query("SELECT cid, COUNT(id) as c, SUM(`size`) as s FROM hprof_records WHERE `type`=?"+reachabilityCondition("", reachability)+" GROUP BY cid",
 		hprof.HProfHDRecordTypeObjectArrayDump)
 	if err != nil {
 		return err
@@ -408,6 +459,13 @@ func (s *SqliteStorage) CountObjectArrayByClass(fn func(cid uint64, count, size
 	return nil
 }
 
+// UpdateObjectArraySizes 把 object array 的元素个数换算成对象大小
+func (s *SqliteStorage) UpdateObjectArraySizes(header, elementSize, alignment int) error {
+	_, err := s.db.Exec("UPDATE hprof_records SET `size`=(? + `size` * ? + ? - 1) / ? * ? WHERE `type`=?",
+		header, elementSize, alignment, alignment, alignment, hprof.HProfHDRecordTypeObjectArrayDump)
+	return err
+}
+
 // SaveInstance 记录 Instances 索引
 func (s *SqliteStorage) SavePrimitiveArray(pos, oid, typ int64, size int) error {
 	_, err := s.db.Exec("INSERT INTO hprof_records (id, `type`, `pos`, `cid`, `size`) VALUES (?, ?, ?, ?, ?)",
@@ -415,8 +473,9 @@ func (s *SqliteStorage) SavePrimitiveArray(pos, oid, typ int64, size int) error
 	return err
 }
 
-func (s *SqliteStorage) ListPrimitiveArrayByClass(typ uint64, fn func(id uint64, pos, size int64) error) error {
-	rows, err := s.db.Query("SELECT id, `pos`, `size` FROM hprof_records WHERE `type`=? AND `cid`=? ORDER BY id",
+func (s *SqliteStorage) ListPrimitiveArrayByClass(typ uint64, reachability Reachability, fn func(id uint64, pos, size, retained int64) error) error {
+	rows, err := s.db.Query("SELECT r.id, r.`pos`, r.`size`, IFNULL(d.retained, 0) FROM hprof_records r "+
+		"LEFT JOIN dominators d ON d.id = r.id WHERE r.`type`=? AND r.cid=?"+reachabilityCondition("r.", reachability)+" ORDER BY r.id",
 		hprof.HProfHDRecordTypePrimitiveArrayDump, typ)
 	if err != nil {
 		return err
@@ -425,12 +484,13 @@ func (s *SqliteStorage) ListPrimitiveArrayByClass(typ uint64, fn func(id uint64,
 	var id uint64
 	var pos int64
 	var size int64
+	var retained int64
 	for rows.Next() {
-		err = rows.Scan(&id, &pos, &size)
+		err = rows.Scan(&id, &pos, &size, &retained)
 		if err != nil {
 			return err
 		}
-		err = fn(id, pos, size)
+		err = fn(id, pos, size, retained)
 		if err != nil {
 			return err
 		}
@@ -438,8 +498,15 @@ func (s *SqliteStorage) ListPrimitiveArrayByClass(typ uint64, fn func(id uint64,
 	return nil
 }
 
-func (s *SqliteStorage) CountPrimitiveArrayByType(fn func(cid uint64, count, size int64) error) error {
-	rows, err := s.db.Query("SELECT `cid`, COUNT(id) as c, SUM(`size`) as s FROM hprof_records WHERE `type`=? GROUP BY `cid`",
+// UpdatePrimitiveArraySizes 把某种 primitive array 的元素个数换算成对象大小
+func (s *SqliteStorage) UpdatePrimitiveArraySizes(typ uint64, header, elementSize, alignment int) error {
+	_, err := s.db.Exec("UPDATE hprof_records SET `size`=(? + `size` * ? + ? - 1) / ? * ? WHERE `type`=? AND `cid`=?",
+		header, elementSize, alignment, alignment, alignment, hprof.HProfHDRecordTypePrimitiveArrayDump, typ)
+	return err
+}
+
+func (s *SqliteStorage) CountPrimitiveArrayByType(reachability Reachability, fn func(cid uint64, count, size int64) error) error {
+	rows, err := s.db.Query("SELECT `cid`, COUNT(id) as c, SUM(`size`) as s FROM hprof_records WHERE `type`=?"+reachabilityCondition("", reachability)+" GROUP BY `cid`",
 		hprof.HProfHDRecordTypePrimitiveArrayDump)
 	if err != nil {
 		return err
@@ -502,8 +569,9 @@ func (s *SqliteStorage) ListThreads(fn func(r *hprof.HProfThreadRecord) error) e
 	}
 	defer rows.Close()
 	var raw []byte
-	var record = &hprof.HProfThreadRecord{}
 	for rows.Next() {
+		// 每行使用新的 record，gob 解码时会复用已有 slice 的底层数组
+		var record = &hprof.HProfThreadRecord{}
 		err = rows.Scan(&raw)
 		if err != nil {
 			return err
@@ -534,8 +602,8 @@ func (s *SqliteStorage) ListThreadTraces(fn func(r *hprof.HProfTraceRecord) erro
 	}
 	defer rows.Close()
 	var raw []byte
-	var record = &hprof.HProfTraceRecord{}
 	for rows.Next() {
+		var record = &hprof.HProfTraceRecord{}
 		err = rows.Scan(&raw)
 		if err != nil {
 			return err
@@ -566,8 +634,8 @@ func (s *SqliteStorage) ListThreadFrames(fn func(r *hprof.HProfFrameRecord) erro
 	}
 	defer rows.Close()
 	var raw []byte
-	var record = &hprof.HProfFrameRecord{}
 	for rows.Next() {
+		var record = &hprof.HProfFrameRecord{}
 		err = rows.Scan(&raw)
 		if err != nil {
 			return err
@@ -585,27 +653,27 @@ func (s *SqliteStorage) ListThreadFrames(fn func(r *hprof.HProfFrameRecord) erro
 }
 
 // AppendReference 添加引用关系
-func (s *SqliteStorage) AppendReference(from, to uint64, typ int) error {
-	r, err := s.db.Exec("INSERT INTO links (`from`, `to`, `type`) VALUES (?, ?, ?)", from, to, typ)
+func (s *SqliteStorage) AppendReference(from, to uint64, typ, strength int) error {
+	r, err := s.db.Exec("INSERT INTO links (`from`, `to`, `type`, strength) VALUES (?, ?, ?, ?)", from, to, typ, strength)
 	_, err = r.RowsAffected()
 	return err
 }
 
 // ListInboundReferences 列出指向当前对象 id 的其他对象 id
-func (s *SqliteStorage) ListInboundReferences(rid uint64, fn func(from uint64, typ int) error) error {
-	rows, err := s.db.Query("SELECT `from`, `type` FROM links WHERE `to`=?", rid)
+func (s *SqliteStorage) ListInboundReferences(rid uint64, fn func(from uint64, typ, strength int) error) error {
+	rows, err := s.db.Query("SELECT `from`, `type`, strength FROM links WHERE `to`=?", rid)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 	var from uint64
-	var typ int
+	var typ, strength int
 	for rows.Next() {
-		err = rows.Scan(&from, &typ)
+		err = rows.Scan(&from, &typ, &strength)
 		if err != nil {
 			return err
 		}
-		err = fn(from, typ)
+		err = fn(from, typ, strength)
 		if err != nil {
 			return err
 		}
@@ -614,20 +682,153 @@ func (s *SqliteStorage) ListInboundReferences(rid uint64, fn func(from uint64, t
 }
 
 // ListOutboundReferences 列出从当前对象 id 指向的其他对象 id
-func (s *SqliteStorage) ListOutboundReferences(rid uint64, fn func(to uint64, typ int) error) error {
-	rows, err := s.db.Query("SELECT `to`, `type` FROM links WHERE `from`=?", rid)
+func (s *SqliteStorage) ListOutboundReferences(rid uint64, fn func(to uint64, typ, strength int) error) error {
+	rows, err := s.db.Query("SELECT `to`, `type`, strength FROM links WHERE `from`=?", rid)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 	var to uint64
+	var typ, strength int
+	for rows.Next() {
+		err = rows.Scan(&to, &typ, &strength)
+		if err != nil {
+			return err
+		}
+		err = fn(to, typ, strength)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListRecords 按 id 顺序列出所有 class、instance 和数组记录
+func (s *SqliteStorage) ListRecords(fn func(id uint64, typ int, cid uint64, size int64) error) error {
+	rows, err := s.db.Query("SELECT id, `type`, cid, `size` FROM hprof_records ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var id uint64
+	var typ int
+	var cid uint64
+	var size int64
+	for rows.Next() {
+		err = rows.Scan(&id, &typ, &cid, &size)
+		if err != nil {
+			return err
+		}
+		err = fn(id, typ, cid, size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveDominator 记录对象的直接支配者和 retained size
+func (s *SqliteStorage) SaveDominator(id, idom uint64, retained int64) error {
+	_, err := s.db.Exec("INSERT INTO dominators (id, idom, retained) VALUES (?, ?, ?)", id, idom, retained)
+	return err
+}
+
+// GetDominator 获取对象的直接支配者和 retained size
+func (s *SqliteStorage) GetDominator(id uint64) (uint64, int64, error) {
+	row := s.db.QueryRow("SELECT idom, retained FROM dominators WHERE id=?", id)
+	var err error
+	var idom uint64
+	var retained int64
+	if err = row.Scan(&idom, &retained); err == sql.ErrNoRows {
+		return 0, 0, NewNotFoundError(KindObject, id)
+	}
+	return idom, retained, err
+}
+
+// ListDominated 列出被 idom 直接支配的对象，按 retained size 降序
+func (s *SqliteStorage) ListDominated(idom uint64, fn func(id uint64, retained int64) error) error {
+	rows, err := s.db.Query("SELECT id, retained FROM dominators WHERE idom=? ORDER BY retained DESC", idom)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var id uint64
+	var retained int64
+	for rows.Next() {
+		err = rows.Scan(&id, &retained)
+		if err != nil {
+			return err
+		}
+		err = fn(id, retained)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveClassRetained 记录类的 retained size
+func (s *SqliteStorage) SaveClassRetained(typ int, cid uint64, retained int64) error {
+	_, err := s.db.Exec("INSERT INTO class_retained (`type`, cid, retained) VALUES (?, ?, ?)", typ, cid, retained)
+	return err
+}
+
+func (s *SqliteStorage) ListClassRetained(fn func(typ int, cid uint64, retained int64) error) error {
+	rows, err := s.db.Query("SELECT `type`, cid, retained FROM class_retained ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 	var typ int
+	var cid uint64
+	var retained int64
 	for rows.Next() {
-		err = rows.Scan(&to, &typ)
+		err = rows.Scan(&typ, &cid, &retained)
 		if err != nil {
 			return err
 		}
-		err = fn(to, typ)
+		err = fn(typ, cid, retained)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetReachable 标记对象从 GC roots 可达，strength 是对象可达的引用强度
+func (s *SqliteStorage) SetReachable(id uint64, strength int) error {
+	_, err := s.db.Exec("UPDATE hprof_records SET reachable=1, strength=? WHERE id=?", strength, id)
+	return err
+}
+
+// GetReachability 返回对象是否从 GC roots 可达和可达的引用强度
+func (s *SqliteStorage) GetReachability(id uint64) (bool, int, error) {
+	row := s.db.QueryRow("SELECT reachable, strength FROM hprof_records WHERE id=?", id)
+	var reachable bool
+	var strength int
+	err := row.Scan(&reachable, &strength)
+	if err == sql.ErrNoRows {
+		return false, 0, NewNotFoundError(KindObject, id)
+	}
+	return reachable, strength, err
+}
+
+// ListWeaklyReachable 列出只能通过 Reference.referent 可达的对象
+func (s *SqliteStorage) ListWeaklyReachable(fn func(id uint64, typ int, cid uint64, size int64, strength int) error) error {
+	rows, err := s.db.Query("SELECT id, `type`, cid, `size`, strength FROM hprof_records WHERE reachable=1 AND strength<>0 ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var id, cid uint64
+	var typ, strength int
+	var size int64
+	for rows.Next() {
+		err = rows.Scan(&id, &typ, &cid, &size, &strength)
+		if err != nil {
+			return err
+		}
+		err = fn(id, typ, cid, size, strength)
 		if err != nil {
 			return err
 		}
@@ -643,8 +844,7 @@ func (s *SqliteStorage) GetRecordById(id uint64) (int64, int, hprof.HProfRecord,
 	var pos int64
 	var raw []byte
 	if err = row.Scan(&typ, &pos, &raw); err == sql.ErrNoRows {
-		// TODO NotFound error
-		return 0, 0, nil, err
+		return 0, 0, nil, NewNotFoundError(KindObject, id)
 	}
 	if raw != nil {
 		cla := &hprof.HProfClassRecord{}
@@ -654,6 +854,33 @@ func (s *SqliteStorage) GetRecordById(id uint64) (int64, int, hprof.HProfRecord,
 	return pos, typ, nil, nil
 }
 
+// GetObjectSize 返回对象的 shallow size
+// class 记录的 size 是实例大小，不是 class 对象本身的大小，返回 0
+func (s *SqliteStorage) GetObjectSize(id uint64) (int64, error) {
+	row := s.db.QueryRow("SELECT `type`, size FROM hprof_records WHERE id=?", id)
+	var typ int
+	var size int64
+	err := row.Scan(&typ, &size)
+	if err == sql.ErrNoRows {
+		return 0, NewNotFoundError(KindObject, id)
+	}
+	if typ == hprof.HProfHDRecordTypeClassDump {
+		return 0, err
+	}
+	return size, err
+}
+
+// reachabilityCondition 返回 reachable 字段的过滤条件
+func reachabilityCondition(prefix string, reachability Reachability) string {
+	switch reachability {
+	case ReachableObjects:
+		return " AND " + prefix + "reachable=1"
+	case UnreachableObjects:
+		return " AND " + prefix + "reachable=0"
+	}
+	return ""
+}
+
 // encodeGob 主要用于序列化数组
 func encodeGob(v interface{}) []byte {
 	var buf bytes.Buffer
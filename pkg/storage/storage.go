@@ -9,6 +9,15 @@ const (
 	THREADS_KEY   = "threads"
 )
 
+// Reachability 按对象是否从 GC roots 可达过滤
+type Reachability int
+
+const (
+	AllObjects Reachability = iota
+	ReachableObjects
+	UnreachableObjects
+)
+
 type Storage interface {
 	Init() error
 	Close() error
@@ -32,16 +41,20 @@ type Storage interface {
 	SaveInstance(pos, oid, cid int64, size int) error
 	GetInstanceById(id uint64) (int64, error)
 	ListInstances(fn func(id uint64, pos int64, cid uint64) error) error
-	ListInstancesByClass(cid uint64, fn func(id uint64, pos, size int64) error) error
-	CountInstancesByClass(fn func(cid uint64, count, size int64) error) error
+	ListInstancesByClass(cid uint64, reachability Reachability, fn func(id uint64, pos, size, retained int64) error) error
+	CountInstancesByClass(reachability Reachability, fn func(cid uint64, count, size int64) error) error
+	UpdateInstanceSizes(cid uint64, size int64) error
 
 	SaveObjectArray(pos, oid, cid int64, size int) error
-	ListObjectArrayByClass(cid uint64, fn func(id uint64, pos, size int64) error) error
-	CountObjectArrayByClass(fn func(cid uint64, count, size int64) error) error
+	ListObjectArrays(fn func(id uint64, pos int64, cid uint64) error) error
+	ListObjectArrayByClass(cid uint64, reachability Reachability, fn func(id uint64, pos, size, retained int64) error) error
+	CountObjectArrayByClass(reachability Reachability, fn func(cid uint64, count, size int64) error) error
+	UpdateObjectArraySizes(header, elementSize, alignment int) error
 
 	SavePrimitiveArray(pos, oid, typ int64, size int) error
-	ListPrimitiveArrayByClass(typ uint64, fn func(id uint64, pos, size int64) error) error
-	CountPrimitiveArrayByType(fn func(cid uint64, count, size int64) error) error
+	ListPrimitiveArrayByClass(typ uint64, reachability Reachability, fn func(id uint64, pos, size, retained int64) error) error
+	CountPrimitiveArrayByType(reachability Reachability, fn func(cid uint64, count, size int64) error) error
+	UpdatePrimitiveArraySizes(typ uint64, header, elementSize, alignment int) error
 
 	SaveGCRoot(typ int, pos int64) error
 	ListGCRoots(fn func(pos int64, typ int) error) error
@@ -53,9 +66,20 @@ type Storage interface {
 	SaveThreadFrame(r *hprof.HProfFrameRecord) error
 	ListThreadFrames(fn func(r *hprof.HProfFrameRecord) error) error
 
-	AppendReference(from, to uint64, typ int) error
-	ListInboundReferences(rid uint64, fn func(from uint64, typ int) error) error
-	ListOutboundReferences(rid uint64, fn func(to uint64, typ int) error) error
+	AppendReference(from, to uint64, typ, strength int) error
+	ListInboundReferences(rid uint64, fn func(from uint64, typ, strength int) error) error
+	ListOutboundReferences(rid uint64, fn func(to uint64, typ, strength int) error) error
 
+	ListRecords(fn func(id uint64, typ int, cid uint64, size int64) error) error
+	SetReachable(id uint64, strength int) error
+	GetReachability(id uint64) (bool, int, error)
+	ListWeaklyReachable(fn func(id uint64, typ int, cid uint64, size int64, strength int) error) error
 	GetRecordById(id uint64) (int64, int, hprof.HProfRecord, error)
+	GetObjectSize(id uint64) (int64, error)
+
+	SaveDominator(id, idom uint64, retained int64) error
+	GetDominator(id uint64) (uint64, int64, error)
+	ListDominated(idom uint64, fn func(id uint64, retained int64) error) error
+	SaveClassRetained(typ int, cid uint64, retained int64) error
+	ListClassRetained(fn func(typ int, cid uint64, retained int64) error) error
 }
@@ -1,10 +1,20 @@
 package web
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"hprof-tool/pkg/hprof"
+	"hprof-tool/pkg/model"
+	"hprof-tool/pkg/oql"
+	"hprof-tool/pkg/report"
 	"hprof-tool/pkg/snapshot"
+	"io"
+	"net/http"
 	"strconv"
+	"strings"
 )
 
 type WebEndpoint struct {
@@ -28,15 +38,69 @@ func (w *WebEndpoint) initEndpoints() {
 		threads := w.s.GetThreads()
 		return c.JSON(200, threads)
 	})
+	g.GET("/threads/jstack", func(c echo.Context) error {
+		threads, err := w.s.GetThreadOverview()
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		var buf bytes.Buffer
+		if err = report.WriteJStack(&buf, w.s.DumpTime(), threads); err != nil {
+			return errorResponse(c, err)
+		}
+		return c.String(200, buf.String())
+	})
+	g.GET("/threads/overview", func(c echo.Context) error {
+		threads, err := w.s.GetThreadOverview()
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, threads)
+	})
 	g.GET("/classes", func(c echo.Context) error {
-		classes, err := w.s.ListClassesStatistics()
+		reachability, err := snapshot.ParseReachability(c.QueryParam("reachability"))
 		if err != nil {
-			return c.JSON(500, struct {
-				Error string `json:"error"`
-			}{Error: err.Error()})
+			return badRequest(c, err)
+		}
+		if v := c.QueryParam("groupBy"); v != "" {
+			grouping, err := snapshot.ParseClassGrouping(v)
+			if err != nil {
+				return badRequest(c, err)
+			}
+			level := 0
+			if v := c.QueryParam("level"); v != "" {
+				level, err = strconv.Atoi(v)
+				if err != nil || level < 0 {
+					return badRequest(c, fmt.Errorf("invalid level: %s", v))
+				}
+			}
+			groups, err := w.s.GroupClassesStatistics(reachability, grouping, level)
+			if err != nil {
+				return errorResponse(c, err)
+			}
+			return c.JSON(200, groups)
+		}
+		classes, err := w.s.ListClassesStatistics(reachability)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, classes)
+	})
+	g.GET("/unreachable/classes", func(c echo.Context) error {
+		classes, err := w.s.ListUnreachableClassesStatistics()
+		if err != nil {
+			return errorResponse(c, err)
 		}
 		return c.JSON(200, classes)
 	})
+	g.GET("/classes/:id", func(c echo.Context) error {
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+
+		detail, err := w.s.GetClassDetail(id)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, detail)
+	})
 	g.GET("/classes/:id/instances", func(c echo.Context) error {
 		idStr := c.Param("id")
 		id, _ := strconv.ParseUint(idStr, 10, 64)
@@ -51,11 +115,21 @@ func (w *WebEndpoint) initEndpoints() {
 			typ = 0x20
 		}
 
-		classes, err := w.s.ListInstancesStatistics(id, typ)
+		reachability, err := snapshot.ParseReachability(c.QueryParam("reachability"))
 		if err != nil {
-			return c.JSON(500, struct {
-				Error string `json:"error"`
-			}{Error: err.Error()})
+			return badRequest(c, err)
+		}
+		offset, err := strconv.Atoi(c.QueryParam("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+		limit, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit <= 0 {
+			limit = 100
+		}
+		classes, err := w.s.ListInstancesStatistics(id, typ, reachability, offset, limit)
+		if err != nil {
+			return errorResponse(c, err)
 		}
 		return c.JSON(200, classes)
 	})
@@ -65,12 +139,468 @@ func (w *WebEndpoint) initEndpoints() {
 
 		instance, err := w.s.GetInstanceDetail(id)
 		if err != nil {
-			return c.JSON(500, struct {
-				Error string `json:"error"`
-			}{Error: err.Error()})
+			return errorResponse(c, err)
 		}
 		return c.JSON(200, instance)
 	})
+	g.GET("/instances/:id/contents", func(c echo.Context) error {
+		idStr := c.Param("id")
+		id, _ := strconv.ParseUint(idStr, 10, 64)
+		offset, err := strconv.Atoi(c.QueryParam("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+		limit, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit <= 0 {
+			limit = 100
+		}
+
+		contents, err := w.s.GetCollectionContents(id, offset, limit)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, contents)
+	})
+	g.GET("/instances/:id/dominator", func(c echo.Context) error {
+		idStr := c.Param("id")
+		id, _ := strconv.ParseUint(idStr, 10, 64)
+
+		dominator, err := w.s.GetDominator(id)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, dominator)
+	})
+	g.GET("/dominators/:id", func(c echo.Context) error {
+		idStr := c.Param("id")
+		id, _ := strconv.ParseUint(idStr, 10, 64)
+
+		dominated, err := w.s.ListDominated(id)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, dominated)
+	})
+	g.GET("/instances/:id/paths", func(c echo.Context) error {
+		idStr := c.Param("id")
+		id, _ := strconv.ParseUint(idStr, 10, 64)
+		n, err := strconv.Atoi(c.QueryParam("n"))
+		if err != nil || n <= 0 {
+			n = 10
+		}
+		excluded, err := parseExcludedStrengths(c)
+		if err != nil {
+			return badRequest(c, err)
+		}
+
+		paths, err := w.s.FindPathsToGCRoots(id, n, excluded)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, paths)
+	})
+	g.GET("/instances/:id/paths/:target", func(c echo.Context) error {
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+		target, _ := strconv.ParseUint(c.Param("target"), 10, 64)
+		opts := snapshot.DefaultObjectPathsOptions()
+		if v := c.QueryParam("n"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return badRequest(c, fmt.Errorf("invalid n: %s", v))
+			}
+			opts.MaxPaths = n
+		}
+		if v := c.QueryParam("depth"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return badRequest(c, fmt.Errorf("invalid depth: %s", v))
+			}
+			opts.MaxDepth = n
+		}
+		excluded, err := parseExcludedStrengths(c)
+		if err != nil {
+			return badRequest(c, err)
+		}
+		opts.Excluded = excluded
+		if v := c.QueryParam("kinds"); v != "" {
+			for _, name := range strings.Split(v, ",") {
+				kind, err := snapshot.ParseReferenceKind(name)
+				if err != nil {
+					return badRequest(c, err)
+				}
+				opts.Kinds = append(opts.Kinds, kind)
+			}
+		}
+
+		paths, err := w.s.FindPathsBetween(id, target, opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, paths)
+	})
+	g.GET("/analysis/leak-suspects", func(c echo.Context) error {
+		opts := snapshot.DefaultLeakSuspectsOptions()
+		if v := c.QueryParam("threshold"); v != "" {
+			threshold, err := strconv.ParseFloat(v, 64)
+			if err != nil || threshold <= 0 || threshold > 1 {
+				return badRequest(c, fmt.Errorf("invalid threshold: %s", v))
+			}
+			opts.Threshold = threshold
+		}
+		if v := c.QueryParam("accumulation"); v != "" {
+			ratio, err := strconv.ParseFloat(v, 64)
+			if err != nil || ratio <= 0 || ratio > 1 {
+				return badRequest(c, fmt.Errorf("invalid accumulation ratio: %s", v))
+			}
+			opts.AccumulationRatio = ratio
+		}
+		if v := c.QueryParam("classes"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid classes: %s", v))
+			}
+			opts.MaxClasses = n
+		}
+
+		report, err := w.s.FindLeakSuspects(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/duplicate-strings", func(c echo.Context) error {
+		opts := snapshot.DefaultDuplicateStringsOptions()
+		if v := c.QueryParam("min"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 2 {
+				return badRequest(c, fmt.Errorf("invalid min: %s", v))
+			}
+			opts.MinCount = n
+		}
+		if v := c.QueryParam("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid limit: %s", v))
+			}
+			opts.Limit = n
+		}
+		if v := c.QueryParam("reachability"); v != "" {
+			reachability, err := snapshot.ParseReachability(v)
+			if err != nil {
+				return badRequest(c, err)
+			}
+			opts.Reachability = reachability
+		}
+
+		report, err := w.s.FindDuplicateStrings(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/duplicate-arrays", func(c echo.Context) error {
+		opts := snapshot.DefaultDuplicateArraysOptions()
+		if v := c.QueryParam("min"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 2 {
+				return badRequest(c, fmt.Errorf("invalid min: %s", v))
+			}
+			opts.MinCount = n
+		}
+		if v := c.QueryParam("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid limit: %s", v))
+			}
+			opts.Limit = n
+		}
+		if v := c.QueryParam("reachability"); v != "" {
+			reachability, err := snapshot.ParseReachability(v)
+			if err != nil {
+				return badRequest(c, err)
+			}
+			opts.Reachability = reachability
+		}
+
+		report, err := w.s.FindDuplicateArrays(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/collections", func(c echo.Context) error {
+		opts := snapshot.DefaultCollectionsOptions()
+		if v := c.QueryParam("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid limit: %s", v))
+			}
+			opts.Limit = n
+		}
+		if v := c.QueryParam("reachability"); v != "" {
+			reachability, err := snapshot.ParseReachability(v)
+			if err != nil {
+				return badRequest(c, err)
+			}
+			opts.Reachability = reachability
+		}
+
+		report, err := w.s.AnalyzeCollections(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/boxed-primitives", func(c echo.Context) error {
+		opts := snapshot.DefaultBoxedPrimitivesOptions()
+		if v := c.QueryParam("owners"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid owners: %s", v))
+			}
+			opts.MaxOwners = n
+		}
+		if v := c.QueryParam("depth"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid depth: %s", v))
+			}
+			opts.MaxOwnerDepth = n
+		}
+		if v := c.QueryParam("reachability"); v != "" {
+			reachability, err := snapshot.ParseReachability(v)
+			if err != nil {
+				return badRequest(c, err)
+			}
+			opts.Reachability = reachability
+		}
+
+		report, err := w.s.AnalyzeBoxedPrimitives(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/class-loaders", func(c echo.Context) error {
+		opts := snapshot.DefaultClassLoadersOptions()
+		if v := c.QueryParam("paths"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid paths: %s", v))
+			}
+			opts.MaxPaths = n
+		}
+		if v := c.QueryParam("duplicates"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid duplicates: %s", v))
+			}
+			opts.MaxDuplicates = n
+		}
+		if v := c.QueryParam("reachability"); v != "" {
+			reachability, err := snapshot.ParseReachability(v)
+			if err != nil {
+				return badRequest(c, err)
+			}
+			opts.Reachability = reachability
+		}
+
+		report, err := w.s.AnalyzeClassLoaders(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/locks", func(c echo.Context) error {
+		report, err := w.s.AnalyzeLocks()
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/finalizers", func(c echo.Context) error {
+		opts := snapshot.DefaultFinalizersOptions()
+		if v := c.QueryParam("classes"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid classes: %s", v))
+			}
+			opts.MaxClasses = n
+		}
+		if v := c.QueryParam("objects"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid objects: %s", v))
+			}
+			opts.MaxObjects = n
+		}
+
+		report, err := w.s.AnalyzeFinalizers(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/weakly-reachable", func(c echo.Context) error {
+		opts := snapshot.DefaultWeaklyReachableOptions()
+		if v := c.QueryParam("classes"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid classes: %s", v))
+			}
+			opts.MaxClasses = n
+		}
+
+		report, err := w.s.FindWeaklyReachable(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/off-heap", func(c echo.Context) error {
+		opts := snapshot.DefaultOffHeapOptions()
+		if v := c.QueryParam("buffers"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid buffers: %s", v))
+			}
+			opts.MaxBuffers = n
+		}
+		if v := c.QueryParam("owners"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid owners: %s", v))
+			}
+			opts.MaxOwners = n
+		}
+		if v := c.QueryParam("depth"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid depth: %s", v))
+			}
+			opts.MaxOwnerDepth = n
+		}
+
+		report, err := w.s.AnalyzeOffHeap(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	g.GET("/analysis/static-fields", func(c echo.Context) error {
+		opts := snapshot.DefaultStaticFieldsOptions()
+		if v := c.QueryParam("fields"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return badRequest(c, fmt.Errorf("invalid fields: %s", v))
+			}
+			opts.MaxFields = n
+		}
+
+		report, err := w.s.AnalyzeStaticFields(opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	// class 指定类的所有实例，subclasses=true 时包括子类，也可以用 ids 指定逗号分隔的对象 id
+	g.GET("/analysis/merged-paths", func(c echo.Context) error {
+		var ids []uint64
+		if v := c.QueryParam("ids"); v != "" {
+			for _, idStr := range strings.Split(v, ",") {
+				id, err := strconv.ParseUint(idStr, 10, 64)
+				if err != nil {
+					return badRequest(c, fmt.Errorf("invalid id: %s", idStr))
+				}
+				ids = append(ids, id)
+			}
+		} else if class := c.QueryParam("class"); class != "" {
+			var err error
+			ids, err = w.s.ListObjectIds(class, c.QueryParam("subclasses") == "true", snapshot.AllObjects)
+			if err != nil {
+				return errorResponse(c, err)
+			}
+		} else {
+			return badRequest(c, errors.New("missing class or ids"))
+		}
+		opts := snapshot.DefaultMergedPathsOptions()
+		if v := c.QueryParam("objects"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return badRequest(c, fmt.Errorf("invalid objects: %s", v))
+			}
+			opts.MaxObjects = n
+		}
+		excluded, err := parseExcludedStrengths(c)
+		if err != nil {
+			return badRequest(c, err)
+		}
+		opts.Excluded = excluded
+
+		report, err := w.s.MergePathsToGCRoots(ids, opts)
+		if err != nil {
+			return errorResponse(c, err)
+		}
+		return c.JSON(200, report)
+	})
+	// 查询语句可以放在参数 q 中，也可以作为 POST 的请求体
+	// 结果按行输出 JSON：第一行是列名，之后每行是一个数组，执行中出错时最后一行是错误
+	query := func(c echo.Context) error {
+		text := c.QueryParam("q")
+		if text == "" && c.Request().Method == http.MethodPost {
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return badRequest(c, err)
+			}
+			text = string(body)
+		}
+		if strings.TrimSpace(text) == "" {
+			return badRequest(c, errors.New("missing query"))
+		}
+		q, err := oql.Parse(text)
+		if err != nil {
+			return badRequest(c, err)
+		}
+
+		res := c.Response()
+		enc := json.NewEncoder(res)
+		// 第一行结果之前出错时仍然可以返回错误状态码
+		started := false
+		start := func() error {
+			started = true
+			res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+			res.WriteHeader(200)
+			return enc.Encode(struct {
+				Columns []string `json:"columns"`
+			}{q.Columns()})
+		}
+		err = oql.NewEngine(w.s).Execute(q, func(row []interface{}) error {
+			if !started {
+				if err := start(); err != nil {
+					return err
+				}
+			}
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+			res.Flush()
+			return nil
+		})
+		if err != nil && !started {
+			return errorResponse(c, err)
+		}
+		if !started {
+			return start()
+		}
+		if err != nil {
+			return enc.Encode(struct {
+				Error string `json:"error"`
+			}{Error: err.Error()})
+		}
+		return nil
+	}
+	g.GET("/query", query)
+	g.POST("/query", query)
 	g.GET("/references/:id/inbound", func(c echo.Context) error {
 		idStr := c.Param("id")
 		id, _ := strconv.ParseUint(idStr, 10, 64)
@@ -81,14 +611,59 @@ func (w *WebEndpoint) initEndpoints() {
 			return nil
 		})
 		if err != nil {
-			return c.JSON(500, struct {
-				Error string `json:"error"`
-			}{Error: err.Error()})
+			return errorResponse(c, err)
 		}
 		return c.JSON(200, result)
 	})
 }
 
+// parseExcludedStrengths 解析 exclude 和 follow 参数，返回路径上不跟随的引用强度
+// exclude 指定不跟随的引用强度，follow 指定跟随的引用强度，其他强度都不跟随
+func parseExcludedStrengths(c echo.Context) ([]model.ReferenceStrength, error) {
+	var excluded []model.ReferenceStrength
+	if excludeStr := c.QueryParam("exclude"); excludeStr != "" {
+		for _, name := range strings.Split(excludeStr, ",") {
+			strength, err := model.ParseReferenceStrength(name)
+			if err != nil {
+				return nil, err
+			}
+			excluded = append(excluded, strength)
+		}
+	}
+	if followStr := c.QueryParam("follow"); followStr != "" {
+		followed, err := model.ParseReferenceStrengths(followStr)
+		if err != nil {
+			return nil, err
+		}
+		for _, strength := range model.ReferenceStrengthsByReachability {
+			if !model.ContainsReferenceStrength(followed, strength) {
+				excluded = append(excluded, strength)
+			}
+		}
+	}
+	return excluded, nil
+}
+
+func badRequest(c echo.Context, err error) error {
+	return c.JSON(http.StatusBadRequest, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
+
+// errorResponse 根据错误类型返回对应的状态码
+func errorResponse(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, snapshot.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, snapshot.ErrCorrupt), errors.Is(err, snapshot.ErrUnsupported):
+		status = http.StatusUnprocessableEntity
+	}
+	return c.JSON(status, struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
+
 func (w *WebEndpoint) Start(address string) {
 	w.initEndpoints()
 	w.e.Logger.Fatal(w.e.Start(address))